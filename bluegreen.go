@@ -0,0 +1,116 @@
+package main
+
+import (
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+const (
+	blueGreenPreview   = "Preview"
+	blueGreenPromoted  = "Promoted"
+	blueGreenCompleted = "Completed"
+)
+
+// defaultScaleDownDelay keeps the previous version after the promotion when the strategy sets no scaleDownDelay
+const defaultScaleDownDelay = 30 * time.Second
+
+// blueGreenStrategy returns the blue/green strategy of deploydaemon, nil when it has none or a canary takes precedence
+func blueGreenStrategy(deploydaemon *v1alpha1.DeployDaemon) *v1alpha1.BlueGreenStrategy {
+	if deploydaemon.Spec.Strategy == nil || len(canarySteps(deploydaemon)) > 0 {
+		return nil
+	}
+	return deploydaemon.Spec.Strategy.BlueGreen
+}
+
+// startBlueGreen deploys the current version of deploydaemon as a preview when it has a blue/green strategy.
+// Going back to the active version of an unfinished blue/green is a rollback, that version is exposed at once.
+func startBlueGreen(deploydaemon *v1alpha1.DeployDaemon, activeVersion string) {
+	if bg := deploydaemon.Status.BlueGreen; bg != nil && bg.Phase != blueGreenCompleted &&
+		bg.Version == activeVersion && bg.ActiveVersion == deploydaemon.Spec.Version {
+		klog.Infof("roll back deploydaemon %s from version %s to %s", deploydaemon.Name, activeVersion, deploydaemon.Spec.Version)
+		deploydaemon.Status.BlueGreen = nil
+		return
+	}
+
+	if blueGreenStrategy(deploydaemon) == nil {
+		deploydaemon.Status.BlueGreen = nil
+		return
+	}
+
+	klog.Infof("start blue/green of deploydaemon %s from version %s to %s", deploydaemon.Name, activeVersion, deploydaemon.Spec.Version)
+	deploydaemon.Status.BlueGreen = &v1alpha1.BlueGreenStatus{
+		Version:       deploydaemon.Spec.Version,
+		ActiveVersion: activeVersion,
+		Phase:         blueGreenPreview,
+	}
+}
+
+// rolloutBlueGreen returns the blue/green of the version being rolled out, nil when the previous version is already retired
+func rolloutBlueGreen(deploydaemon *v1alpha1.DeployDaemon) *v1alpha1.BlueGreenStatus {
+	if deploydaemon.Status == nil || deploydaemon.Status.Cluster == nil || deploydaemon.Status.Cluster.PreviousDeploymentName == "" {
+		return nil
+	}
+	if bg := deploydaemon.Status.BlueGreen; bg != nil && bg.Version == deploydaemon.Spec.Version {
+		return bg
+	}
+	return nil
+}
+
+// syncBlueGreen moves the blue/green of the version being rolled out forward and returns how long to wait for the next move.
+//
+// The ready preview is promoted by the promote annotation or once autoPromoteAfter is over. syncPodExposeStatus then
+// flips the preview online and the previous version offline in the same sync. The previous deployment is retired
+// after scaleDownDelay, until then setting the version back rolls back at once.
+func (c *Controller) syncBlueGreen(deploydaemon *v1alpha1.DeployDaemon, now time.Time) (time.Duration, error) {
+	bg := rolloutBlueGreen(deploydaemon)
+	if bg == nil || bg.Phase == blueGreenCompleted {
+		return 0, nil
+	}
+
+	strategy := blueGreenStrategy(deploydaemon)
+	if strategy == nil {
+		strategy = &v1alpha1.BlueGreenStrategy{}
+	}
+
+	if bg.Phase == blueGreenPreview {
+		if bg.PreviewStartTime == nil {
+			start := metav1.NewTime(now.Truncate(time.Second))
+			bg.PreviewStartTime = &start
+			c.recorder.Eventf(deploydaemon, corev1.EventTypeNormal, "BlueGreenPreview", "Version %s is ready as a preview, version %s is exposed", bg.Version, bg.ActiveVersion)
+		}
+
+		_, promote := deploydaemon.Annotations[promoteAnnotation]
+		if !promote && strategy.AutoPromoteAfter == nil {
+			return 0, nil
+		}
+		if !promote {
+			if wait := bg.PreviewStartTime.Add(strategy.AutoPromoteAfter.Duration).Sub(now); wait > 0 {
+				return wait, nil
+			}
+		}
+
+		delete(deploydaemon.Annotations, promoteAnnotation)
+		promoted := metav1.NewTime(now.Truncate(time.Second))
+		bg.PromoteTime = &promoted
+		bg.Phase = blueGreenPromoted
+		c.recorder.Eventf(deploydaemon, corev1.EventTypeNormal, "BlueGreenPromoted", "Version %s promoted over version %s", bg.Version, bg.ActiveVersion)
+	}
+
+	delay := defaultScaleDownDelay
+	if strategy.ScaleDownDelay != nil {
+		delay = strategy.ScaleDownDelay.Duration
+	}
+	if wait := bg.PromoteTime.Add(delay).Sub(now); wait > 0 {
+		return wait, nil
+	}
+
+	if err := c.retireDeployment(deploydaemon); err != nil {
+		return 0, err
+	}
+	bg.Phase = blueGreenCompleted
+	return 0, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newBlueGreenDeployDaemon returns a deploydaemon previewing version 9.0.1.3 while 9.0.1.2 is active
+func newBlueGreenDeployDaemon(name string, replicas int32) *v1alpha1.DeployDaemon {
+	dd := newDeployDaemon(name, replicas)
+	dd.Spec.Version = "9.0.1.3"
+	dd.Spec.Strategy = &v1alpha1.DeployStrategy{
+		BlueGreen: &v1alpha1.BlueGreenStrategy{
+			ScaleDownDelay: &metav1.Duration{Duration: time.Minute},
+		},
+	}
+	dd.Status = &v1alpha1.DeploydaemonStatus{
+		Cluster: &v1alpha1.ClusterSpec{
+			Name:                   name,
+			NameSpace:              dd.Namespace,
+			DeploymentName:         deploymentNameFor(dd),
+			PreviousDeploymentName: dd.GetDeploymentName() + "-9.0.1.2",
+		},
+	}
+	startBlueGreen(dd, "9.0.1.2")
+	return dd
+}
+
+func TestSyncBlueGreenWaitsForPromote(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newBlueGreenDeployDaemon("test", 1)
+	now := time.Date(2019, 1, 5, 3, 0, 0, 0, time.UTC)
+
+	if wait, err := c.syncBlueGreen(dd, now); err != nil || wait != 0 {
+		t.Fatalf("expected preview to wait for promotion, got %s %v", wait, err)
+	}
+	bg := dd.Status.BlueGreen
+	if bg.Phase != blueGreenPreview || bg.PreviewStartTime == nil {
+		t.Fatalf("expected ready preview, got %+v", *bg)
+	}
+
+	dd.Annotations = map[string]string{promoteAnnotation: "true"}
+	if wait, _ := c.syncBlueGreen(dd, now); wait != time.Minute {
+		t.Errorf("expected to keep previous version for 1m, got %s", wait)
+	}
+	if bg.Phase != blueGreenPromoted {
+		t.Errorf("expected preview promoted, got %s", bg.Phase)
+	}
+	if _, exist := dd.Annotations[promoteAnnotation]; exist {
+		t.Errorf("expected promote annotation to be removed")
+	}
+}
+
+func TestSyncBlueGreenAutoPromote(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newBlueGreenDeployDaemon("test", 1)
+	dd.Spec.Strategy.BlueGreen.AutoPromoteAfter = &metav1.Duration{Duration: 10 * time.Minute}
+	now := time.Date(2019, 1, 5, 3, 0, 0, 0, time.UTC)
+
+	if wait, _ := c.syncBlueGreen(dd, now); wait != 10*time.Minute {
+		t.Errorf("expected to wait 10m for auto promotion, got %s", wait)
+	}
+	if wait, _ := c.syncBlueGreen(dd, now.Add(10*time.Minute)); wait != time.Minute || dd.Status.BlueGreen.Phase != blueGreenPromoted {
+		t.Errorf("expected preview promoted, got %s %+v", wait, *dd.Status.BlueGreen)
+	}
+}
+
+func TestSyncBlueGreenRetiresPreviousAfterDelay(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newBlueGreenDeployDaemon("test", 1)
+	previous := dd.Status.Cluster.PreviousDeploymentName
+	now := time.Date(2019, 1, 5, 3, 0, 0, 0, time.UTC)
+
+	dd.Annotations = map[string]string{promoteAnnotation: "true"}
+	c.syncBlueGreen(dd, now)
+	if dd.Status.Cluster.PreviousDeploymentName != previous {
+		t.Fatalf("expected previous deployment to be kept during scale down delay")
+	}
+
+	if _, err := c.syncBlueGreen(dd, now.Add(time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dd.Status.Cluster.PreviousDeploymentName != "" || dd.Status.BlueGreen.Phase != blueGreenCompleted {
+		t.Errorf("expected previous deployment retired, got %+v %+v", *dd.Status.Cluster, *dd.Status.BlueGreen)
+	}
+	if _, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(previous, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected previous deployment to be deleted, got %v", err)
+	}
+}
+
+func TestStartBlueGreenRollback(t *testing.T) {
+	dd := newBlueGreenDeployDaemon("test", 1)
+	dd.Spec.Version = "9.0.1.2"
+
+	startBlueGreen(dd, "9.0.1.3")
+	if dd.Status.BlueGreen != nil {
+		t.Errorf("expected rollback to the active version to skip the preview, got %+v", *dd.Status.BlueGreen)
+	}
+}
+
+func TestSyncPodExposeFlipsBlueGreen(t *testing.T) {
+	f := newFixture(t)
+	dd := newBlueGreenDeployDaemon("test", 3)
+
+	c := f.newController()
+	active := dd.DeepCopy()
+	active.Spec.Version = "9.0.1.2"
+	// The preview pods are labeled as the template of the preview deployment labels them
+	preview, err := c.makePodTemplate(dd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, version := range []*v1alpha1.DeployDaemon{active, dd} {
+		for _, pod := range newPods(version, 3, exposeOnline) {
+			if version == dd {
+				pod.Labels = preview.Labels
+			}
+			pod.Name = version.Spec.Version + "-" + pod.Name
+			f.kubeclient.CoreV1().Pods(dd.Namespace).Create(pod)
+			f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Add(pod)
+		}
+	}
+
+	onlineByVersion := func() map[string]int {
+		online := map[string]int{}
+		pods, _ := f.kubeclient.CoreV1().Pods(dd.Namespace).List(metav1.ListOptions{})
+		for _, pod := range pods.Items {
+			if pod.Labels[exposeLabel] == exposeOnline {
+				online[pod.Labels["version"]]++
+			}
+			f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Update(pod.DeepCopy())
+		}
+		return online
+	}
+
+	if online := onlineByVersion(); online["9.0.1.3"] != 0 {
+		t.Errorf("expected the preview pods to start offline, got %v", online)
+	}
+	if err := c.syncPodExposeStatus(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if online := onlineByVersion(); online["9.0.1.3"] != 0 || online["9.0.1.2"] != 3 {
+		t.Errorf("expected preview offline and active version online, got %v", online)
+	}
+
+	dd.Status.BlueGreen.Phase = blueGreenPromoted
+	if err := c.syncPodExposeStatus(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if online := onlineByVersion(); online["9.0.1.3"] != 3 || online["9.0.1.2"] != 0 {
+		t.Errorf("expected promoted version online and previous version offline, got %v", online)
+	}
+}
+
+func TestBlueGreenPreviewStaysOfflineUntilPromoted(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newBlueGreenDeployDaemon("test", 2)
+	dd.Spec.Version = "9.0.1.2"
+	dd.Status = nil
+	active := f.newSyncedDeployment(c, dd)
+	for _, pod := range newPods(dd, 2, exposeOnline) {
+		pod.Name = "9.0.1.2-" + pod.Name
+		f.kubeclient.CoreV1().Pods(dd.Namespace).Create(pod)
+		f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Add(pod)
+	}
+
+	dd.Spec.Version = "9.0.1.3"
+	c.syncDeployDaemon(dd, active)
+	preview, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(deploymentNameFor(dd), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the preview deployment to be created: %v", err)
+	}
+
+	// The pods of the preview deployment come up with the labels of its template, then the deployment is ready
+	for _, pod := range newPods(dd, 2, "") {
+		pod.Labels = preview.Spec.Template.Labels
+		pod.Name = "9.0.1.3-" + pod.Name
+		f.kubeclient.CoreV1().Pods(dd.Namespace).Create(pod)
+		f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Add(pod)
+	}
+	previewOnline := func() int {
+		online := 0
+		pods, _ := f.kubeclient.CoreV1().Pods(dd.Namespace).List(metav1.ListOptions{})
+		for _, pod := range pods.Items {
+			if pod.Labels["version"] == "9.0.1.3" && pod.Labels[exposeLabel] == exposeOnline {
+				online++
+			}
+			f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Update(pod.DeepCopy())
+		}
+		return online
+	}
+	if online := previewOnline(); online != 0 {
+		t.Fatalf("expected the preview pods to start offline, got %d online", online)
+	}
+
+	preview.Status = appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2, AvailableReplicas: 2}
+	c.syncDeployDaemon(dd, preview)
+	if online := previewOnline(); online != 0 || dd.Status.BlueGreen.Phase != blueGreenPreview {
+		t.Errorf("expected no preview pod online before promotion, got %d online in %+v", online, *dd.Status.BlueGreen)
+	}
+
+	dd.Annotations = map[string]string{promoteAnnotation: "true"}
+	c.syncDeployDaemon(dd, preview)
+	if online := previewOnline(); online != 2 {
+		t.Errorf("expected the promoted pods online, got %d", online)
+	}
+}
+
+func TestTrafficRoutesFollowBlueGreen(t *testing.T) {
+	dd := newBlueGreenDeployDaemon("test", 1)
+
+	routes := trafficRoutes([]*v1alpha1.DeployDaemon{dd})
+	if len(routes) != 2 || routes[0].Version != "9.0.1.2" || routes[0].Weight != 100 || routes[1].Weight != 0 {
+		t.Errorf("expected traffic on active version during preview, got %v", routes)
+	}
+}
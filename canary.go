@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// promoteAnnotation and abortAnnotation are set by the user to end a rollout, the controller removes them once handled
+const (
+	promoteAnnotation = "deploycontrol.k8s.io/promote"
+	abortAnnotation   = "deploycontrol.k8s.io/abort"
+)
+
+const (
+	canaryProgressing = "Progressing"
+	canaryPaused      = "Paused"
+	canaryCompleted   = "Completed"
+	canaryAborted     = "Aborted"
+)
+
+// canarySteps returns the canary steps of deploydaemon, none when it has no canary strategy
+func canarySteps(deploydaemon *v1alpha1.DeployDaemon) []v1alpha1.CanaryStep {
+	if deploydaemon.Spec.Strategy == nil || deploydaemon.Spec.Strategy.Canary == nil {
+		return nil
+	}
+	return deploydaemon.Spec.Strategy.Canary.Steps
+}
+
+// startCanary starts the canary rollout of the current version of deploydaemon when it has canary steps
+func startCanary(deploydaemon *v1alpha1.DeployDaemon, stableVersion string) {
+	if len(canarySteps(deploydaemon)) == 0 {
+		deploydaemon.Status.Canary = nil
+		return
+	}
+
+	klog.Infof("start canary of deploydaemon %s from version %s to %s", deploydaemon.Name, stableVersion, deploydaemon.Spec.Version)
+	deploydaemon.Status.Canary = &v1alpha1.CanaryStatus{
+		Version:       deploydaemon.Spec.Version,
+		StableVersion: stableVersion,
+		Phase:         canaryProgressing,
+	}
+}
+
+// rolloutCanary returns the canary of the version being rolled out, nil when the previous version is already retired
+func rolloutCanary(deploydaemon *v1alpha1.DeployDaemon) *v1alpha1.CanaryStatus {
+	if deploydaemon.Status == nil || deploydaemon.Status.Cluster == nil || deploydaemon.Status.Cluster.PreviousDeploymentName == "" {
+		return nil
+	}
+	if canary := deploydaemon.Status.Canary; canary != nil && canary.Version == deploydaemon.Spec.Version {
+		return canary
+	}
+	return nil
+}
+
+// syncCanary runs the canary steps of the version being rolled out and returns how long to wait for the running step.
+//
+// Each step sets the weight of the new version, then pauses. Without pause the next step runs at once. The promote
+// annotation skips the remaining steps, the abort annotation gives all the exposure back to the previous version
+// until the version is changed again. The previous version is only retired once the canary is completed.
+func (c *Controller) syncCanary(deploydaemon *v1alpha1.DeployDaemon, now time.Time) (time.Duration, error) {
+	canary := rolloutCanary(deploydaemon)
+	if canary == nil || canary.Phase == canaryCompleted || canary.Phase == canaryAborted {
+		return 0, nil
+	}
+
+	steps := canarySteps(deploydaemon)
+	if err := validateCanarySteps(steps); err != nil {
+		return 0, err
+	}
+
+	if _, exist := deploydaemon.Annotations[abortAnnotation]; exist {
+		delete(deploydaemon.Annotations, abortAnnotation)
+		canary.Phase = canaryAborted
+		canary.Weight = 0
+		canary.StepStartTime = nil
+		c.recorder.Eventf(deploydaemon, corev1.EventTypeWarning, "CanaryAborted", "Canary of version %s aborted, version %s is exposed", canary.Version, canary.StableVersion)
+		return 0, nil
+	}
+
+	if _, exist := deploydaemon.Annotations[promoteAnnotation]; exist {
+		delete(deploydaemon.Annotations, promoteAnnotation)
+		canary.CurrentStep = int32(len(steps))
+		c.recorder.Eventf(deploydaemon, corev1.EventTypeNormal, "CanaryPromoted", "Canary of version %s promoted", canary.Version)
+	}
+
+	for int(canary.CurrentStep) < len(steps) {
+		step := steps[canary.CurrentStep]
+
+		if canary.StepStartTime == nil {
+			if step.SetWeight != nil {
+				canary.Weight = *step.SetWeight
+			}
+			start := metav1.NewTime(now.Truncate(time.Second))
+			canary.StepStartTime = &start
+			c.recorder.Eventf(deploydaemon, corev1.EventTypeNormal, "CanaryStep", "Canary step %d/%d, version %s weight %d", canary.CurrentStep+1, len(steps), canary.Version, canary.Weight)
+		}
+
+		if step.Pause != nil {
+			if wait := canary.StepStartTime.Add(step.Pause.Duration).Sub(now); wait > 0 {
+				canary.Phase = canaryPaused
+				return wait, nil
+			}
+		}
+
+		canary.CurrentStep++
+		canary.StepStartTime = nil
+		canary.Phase = canaryProgressing
+	}
+
+	canary.Phase = canaryCompleted
+	canary.Weight = 100
+	canary.StepStartTime = nil
+	c.recorder.Eventf(deploydaemon, corev1.EventTypeNormal, "CanaryCompleted", "Canary of version %s completed", canary.Version)
+	return 0, nil
+}
+
+func validateCanarySteps(steps []v1alpha1.CanaryStep) error {
+	for i, step := range steps {
+		if step.SetWeight != nil && (*step.SetWeight < 0 || *step.SetWeight > 100) {
+			return fmt.Errorf("canary step %d setWeight %d is out of range 0-100", i, *step.SetWeight)
+		}
+		if step.Pause != nil && step.Pause.Duration < 0 {
+			return fmt.Errorf("canary step %d pause %s is negative", i, step.Pause.Duration)
+		}
+	}
+	return nil
+}
+
+// canaryExposePercent scales the expose percent of the canary version by the canary weight
+func canaryExposePercent(deploydaemon *v1alpha1.DeployDaemon, canary *v1alpha1.CanaryStatus) *int32 {
+	percent := int32(100)
+	if deploydaemon.Spec.ExposePercent != nil {
+		// Leave an invalid percent as it is so that planPodExpose reports it
+		if percent = *deploydaemon.Spec.ExposePercent; percent < 0 || percent > 100 {
+			return &percent
+		}
+	}
+	percent = percent * canary.Weight / 100
+	return &percent
+}
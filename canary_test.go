@@ -0,0 +1,263 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+// newCanaryDeployDaemon returns a deploydaemon rolling out version 9.0.1.3 over 9.0.1.2 with three canary steps
+func newCanaryDeployDaemon(name string, replicas int32) *v1alpha1.DeployDaemon {
+	dd := newDeployDaemon(name, replicas)
+	dd.Spec.Version = "9.0.1.3"
+	dd.Spec.Strategy = &v1alpha1.DeployStrategy{
+		Canary: &v1alpha1.CanaryStrategy{
+			Steps: []v1alpha1.CanaryStep{
+				{SetWeight: int32Ptr(10), Pause: &metav1.Duration{Duration: 5 * time.Minute}},
+				{SetWeight: int32Ptr(50)},
+				{SetWeight: int32Ptr(80), Pause: &metav1.Duration{Duration: 10 * time.Minute}},
+			},
+		},
+	}
+	dd.Status = &v1alpha1.DeploydaemonStatus{
+		Cluster: &v1alpha1.ClusterSpec{
+			Name:                   name,
+			NameSpace:              dd.Namespace,
+			DeploymentName:         deploymentNameFor(dd),
+			PreviousDeploymentName: dd.GetDeploymentName() + "-9.0.1.2",
+		},
+	}
+	startCanary(dd, "9.0.1.2")
+	return dd
+}
+
+func TestSyncCanaryRunsSteps(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newCanaryDeployDaemon("test", 10)
+	now := time.Date(2019, 1, 5, 3, 0, 0, 0, time.UTC)
+
+	wait, err := c.syncCanary(dd, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	canary := dd.Status.Canary
+	if wait != 5*time.Minute || canary.CurrentStep != 0 || canary.Weight != 10 || canary.Phase != canaryPaused {
+		t.Errorf("expected first step paused at weight 10 for 5m, got %s %+v", wait, *canary)
+	}
+
+	// A sync during the pause only waits for the rest of it
+	if wait, _ = c.syncCanary(dd, now.Add(2*time.Minute)); wait != 3*time.Minute {
+		t.Errorf("expected to wait 3m, got %s", wait)
+	}
+
+	// The second step has no pause, the third one starts at once
+	now = now.Add(5 * time.Minute)
+	if wait, _ = c.syncCanary(dd, now); wait != 10*time.Minute {
+		t.Errorf("expected to wait 10m, got %s", wait)
+	}
+	if canary.CurrentStep != 2 || canary.Weight != 80 {
+		t.Errorf("expected third step at weight 80, got %+v", *canary)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if wait, _ = c.syncCanary(dd, now); wait != 0 {
+		t.Errorf("expected no wait once completed, got %s", wait)
+	}
+	if canary.CurrentStep != 3 || canary.Weight != 100 || canary.Phase != canaryCompleted {
+		t.Errorf("expected canary completed, got %+v", *canary)
+	}
+}
+
+func TestSyncCanaryPromote(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newCanaryDeployDaemon("test", 10)
+	now := time.Now()
+	c.syncCanary(dd, now)
+
+	dd.Annotations = map[string]string{promoteAnnotation: "true"}
+	if wait, err := c.syncCanary(dd, now); err != nil || wait != 0 {
+		t.Fatalf("expected promote without wait, got %s %v", wait, err)
+	}
+	if dd.Status.Canary.Phase != canaryCompleted || dd.Status.Canary.Weight != 100 {
+		t.Errorf("expected canary completed, got %+v", *dd.Status.Canary)
+	}
+	if _, exist := dd.Annotations[promoteAnnotation]; exist {
+		t.Errorf("expected promote annotation to be removed")
+	}
+}
+
+func TestSyncCanaryAbort(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newCanaryDeployDaemon("test", 10)
+	now := time.Now()
+	c.syncCanary(dd, now)
+
+	dd.Annotations = map[string]string{abortAnnotation: "true"}
+	if _, err := c.syncCanary(dd, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dd.Status.Canary.Phase != canaryAborted || dd.Status.Canary.Weight != 0 {
+		t.Errorf("expected canary aborted, got %+v", *dd.Status.Canary)
+	}
+
+	// An aborted canary stays aborted until the version changes
+	if wait, _ := c.syncCanary(dd, now.Add(time.Hour)); wait != 0 || dd.Status.Canary.Phase != canaryAborted {
+		t.Errorf("expected canary to stay aborted, got %+v", *dd.Status.Canary)
+	}
+}
+
+func TestSyncCanaryRejectsInvalidWeight(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newCanaryDeployDaemon("test", 10)
+	dd.Spec.Strategy.Canary.Steps[0].SetWeight = int32Ptr(120)
+
+	if _, err := c.syncCanary(dd, time.Now()); err == nil {
+		t.Errorf("expected error for setWeight out of range")
+	}
+}
+
+func TestSyncDeploymentStartsCanary(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newCanaryDeployDaemon("test", 1)
+	dd.Spec.Version = "9.0.1.2"
+	dd.Status = nil
+	old := f.newSyncedDeployment(c, dd)
+
+	dd.Spec.Version = "9.0.1.3"
+	c.syncDeployment(dd, old)
+
+	canary := dd.Status.Canary
+	if canary == nil || canary.Version != "9.0.1.3" || canary.StableVersion != "9.0.1.2" || canary.Phase != canaryProgressing {
+		t.Errorf("expected canary from 9.0.1.2 to 9.0.1.3, got %+v", canary)
+	}
+}
+
+func TestSyncDeploymentKeepsPreviousVersionDuringCanary(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newCanaryDeployDaemon("test", 1)
+	canary := dd.Status.Canary
+	dd.Status.Canary = nil
+	current := f.newSyncedDeployment(c, dd)
+	dd.Status.Cluster.PreviousDeploymentName = dd.GetDeploymentName() + "-9.0.1.2"
+	dd.Status.Canary = canary
+
+	if err := c.syncDeployment(dd, current); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dd.Status.Cluster.PreviousDeploymentName == "" {
+		t.Errorf("expected previous version to be kept during canary")
+	}
+
+	canary.Phase = canaryCompleted
+	if err := c.syncDeployment(dd, current); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dd.Status.Cluster.PreviousDeploymentName != "" {
+		t.Errorf("expected previous version to be retired once canary completed")
+	}
+}
+
+func TestSyncPodExposeSplitsCanaryPods(t *testing.T) {
+	f := newFixture(t)
+	dd := newCanaryDeployDaemon("test", 10)
+	dd.Status.Canary.Weight = 30
+
+	stable := dd.DeepCopy()
+	stable.Spec.Version = "9.0.1.2"
+	for _, version := range []*v1alpha1.DeployDaemon{stable, dd} {
+		for _, pod := range newPods(version, 10, exposeOnline) {
+			pod.Name = version.Spec.Version + "-" + pod.Name
+			f.kubeclient.CoreV1().Pods(dd.Namespace).Create(pod)
+			f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Add(pod)
+		}
+	}
+
+	c := f.newController()
+	if err := c.syncPodExposeStatus(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	online := map[string]int{}
+	pods, _ := f.kubeclient.CoreV1().Pods(dd.Namespace).List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(map[string]string{exposeLabel: exposeOnline}).String(),
+	})
+	for _, pod := range pods.Items {
+		online[pod.Labels["version"]]++
+	}
+	if online["9.0.1.3"] != 3 || online["9.0.1.2"] != 7 {
+		t.Errorf("expected 3 canary and 7 stable pods online, got %v", online)
+	}
+	if dd.Status.Expose.OnlineReplicas != 3 {
+		t.Errorf("expected status to report canary pods, got %+v", *dd.Status.Expose)
+	}
+}
+
+func TestCanaryPodsStartAtFirstStepWeight(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newCanaryDeployDaemon("test", 10)
+	dd.Spec.Version = "9.0.1.2"
+	dd.Status = nil
+	stable := f.newSyncedDeployment(c, dd)
+	for _, pod := range newPods(dd, 10, exposeOnline) {
+		pod.Name = "9.0.1.2-" + pod.Name
+		f.kubeclient.CoreV1().Pods(dd.Namespace).Create(pod)
+		f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Add(pod)
+	}
+
+	dd.Spec.Version = "9.0.1.3"
+	c.syncDeployDaemon(dd, stable)
+	canary, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(deploymentNameFor(dd), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the canary deployment to be created: %v", err)
+	}
+
+	// The canary pods come up with the labels of the template of the canary deployment
+	for _, pod := range newPods(dd, 10, "") {
+		pod.Labels = canary.Spec.Template.Labels
+		pod.Name = "9.0.1.3-" + pod.Name
+		f.kubeclient.CoreV1().Pods(dd.Namespace).Create(pod)
+		f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Add(pod)
+	}
+	onlineByVersion := func() map[string]int {
+		online := map[string]int{}
+		pods, _ := f.kubeclient.CoreV1().Pods(dd.Namespace).List(metav1.ListOptions{})
+		for _, pod := range pods.Items {
+			if pod.Labels[exposeLabel] == exposeOnline {
+				online[pod.Labels["version"]]++
+			}
+			f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Update(pod.DeepCopy())
+		}
+		return online
+	}
+	if online := onlineByVersion(); online["9.0.1.3"] != 0 || online["9.0.1.2"] != 10 {
+		t.Fatalf("expected the canary pods to start offline, got %v", online)
+	}
+
+	canary.Status = appsv1.DeploymentStatus{Replicas: 10, UpdatedReplicas: 10, ReadyReplicas: 10, AvailableReplicas: 10}
+	c.syncDeployDaemon(dd, canary)
+	if online := onlineByVersion(); online["9.0.1.3"] != 1 || online["9.0.1.2"] != 9 {
+		t.Errorf("expected 1 canary and 9 stable pods online at the first step weight 10, got %v", online)
+	}
+}
+
+func TestTrafficRoutesSplitCanaryWeight(t *testing.T) {
+	dd := newCanaryDeployDaemon("test", 10)
+	dd.Status.Canary.Weight = 20
+
+	routes := trafficRoutes([]*v1alpha1.DeployDaemon{dd})
+	if len(routes) != 2 {
+		t.Fatalf("expected stable and canary routes, got %v", routes)
+	}
+	if routes[0].Version != "9.0.1.2" || routes[0].Weight != 80 || routes[1].Version != "9.0.1.3" || routes[1].Weight != 20 {
+		t.Errorf("expected 80/20 split, got %v", routes)
+	}
+}
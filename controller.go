@@ -2,8 +2,12 @@ package main
 
 import (
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -13,6 +17,9 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 	utils "github.com/kongyi-ibm/k8s-deployment-operator/pkg/utilities"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/metrics"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/templates"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/traffic"
 	"k8s.io/klog"
 	"time"
 
@@ -53,6 +60,18 @@ type Controller struct {
 
 	podsSynced cache.InformerSynced
 
+	serviceLister corev1listers.ServiceLister
+
+	servicesSynced cache.InformerSynced
+
+	configMapsSynced cache.InformerSynced
+
+	// templates provides the pod templates referenced by deploydaemon templateRef
+	templates templates.Provider
+
+	// traffic routes the traffic of a component between its versions, nil when no traffic provider is enabled
+	traffic traffic.Provider
+
 	// workqueue is a rate limited work queue. This is used to queue work to be
 	// processed instead of performing it as soon as a change happens. This
 	// means we can ensure we only process a fixed amount of resources at a
@@ -65,10 +84,32 @@ type Controller struct {
 	// recorder is an event recorder for recording Event resources to the
 	// Kubernetes API.
 	recorder record.EventRecorder
+
+	// conditions maintains the conditions of the deploydaemon status
+	conditions v1alpha1.ConditionManager
+
+	// workers tracks the progress of the workers for the liveness probe
+	workers workerProgress
 }
 
 const controllerAgentName = "deploydaemon-controller"
 
+// specHashAnnotation records on the deployment the hash of the deploydaemon spec it was rendered from
+const specHashAnnotation = "deploycontrol.k8s.io/spec-hash"
+
+// templateHashAnnotation records on the deployment the hash of its pod template as the API server stored it, defaults
+// included, so a manual edit of the template is told apart from the fields the API server defaulted
+const templateHashAnnotation = "deploycontrol.k8s.io/template-hash"
+
+// exposeLabel marks a pod online or offline, it is what services select on to route traffic to the pod
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+
+	exposeLabel   = "expose"
+	exposeOnline  = "online"
+	exposeOffline = "offline"
+)
+
 // Random byte reader used for pod name generation.
 // var for testing.
 var randReader = rand.Reader
@@ -78,7 +119,11 @@ func NewController(
 	   extclientset clientset.Interface,
 	   deploymentInformer appsinformer.DeploymentInformer,
 	   podInformer corev1informer.PodInformer,
-	   deploydaemonInformer deploycontrinformer.DeployDaemonInformer) *Controller {
+	   configMapInformer corev1informer.ConfigMapInformer,
+	   serviceInformer corev1informer.ServiceInformer,
+	   deploydaemonInformer deploycontrinformer.DeployDaemonInformer,
+	   trafficProvider traffic.Provider,
+	   rateLimiter workqueue.RateLimiter) *Controller {
 
     // Create event broadcaster
     // Add deploycontrol types to the default Kubernetes Scheme so Events can be
@@ -98,9 +143,14 @@ func NewController(
             deploymentsSynced:   deploymentInformer.Informer().HasSynced,
 		    podslister:          podInformer.Lister(),
 		    podsSynced:          podInformer.Informer().HasSynced,
+		    configMapsSynced:    configMapInformer.Informer().HasSynced,
+		    serviceLister:       serviceInformer.Lister(),
+		    servicesSynced:      serviceInformer.Informer().HasSynced,
+		    templates:           templates.NewConfigMapProvider(configMapInformer.Lister()),
+		    traffic:             trafficProvider,
 		    deploydaemonLister:  deploydaemonInformer.Lister(),
 		    deploydaemonSynced:  deploydaemonInformer.Informer().HasSynced,
-            workqueue:           utils.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "DeployDaemons"),
+            workqueue:           utils.NewNamedRateLimitingQueue(rateLimiter, "DeployDaemons"),
 		    //delayqueue:          workqueue.NewNamedDelayingQueue("DelyQueue"),
             recorder:            recorder,
     }
@@ -115,6 +165,10 @@ func NewController(
 		},
 	})
 
+	// Sync the owning deploydaemon when its deployments or pods change
+	deploymentInformer.Informer().AddEventHandler(controller.deploymentEventHandler())
+	podInformer.Informer().AddEventHandler(controller.podEventHandler())
+
     return controller
 }
 
@@ -132,11 +186,12 @@ func ( c *Controller ) Run(threadiness int, stopCh <-chan struct{}) error {
 	// Waiting for the caches to be synced before starting workers
 	klog.Info("Waiting for informer caches to sync")
 
-	if ok:=cache.WaitForCacheSync(stopCh, c.deploydaemonSynced,c.podsSynced,c.deploymentsSynced); !ok {
+	if ok:=cache.WaitForCacheSync(stopCh, c.deploydaemonSynced,c.podsSynced,c.deploymentsSynced,c.configMapsSynced,c.servicesSynced); !ok {
 		return fmt.Errorf("failed to wait for caches to sync")
 	}
 
 	klog.Info("Starting workers")
+	c.workers.start(threadiness, time.Now())
 	// Launch two workers to process Foo resources
 	for i := 0; i < threadiness; i++ {
 		go wait.Until(c.runWorker, time.Second, stopCh)
@@ -169,8 +224,10 @@ func (c *Controller) processNextWorkItem() bool {
 		return false
 	}
 
+	c.workers.take()
 	err := func(obj interface{}) error{
 
+		defer c.workers.done(time.Now())
 		defer c.workqueue.Done(obj)
 		var key string
 		var ok bool
@@ -184,7 +241,11 @@ func (c *Controller) processNextWorkItem() bool {
 			return nil
 		}
 
-		if err := c.reconcile(key); err !=nil {
+		start := time.Now()
+		err := c.reconcile(key)
+		c.observeReconcile(key, time.Since(start), err)
+
+		if err !=nil {
 			c.workqueue.AddRateLimited(obj)
 			return fmt.Errorf("sync DeployDaemon %s failed: %s", key, err.Error())
 		}
@@ -203,6 +264,19 @@ func (c *Controller) processNextWorkItem() bool {
     return true
 }
 
+// observeReconcile records a reconcile of key in the metrics, the series of a deleted deploydaemon are dropped
+func (c *Controller) observeReconcile(key string, duration time.Duration, err error) {
+	namespace, name, splitErr := cache.SplitMetaNamespaceKey(key)
+	if splitErr != nil {
+		return
+	}
+	if _, getErr := c.deploydaemonLister.DeployDaemons(namespace).Get(name); errors.IsNotFound(getErr) {
+		metrics.ForgetDeployDaemon(namespace, name)
+		return
+	}
+	metrics.ObserveReconcile(namespace, name, duration, err)
+}
+
 //TODO: Create new package for Reconciler. So far, wrap most logic in this function
 func (c *Controller ) reconcile(key string) error {
 
@@ -221,39 +295,88 @@ func (c *Controller ) reconcile(key string) error {
 
 	//TODO: Move isDone to final steps after all check passed. This can cover other parameter changes
 
-	// All obj in index is ready only
+	// All obj in index is ready only, original is kept to only write what the sync changed
+	original := deploydaemon
 	deploydaemon = deploydaemon.DeepCopy()
 
+	// A deleted deploydaemon is drained before its finalizer lets it go
+	if deploydaemon.DeletionTimestamp != nil {
+		wait, err := c.syncDeletion(deploydaemon, time.Now())
+		if err != nil {
+			klog.Errorf("drain deleted deploydaemon %s failed: %s", key, err.Error())
+			c.recorder.Eventf(deploydaemon, corev1.EventTypeWarning, "DrainFailed", "Drain failed: %s", err.Error())
+			c.markNotReady(deploydaemon, "DrainFailed", err)
+		} else {
+			c.markNotReady(deploydaemon, "Deleting", waitingf("Draining before deletion"))
+		}
+		if updateErr := c.updateDeployDaemonStatus(original, deploydaemon); updateErr != nil {
+			return updateErr
+		}
+		if wait > 0 {
+			c.workqueue.AddDelayDefined(key, wait)
+		}
+		return err
+	}
+	ensureFinalizer(deploydaemon)
+	fillSyncDefaults(deploydaemon)
+
 	var dp *appsv1.Deployment
 
-	////Don't need to handle this, when decided to add the object in workqueue.
-	//
-	// TODO:  Here we need to add logic to check if this deploydaemon has set scheduler, if yes, if the scehduler time is after current time, it must be added into deployqueue
+	// If the deploydaemon has a scheduler, a new version is only deployed once it is due. Until then wake up at the
+	// scheduled time and keep syncing the deployed version with the rest of the spec.
 	if deploydaemon.Spec.Scheduler != "" {
-		klog.Info("Remove scheduler when deploydaemon be handled as duration")
-		deploydaemon.Spec.Scheduler = ""
+		wait, _, err := c.syncSchedule(deploydaemon, time.Now())
+		if err != nil {
+			klog.Errorf("schedule deploydaemon %s failed: %s", key, err.Error())
+			c.conditions.SetCondition(deploydaemon, v1alpha1.Scheduled, corev1.ConditionFalse, "InvalidSchedule", err.Error())
+			c.markNotReady(deploydaemon, "InvalidSchedule", err)
+			return c.updateDeployDaemonStatus(original, deploydaemon)
+		}
+		if wait > 0 {
+			klog.Infof("deploydaemon %s is scheduled at %s, wait %s", key, deploydaemon.Status.NextScheduleTime, wait)
+			c.workqueue.AddDelayDefined(key, wait)
+			message := fmt.Sprintf("Spec is scheduled at %s", deploydaemon.Status.NextScheduleTime.UTC().Format(time.RFC3339))
+			c.conditions.SetCondition(deploydaemon, v1alpha1.Scheduled, corev1.ConditionFalse, "WaitingSchedule", message)
+			revision := currentRevision(deploydaemon)
+			if revision == nil {
+				// Without a deployed revision, e.g. for the first version, the whole spec waits for the schedule
+				return c.updateDeployDaemonStatus(original, deploydaemon)
+			}
+			restoreRevision(deploydaemon, revision)
+		} else {
+			c.conditions.SetCondition(deploydaemon, v1alpha1.Scheduled, corev1.ConditionTrue, "ScheduleDue", "Scheduled spec is deployed")
+		}
+	} else {
+		c.conditions.RemoveCondition(deploydaemon, v1alpha1.Scheduled)
 	}
 
 	// If below status is empty, that means haven't create deployment.
-	if deploydaemon.Status == nil || deploydaemon.Status.Cluster.DeploymentName == "" {
+	if deploydaemon.Status == nil || deploydaemon.Status.Cluster == nil || deploydaemon.Status.Cluster.DeploymentName == "" {
 
          dp, err = c.createDeployent(deploydaemon)
          if err !=nil {
          	klog.Errorf("create deployment %s for deploydaemon %s ", deploydaemon.GenerateName, key )
-         	// Here we need the to fill in the conditionSpec with Reason that the Deployment can not be ceate
-         	// then update the deploydaemon status -- this will trigger the update event and make the deploymentdaemon be add into this controller loop again.
+         	// Record why the deployment can not be created, updating the status makes the deploydaemon synced again.
+         	c.conditions.SetCondition(deploydaemon, v1alpha1.DeploymentCreated, corev1.ConditionFalse, "DeploymentCreateFailed", err.Error())
+         	c.markNotReady(deploydaemon, "DeploymentCreateFailed", err)
+         	dp = nil
+		 } else {
+         	klog.Infof("Waiting status for deployment %s ", deploydaemon.Status.Cluster.DeploymentName)
 		 }
-         klog.Info("Waiting status for deployment %s ", deploydaemon.Status.Cluster.DeploymentName)
 
 	} else {
 
 		dp, err =c.deploymentsLister.Deployments(namespace).Get(deploydaemon.Status.Cluster.DeploymentName)
 		if err != nil {
-			return fmt.Errorf("can not get deployment %s in namespace %s", deploydaemon.GenerateName, namespace)
-			// Here we need the to fill in the conditionSpec with Reason that the Deployment can not be get
-			// then we update the deploydaemon
+			err = fmt.Errorf("can not get deployment %s in namespace %s: %s", deploydaemon.Status.Cluster.DeploymentName, namespace, err.Error())
+			c.conditions.UpdateStatus(deploydaemon, nil)
+			c.markNotReady(deploydaemon, "DeploymentNotFound", err)
+			if updateErr := c.updateDeployDaemonStatus(original, deploydaemon); updateErr != nil {
+				klog.Errorf("update status of deploydaemon %s failed: %s", key, updateErr.Error())
+			}
+			return err
 		}
-		klog.Infof("check deployment %s status : %s", dp.Name,dp.Status)
+		klog.Infof("check deployment %s status : %v", dp.Name,dp.Status)
 	}
 
 	// Else, we need to check deployment status to update deploydaemon status
@@ -261,116 +384,423 @@ func (c *Controller ) reconcile(key string) error {
 	// 如果 deployment 不是ready的状态的话就需要把这个deploydaemon再重新加入到 workqueue中，并更新lastUpdateTime
 	// 如果 ready的状态 check 对应的Pod的 expose label是否和 deploydaemon符合，如果不符合就修改
 
-	c.syncDeployDaemon(deploydaemon,dp)
+	requeue := c.syncDeployDaemon(deploydaemon,dp)
+
+	updateErr := c.updateDeployDaemonStatus(original, deploydaemon)
 
-	updateErr := c.updateDeployDaemonStatus(deploydaemon)
+	// Wake up when the running canary step is over
+	if requeue > 0 && updateErr == nil {
+		klog.Infof("deploydaemon %s requeued in %s", key, requeue)
+		c.workqueue.AddDelayDefined(key, requeue)
+	}
 
 	klog.Infof("check deploydaemon after update: \n %s",deploydaemon)
 
-	if sycError:=c.isDone(deploydaemon.Status,updateErr); sycError !=nil {
+	if sycError:=c.isDone(deploydaemon,updateErr); sycError !=nil {
 		klog.Errorf("sync status of deploydaemon %s", deploydaemon.Name)
 		return sycError
 	}
 	return nil
 }
 
-func (c *Controller) syncDeployDaemon(deploydaemon *v1alpha1.DeployDaemon, deployment *appsv1.Deployment) {
+// fillSyncDefaults fills the replica count and the expose of a deploydaemon the admission webhook did not default, the
+// sync can not run without them. They are not written back, the other defaults of the webhook, the lower-cased names
+// and the standard labels, are left to it.
+func fillSyncDefaults(deploydaemon *v1alpha1.DeployDaemon) {
+	if deploydaemon.Spec.Replica == nil {
+		instance := v1alpha1.DefaultInstance
+		deploydaemon.Spec.Replica = &instance
+	}
+	if deploydaemon.Spec.Expose == "" {
+		deploydaemon.Spec.Expose = v1alpha1.DefaultExpose
+	}
+}
+
+// syncDeployDaemon syncs the objects of deploydaemon and returns how long to wait before the next sync, 0 when
+// only changes of the watched objects require one.
+func (c *Controller) syncDeployDaemon(deploydaemon *v1alpha1.DeployDaemon, deployment *appsv1.Deployment) time.Duration {
 	klog.Infof("sync deployDaemon status for %s: ", deploydaemon.Name)
 
 	if deployment !=nil {
 		deploydaemon.Status.Deployment = deployment.Status
+		// The scale subresource reads the replicas and the pods of the deployment of the current version
+		deploydaemon.Status.Replicas = deployment.Status.Replicas
+		if deployment.Spec.Selector != nil {
+			deploydaemon.Status.Selector = metav1.FormatLabelSelector(deployment.Spec.Selector)
+		}
+		c.conditions.UpdateStatus(deploydaemon, deployment)
+
+		// Restore the spec of a previous revision before syncing anything from it
+		if err := c.syncRollback(deploydaemon); err != nil {
+			c.markNotReady(deploydaemon, "RollbackFailed", err)
+			return 0
+		}
+
+		//0. Make sure the service shared by all versions of the component exists
+		if err := c.syncService(deploydaemon); err != nil {
+			c.markNotReady(deploydaemon, "ServiceSyncFailed", err)
+			return 0
+		}
 
 		//1. Check deployment, if necessary, need to delete old and create a new one
 		if err := c.syncDeployment(deploydaemon, deployment); err != nil {
-			c.remarkSuccessStatus(deploydaemon,false, "Waiting Deployment Ready", err.Error())
-			return
+			reason := "DeploymentSyncFailed"
+			if isWaiting(err) {
+				reason = "DeploymentProgressing"
+			}
+			// The expose plan does not wait for the deployment: the pods ready during a rollout or a scale are
+			// exposed as planned and the pods listed in offlinePods are taken offline at once
+			if exposeErr := c.syncExpose(deploydaemon); exposeErr != nil && isWaiting(err) {
+				reason, err = "ExposeSyncFailed", exposeErr
+			}
+			c.markNotReady(deploydaemon, reason, err)
+			return 0
+		}
+
+		//2. Move the canary of a new version to its current step, before exposure and traffic follow it
+		now := time.Now()
+		requeue, err := c.syncCanary(deploydaemon, now)
+		if err != nil {
+			c.markNotReady(deploydaemon, "InvalidCanaryStrategy", err)
+			return 0
+		}
+		if wait, err := c.syncBlueGreen(deploydaemon, now); err != nil {
+			c.markNotReady(deploydaemon, "BlueGreenFailed", err)
+			return 0
+		} else if wait > 0 {
+			requeue = wait
+		}
+
+		if err := c.syncTraffic(deploydaemon); err != nil {
+			c.markNotReady(deploydaemon, "TrafficSyncFailed", err)
+			return 0
 		}
 
-		//2. Check pod expose status
-		if err := c.syncPodExposeStatus(deploydaemon); err !=nil{
-			//c.remarkSuccessStatus(deploydaemon,false, "Waiting Pod Expose Sync Ready",err.Error())
-			c.remarkSuccessStatus(deploydaemon,false, "Waiting Pod Expose Sync Ready",err.Error())
-			return
+		//3. Check pod expose status
+		if err := c.syncExpose(deploydaemon); err !=nil{
+			c.markNotReady(deploydaemon, "ExposeSyncFailed", err)
+			return 0
 		}
 
-		//3. If everything ready, we can mark the DeployDaemon is ready, otherwise, mark is not ready
-		c.remarkSuccessStatus(deploydaemon,true, "All Status Synced","Deployment success!")
+		//4. If everything ready, we can mark the DeployDaemon is ready, otherwise, mark is not ready
+		if canary := rolloutCanary(deploydaemon); canary != nil && canary.Phase != canaryCompleted {
+			c.markReady(deploydaemon, "Canary"+canary.Phase,
+				fmt.Sprintf("Version %s at step %d weight %d", canary.Version, canary.CurrentStep, canary.Weight))
+			return requeue
+		}
+		if bg := rolloutBlueGreen(deploydaemon); bg != nil {
+			c.markReady(deploydaemon, "BlueGreen"+bg.Phase,
+				fmt.Sprintf("Version %s replaces version %s", bg.Version, bg.ActiveVersion))
+			return requeue
+		}
+		c.markReady(deploydaemon, "Synced", "Deployment success!")
 	}else{
-		klog.Infof("deployment %s status is nil, waiting check in next around %s: ", deployment.Name)
+		klog.Infof("deployment for %s is nil, waiting check in next around", deploydaemon.Name)
 	}
+	return 0
 }
 
 func ( c *Controller) syncDeployment(deploydaemon *v1alpha1.DeployDaemon, deployment *appsv1.Deployment) error {
 	klog.Infof("sync deployment status for %s: ", deploydaemon.Name)
 	var err error = nil
 
-	//1. Check replica / image / version change and call createDeployment
-	// delete deployment first
-	// call createDeployment method
-	// err = fmt.Errorf("Re-genereate deployment, since significant change on deployment")
+	//1. Version change, create the new <name>-<version> deployment. The old one is retired once the new one is ready
+	if deployment.Name != deploymentNameFor(deploydaemon) {
+		return c.rollDeploymentVersion(deploydaemon, deployment)
+	}
 
+	//2. Check replica / image / config / secrets change and patch the deployment in place
 	var deploymentUpdated bool = false
 
+	deployment = deployment.DeepCopy()
+
 	if *deployment.Spec.Replicas != *deploydaemon.Spec.Replica {
-		klog.Infof("deployment replica %s not sync with deploydaemon replica %s", *deployment.Spec.Replicas, *deploydaemon.Spec.Replica)
+		klog.Infof("deployment replica %d not sync with deploydaemon replica %d", *deployment.Spec.Replicas, *deploydaemon.Spec.Replica)
 		deployment.Spec.Replicas = deploydaemon.Spec.Replica
 		deploymentUpdated = true
-		c.kubeclientset.AppsV1().Deployments(deploydaemon.Namespace).Update(deployment)
-		err = fmt.Errorf("Waiting Pod Scale Ready")
+		err = waitingf("Waiting Pod Scale Ready")
+	}
+
+	podTemplate, templateErr := c.makePodTemplate(deploydaemon)
+	if templateErr != nil {
+		return templateErr
+	}
+
+	hash, hashErr := specHash(&podTemplate)
+	if hashErr != nil {
+		return hashErr
+	}
+
+	recordRevision(deploydaemon, deployment.Name, hash, time.Now())
+
+	// A template edited by hand keeps the spec hash, compare it with the template recorded once the API server
+	// defaulted the rendered one
+	live, liveErr := specHash(&deployment.Spec.Template)
+	if liveErr != nil {
+		return liveErr
+	}
+	recorded, hasRecorded := deployment.Annotations[templateHashAnnotation]
+	drifted := deployment.Annotations[specHashAnnotation] == hash && hasRecorded && recorded != live
+	if drifted {
+		klog.Infof("deployment %s pod template was edited, revert it to the deploydaemon spec", deployment.Name)
+		c.recorder.Eventf(deploydaemon, corev1.EventTypeWarning, "DeploymentEdited", "Reverted manual edit of deployment %s", deployment.Name)
+	}
+
+	if deployment.Annotations[specHashAnnotation] != hash || drifted {
+		klog.Infof("deployment %s spec hash %s not sync with deploydaemon spec hash %s", deployment.Name, deployment.Annotations[specHashAnnotation], hash)
+		if deployment.Annotations == nil {
+			deployment.Annotations = map[string]string{}
+		}
+		deployment.Annotations[specHashAnnotation] = hash
+		delete(deployment.Annotations, templateHashAnnotation)
+		// Keep the pod labels, expose is synced on the pods directly and must not trigger a rollout
+		podTemplate.Labels = deployment.Spec.Template.Labels
+		deployment.Spec.Template = podTemplate
+		deploymentUpdated = true
+		err = waitingf("Waiting Pod Template Rollout Ready")
+	} else if !hasRecorded {
+		// The template is the rendered one as the API server defaulted it, record it to detect later edits
+		deployment.Annotations[templateHashAnnotation] = live
+		deploymentUpdated = true
 	}
 
-	//2. Check deployment ready
-	if ! deploymentUpdated {
-		if deployment.Status.AvailableReplicas != deployment.Status.ReadyReplicas {
-			err = fmt.Errorf("Waiting Pod Status Ready")
+	if deploymentUpdated {
+		if _, updateErr := c.kubeclientset.AppsV1().Deployments(deploydaemon.Namespace).Update(deployment); updateErr != nil {
+			return fmt.Errorf("update deployment %s failed: %s", deployment.Name, updateErr.Error())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	//3. Check deployment ready
+	markRevision(deploydaemon, deployment, time.Now())
+	if deployment.Status.AvailableReplicas != deployment.Status.ReadyReplicas || !isDeploymentReady(deployment) {
+		return waitingf("Waiting Pod Status Ready")
+	}
+
+	//4. Retire the deployment of the replaced version once the current one is ready and its rollout is completed
+	if canary := rolloutCanary(deploydaemon); canary != nil && canary.Phase != canaryCompleted {
+		return err
+	}
+	if bg := rolloutBlueGreen(deploydaemon); bg != nil {
+		return err
+	}
+	if deploydaemon.Status.Cluster.PreviousDeploymentName != "" {
+		if err := c.retireDeployment(deploydaemon); err != nil {
+			return err
 		}
 	}
 
 	return err
 }
 
+// rollDeploymentVersion creates the deployment for the new version of deploydaemon and remembers the
+// current deployment so that it can be retired when the new version is ready.
+func (c *Controller) rollDeploymentVersion(deploydaemon *v1alpha1.DeployDaemon, deployment *appsv1.Deployment) error {
+	newName := deploymentNameFor(deploydaemon)
+	klog.Infof("deploydaemon %s version changed, roll deployment %s to %s", deploydaemon.Name, deployment.Name, newName)
+
+	if _, err := c.deploymentsLister.Deployments(deploydaemon.Namespace).Get(newName); err == nil {
+		deploydaemon.Status.Cluster.DeploymentName = newName
+	} else if !errors.IsNotFound(err) {
+		return err
+	} else if _, err := c.createDeployent(deploydaemon); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("create deployment %s failed: %s", newName, err.Error())
+	}
 
+	deploydaemon.Status.Cluster.PreviousDeploymentName = deployment.Name
+	startCanary(deploydaemon, deployment.Labels["version"])
+	startBlueGreen(deploydaemon, deployment.Labels["version"])
+
+	return waitingf("Waiting Deployment %s Ready", newName)
+}
+
+// retireDeployment scales the deployment of the replaced version recorded in deploydaemon status down to zero, so that
+// a rollback to it only has to scale it up again. It is deleted at once when revisionHistoryLimit is 0, otherwise
+// the oldest retired deployments beyond revisionHistoryLimit are pruned.
+func (c *Controller) retireDeployment(deploydaemon *v1alpha1.DeployDaemon) error {
+	previous := deploydaemon.Status.Cluster.PreviousDeploymentName
+	klog.Infof("retire deployment %s replaced by %s", previous, deploydaemon.Status.Cluster.DeploymentName)
+
+	if revisionHistoryLimit(deploydaemon) == 0 {
+		err := c.kubeclientset.AppsV1().Deployments(deploydaemon.Namespace).Delete(previous, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("retire deployment %s failed: %s", previous, err.Error())
+		}
+	} else if deployment, err := c.deploymentsLister.Deployments(deploydaemon.Namespace).Get(previous); err == nil {
+		if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != 0 {
+			deployment = deployment.DeepCopy()
+			zero := int32(0)
+			deployment.Spec.Replicas = &zero
+			if _, err := c.kubeclientset.AppsV1().Deployments(deploydaemon.Namespace).Update(deployment); err != nil {
+				return fmt.Errorf("retire deployment %s failed: %s", previous, err.Error())
+			}
+		}
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	deploydaemon.Status.Cluster.PreviousDeploymentName = ""
+	return c.pruneDeployments(deploydaemon)
+}
+
+// isDeploymentReady returns true when the latest generation of the deployment is rolled out and all replicas are available.
+func isDeploymentReady(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+// deploymentNameFor returns the name of the deployment that runs the current version of deploydaemon.
+func deploymentNameFor(deploydaemon *v1alpha1.DeployDaemon) string {
+	return deploydaemon.GetDeploymentName() + "-" + deploydaemon.Spec.Version
+}
+
+// specHash hashes the pod template rendered from the deploydaemon spec and its pod template.
+// Pod labels are left out since Expose is synced on the pods directly and Version is part of the deployment name.
+func specHash(podTemplate *corev1.PodTemplateSpec) (string, error) {
+	return utils.ComputeHash(struct {
+		Annotations map[string]string
+		Spec        corev1.PodSpec
+	}{
+		Annotations: podTemplate.Annotations,
+		Spec:        podTemplate.Spec,
+	})
+}
+
+
+// syncPodExposeStatus syncs the expose label of the pods of the current version of deploydaemon and, during a rollout,
+// of the previous version:
+//  - a canary without traffic provider exposes weight percent of the canary pods and the rest of the previous ones
+//  - a blue/green preview is offline while the previous version follows the spec, once promoted both flip at once
+// The current version is synced first so that the component is never left without online pods.
 func ( c *Controller) syncPodExposeStatus(deploydaemon *v1alpha1.DeployDaemon) error {
 
 	klog.Infof("Sync PodExposeStatus for deploydaemon: %s", deploydaemon.Name)
 
+	percent := deploydaemon.Spec.ExposePercent
+	offline := int32(0)
+
+	var previousVersion string
+	var previousPercent *int32
+
+	if canary := rolloutCanary(deploydaemon); canary != nil && c.traffic == nil {
+		percent = canaryExposePercent(deploydaemon, canary)
+		stablePercent := 100 - canary.Weight
+		previousVersion, previousPercent = canary.StableVersion, &stablePercent
+	}
+
+	if bg := rolloutBlueGreen(deploydaemon); bg != nil {
+		previousVersion = bg.ActiveVersion
+		if bg.Phase == blueGreenPreview {
+			percent, previousPercent = &offline, deploydaemon.Spec.ExposePercent
+		} else {
+			previousPercent = &offline
+		}
+	}
+
+	exposeStatus, err := c.syncPodExpose(deploydaemon, deploydaemon.Spec.Version, percent)
+	if err != nil {
+		return err
+	}
+	deploydaemon.Status.Expose = exposeStatus
+
+	if previousVersion != "" {
+		_, err = c.syncPodExpose(deploydaemon, previousVersion, previousPercent)
+	}
+
+	return err
+}
+
+// syncExpose syncs the expose labels of the pods of deploydaemon and records the outcome in the ExposeSynced condition
+func (c *Controller) syncExpose(deploydaemon *v1alpha1.DeployDaemon) error {
+	if err := c.syncPodExposeStatus(deploydaemon); err != nil {
+		c.conditions.SetCondition(deploydaemon, v1alpha1.ExposeSynced, corev1.ConditionFalse, "ExposeSyncFailed", err.Error())
+		return err
+	}
+	c.conditions.SetCondition(deploydaemon, v1alpha1.ExposeSynced, corev1.ConditionTrue, "ExposeSynced", "Pod expose labels match the spec")
+	return nil
+}
+
+// syncPodExpose labels the pods of one version of deploydaemon as planned by planPodExpose
+func ( c *Controller) syncPodExpose(deploydaemon *v1alpha1.DeployDaemon, version string, percent *int32) (*v1alpha1.ExposeStatus, error) {
+
 	selector := labels.SelectorFromSet(map[string]string{
 		"app": deploydaemon.GetDeploymentName(),
-		"version": deploydaemon.Spec.Version,
+		"version": version,
 	})
 
 	podlist, err:= c.podslister.Pods(deploydaemon.Namespace).List(selector)
 
-	completeSync := true
-
 	if err !=nil {
 		klog.Errorf("list pod for deployment %s with version failed", deploydaemon.GetDeploymentName())
-		return err
+		return nil, err
+	}
+
+	exposes, exposeStatus, err := planPodExpose(deploydaemon, podlist, percent)
+	if err != nil {
+		return nil, err
 	}
+
 	for _, pod := range podlist  {
 
-		if pod.Labels["expose"] != deploydaemon.Spec.Expose {
-			klog.Infof("Sync Pod %s Expose To %s Caused By DeployDaemon %s Expose Change ", pod.Name,deploydaemon.Spec.Expose,deploydaemon.Name )
-			pod.Labels["expose"]=deploydaemon.Spec.Expose
-			_, err =c.kubeclientset.CoreV1().Pods(deploydaemon.Namespace).Update(pod)
-			if err !=nil {
-				klog.Errorf("Sync Pod %s Expose To %s Failed", pod.Name, deploydaemon.Spec.Expose)
+		expose := exposes[pod.Name]
+		if pod.Labels[exposeLabel] != expose {
+			klog.Infof("Sync Pod %s Expose To %s Caused By DeployDaemon %s Expose Change ", pod.Name,expose,deploydaemon.Name )
+			pod = pod.DeepCopy()
+			if pod.Labels == nil {
+				pod.Labels = map[string]string{}
+			}
+			pod.Labels[exposeLabel]=expose
+			if _, updateErr :=c.kubeclientset.CoreV1().Pods(deploydaemon.Namespace).Update(pod); updateErr !=nil {
+				klog.Errorf("Sync Pod %s Expose To %s Failed", pod.Name, expose)
+				err = updateErr
 			}
 		}
 	}
 
-	if ! completeSync {
+	return exposeStatus, err
+}
 
+// markNotReady records that the sync of deploydaemon stopped with err. The deploydaemon is degraded unless err
+// only waits for the cluster to converge.
+func (c *Controller) markNotReady(deploydaemon *v1alpha1.DeployDaemon, reason string, err error) {
+	c.conditions.SetCondition(deploydaemon, v1alpha1.Ready, corev1.ConditionFalse, reason, err.Error())
+	if isWaiting(err) {
+		c.conditions.SetCondition(deploydaemon, v1alpha1.Degraded, corev1.ConditionFalse, reason, err.Error())
+	} else {
+		c.conditions.SetCondition(deploydaemon, v1alpha1.Degraded, corev1.ConditionTrue, reason, err.Error())
 	}
+}
 
-	return err
+// markReady records that everything the spec of deploydaemon asks for is synced
+func (c *Controller) markReady(deploydaemon *v1alpha1.DeployDaemon, reason, message string) {
+	c.conditions.SetCondition(deploydaemon, v1alpha1.Ready, corev1.ConditionTrue, reason, message)
+	c.conditions.SetCondition(deploydaemon, v1alpha1.Degraded, corev1.ConditionFalse, reason, message)
 }
 
-func (c *Controller) remarkSuccessStatus(deploydaemon *v1alpha1.DeployDaemon, status bool, reason, message string) {
+// waitError is returned by a sync step that waits for the cluster to converge, as opposed to a failure
+type waitError struct {
+	message string
+}
 
-	deploydaemon.Status.Conditions.Status = status
-	deploydaemon.Status.Conditions.Reason = reason
-	deploydaemon.Status.Conditions.Message = message
+func (e *waitError) Error() string {
+	return e.message
+}
+
+func waitingf(format string, args ...interface{}) error {
+	return &waitError{message: fmt.Sprintf(format, args...)}
+}
+
+func isWaiting(err error) bool {
+	_, ok := err.(*waitError)
+	return ok
 }
 
 
@@ -382,38 +812,68 @@ func ( c *Controller) enqueueDeployDaemon(obj interface{}){
 		return
 	}
 
-	//check if the scheduler exist, if yes, add to AddDelayDefined(item interface{})
-	// Convert the namespace/name string into a distinct namespace and name
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		klog.Errorf("invalid resource key: %s", key)
-	}
+	// The scheduler is handled in reconcile, which persists the scheduled time in status and
+	// re-adds the deploydaemon with AddDelayDefined, so resync and restart never move the schedule.
+	// Watch events are not failures, only a failed reconcile backs the deploydaemon off with AddRateLimited.
+	c.workqueue.Add(key)
+}
 
-	deploydaemon, err:=c.deploydaemonLister.DeployDaemons(namespace).Get(name)
-	if err != nil {
-		klog.Errorf("get crd object %s failed", key)
-	}
+// updateDeployDaemonStatus writes the status of deploydaemon through the status subresource, skipping the write when
+// it is the status of original, the object read from the lister. The spec is never written back, the sync only changes
+// the metadata to consume the promote and abort annotations and to add or remove the drain finalizer, those are
+// patched first.
+func ( c *Controller ) updateDeployDaemonStatus(original, deploydaemon *v1alpha1.DeployDaemon) error {
+	client := c.extclientset.DeploycontrolV1alpha1().DeployDaemons(deploydaemon.Namespace)
 
-	if deploydaemon.Spec.Scheduler != "" {
-		klog.Infof("get deploydaemon duration %s", deploydaemon.Spec.Scheduler )
+	// The spec of the sync may be the one of a rollback, only the status of the sync is written
+	updated := original.DeepCopy()
+	updated.Status = deploydaemon.Status
 
-		durationT,err := time.ParseDuration(deploydaemon.Spec.Scheduler)
-		if err !=nil {
-			klog.Errorf("Parse deploydaemon duration failed!")
+	if !equality.Semantic.DeepEqual(original.Annotations, deploydaemon.Annotations) || !equality.Semantic.DeepEqual(original.Finalizers, deploydaemon.Finalizers) {
+		patch, err := metadataPatch(original.ResourceVersion, deploydaemon.Annotations, deploydaemon.Finalizers)
+		if err != nil {
+			return err
+		}
+		patched, err := client.Patch(deploydaemon.Name, types.JSONPatchType, patch)
+		if err != nil {
+			return err
+		}
+		// Without finalizers a deleted deploydaemon is gone, there is no status left to write
+		if patched.DeletionTimestamp != nil && len(patched.Finalizers) == 0 {
+			return nil
 		}
-		klog.Infof("deploydaemon duration is %s ", durationT.String())
-		c.workqueue.AddDelayDefined(key,durationT)
+		patched.Status = deploydaemon.Status
+		updated = patched
+	}
 
-	}else {
-		c.workqueue.AddRateLimited(key)
+	if updated.Status == nil {
+		updated.Status = &v1alpha1.DeploydaemonStatus{}
 	}
-}
+	updated.Status.ObservedGeneration = updated.Generation
 
-func ( c *Controller ) updateDeployDaemonStatus(deploydaemon *v1alpha1.DeployDaemon) error {
-	_, err := c.extclientset.DeploycontrolV1alpha1().DeployDaemons(deploydaemon.Namespace).Update(deploydaemon)
+	if equality.Semantic.DeepEqual(original.Status, updated.Status) {
+		return nil
+	}
+	_, err := client.UpdateStatus(updated)
 	return err
 }
 
+// metadataPatch returns a JSON patch setting the annotations and the finalizers of a deploydaemon. It fails with a
+// conflict when the deploydaemon is no longer at resourceVersion.
+func metadataPatch(resourceVersion string, annotations map[string]string, finalizers []string) ([]byte, error) {
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	if finalizers == nil {
+		finalizers = []string{}
+	}
+	return json.Marshal([]map[string]interface{}{
+		{"op": "replace", "path": "/metadata/resourceVersion", "value": resourceVersion},
+		{"op": "add", "path": "/metadata/annotations", "value": annotations},
+		{"op": "add", "path": "/metadata/finalizers", "value": finalizers},
+	})
+}
+
 //func ( c *Controller ) updateDeployDaemonStatus(deploydaemon *v1alpha1.DeployDaemon, deployment *appsv1.Deployment) error {
 //
 //	klog.Infof("updateDeployDaemonStatus for deploydaemon %s: ", deploydaemon.Name)
@@ -481,26 +941,42 @@ func ( c *Controller ) createDeployent(deploydaemon *v1alpha1.DeployDaemon) (*ap
 	klog.Infof("deployment template is %s: ", dp)
 	if err !=nil {
 		klog.Errorf("Faile to create deployment: %s", err.Error())
+		return nil, err
 	}
 
-	klog.Infof("create deployment %s for deploydaemon %s: ", deploydaemon.GetDeploymentName()+"-"+deploydaemon.Spec.Version,deploydaemon.Name)
+	klog.Infof("create deployment %s for deploydaemon %s: ", deploymentNameFor(deploydaemon),deploydaemon.Name)
+
+	c.conditions.SetCondition(deploydaemon, v1alpha1.Ready, corev1.ConditionFalse, "DeploymentProgressing", "Waiting deployment ready")
 
-	deploydaemon.Status.Conditions = v1alpha1.ConditionsSpec{
-		Type: "Successful",
-		Status: false,
-		Reason: "Waiting deployment ready",
-		Message: "Waiting deployment ready",
+	created, err := c.kubeclientset.AppsV1().Deployments(deploydaemon.ObjectMeta.Namespace).Create(dp)
+	if errors.IsAlreadyExists(err) {
+		// The status recording a deployment created by a previous sync may have failed to be written
+		existing, getErr := c.kubeclientset.AppsV1().Deployments(deploydaemon.Namespace).Get(dp.Name, metav1.GetOptions{})
+		if getErr == nil && metav1.IsControlledBy(existing, deploydaemon) {
+			created, err = existing, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	// The deployment is only recorded once it exists, a failed create is retried by the next sync
+	if deploydaemon.Status == nil {
+		deploydaemon.Status = &v1alpha1.DeploydaemonStatus{}
+	}
+	if deploydaemon.Status.Cluster == nil {
+		deploydaemon.Status.Cluster = &v1alpha1.ClusterSpec{}
 	}
+	deploydaemon.Status.Cluster.Name = deploydaemon.Name
+	deploydaemon.Status.Cluster.NameSpace = deploydaemon.Namespace
+	deploydaemon.Status.Cluster.DeploymentName = created.Name
 
-	return c.kubeclientset.AppsV1().Deployments(deploydaemon.ObjectMeta.Namespace).Create(dp)
+	return created, nil
 }
 
 func (c *Controller ) makeDeployment(deploydaemon *v1alpha1.DeployDaemon) (*appsv1.Deployment, error){
 	klog.Infof("make deployment for deploydaemon: %s", deploydaemon.Name)
 
-	// Here need to update deploydaemon status.cluster to store the deployment name
-
 	//// Generate a short random hex string.
 	//b, err := ioutil.ReadAll(io.LimitReader(randReader, 3))
 	//if err != nil {
@@ -508,15 +984,17 @@ func (c *Controller ) makeDeployment(deploydaemon *v1alpha1.DeployDaemon) (*apps
 	//}
 	//gibberish := hex.EncodeToString(b)
 
-	deploydaemon.Status = &v1alpha1.DeploydaemonStatus{
-		Cluster: &v1alpha1.ClusterSpec{
-                Name: deploydaemon.Name,
-                NameSpace: deploydaemon.Namespace,
-                DeploymentName: deploydaemon.GetDeploymentName()+"-"+deploydaemon.Spec.Version,
-		},
+	klog.Infof("new deployment name is : %s", deploymentNameFor(deploydaemon))
+
+	podTemplate, err := c.makePodTemplate(deploydaemon)
+	if err != nil {
+		return nil, err
 	}
 
-	klog.Infof("new deployment name is : %s", deploydaemon.Status.Cluster.DeploymentName)
+	hash, err := specHash(&podTemplate)
+	if err != nil {
+		return nil, err
+	}
 
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -527,7 +1005,7 @@ func (c *Controller ) makeDeployment(deploydaemon *v1alpha1.DeployDaemon) (*apps
 					// Add a unique suffix to avoid confusion when a build
 					// is deleted and re-created with the same name.
 					// We don't use GenerateName here because k8s fakes don't support it.
-					Name: deploydaemon.Status.Cluster.DeploymentName,
+					Name: deploymentNameFor(deploydaemon),
 					// If our parent Build is deleted, then we should be as well.
 					OwnerReferences: []metav1.OwnerReference{
 						*metav1.NewControllerRef(deploydaemon, schema.GroupVersionKind{
@@ -540,6 +1018,9 @@ func (c *Controller ) makeDeployment(deploydaemon *v1alpha1.DeployDaemon) (*apps
 						"app": deploydaemon.GetDeploymentName(),
 						"version": deploydaemon.Spec.Version,
 					},
+					Annotations: map[string]string{
+						specHashAnnotation: hash,
+					},
 				},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: deploydaemon.Spec.Replica,
@@ -549,31 +1030,90 @@ func (c *Controller ) makeDeployment(deploydaemon *v1alpha1.DeployDaemon) (*apps
 					"version": deploydaemon.Spec.Version,
 				},
 			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app": deploydaemon.GetDeploymentName(),
-						"version": deploydaemon.Spec.Version,
-						"expose": deploydaemon.Spec.Expose,
-					},
+			Template: podTemplate,
+		},
+	},nil
+}
+
+// makePodTemplate renders the pod template of the deployment. The application container is always rendered
+// from the deploydaemon spec, the pod template referenced by templateRef supplies the rest of the pod shape.
+func (c *Controller) makePodTemplate(deploydaemon *v1alpha1.DeployDaemon) (corev1.PodTemplateSpec, error) {
+
+	podTemplate := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				"app": deploydaemon.GetDeploymentName(),
+				"version": deploydaemon.Spec.Version,
+				// New pods start offline, syncPodExposeStatus exposes them as the spec, the canary or the
+				// blue/green promotion allow
+				"expose": exposeOffline,
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				makeContainer(deploydaemon),
+			},
+		},
+	}
+
+	if deploydaemon.Spec.TemplateRef == "" {
+		return podTemplate, nil
+	}
+
+	raw, err := c.templates.Get(deploydaemon.Namespace, deploydaemon.Spec.TemplateRef)
+	if err != nil {
+		return podTemplate, fmt.Errorf("get pod template %s failed: %s", deploydaemon.Spec.TemplateRef, err.Error())
+	}
+
+	tpl, err := templates.Render(deploydaemon.Spec.TemplateRef, raw, templates.ValuesFor(deploydaemon))
+	if err != nil {
+		return podTemplate, err
+	}
+
+	templates.Apply(tpl, &podTemplate, deploydaemon.Spec.Component)
+
+	return podTemplate, nil
+}
+
+// makeContainer renders the application container of the deployment from the deploydaemon spec.
+// The ConfigMap referenced by configRef is injected as environment through envFrom, and every
+// secretRef is mapped to an env var named paramName, read from the key of the same name in secretName.
+func makeContainer(deploydaemon *v1alpha1.DeployDaemon) corev1.Container {
+
+	container := corev1.Container{
+		Name:  deploydaemon.Spec.Component,
+		Image: deploydaemon.Spec.Image,
+	}
+
+	if deploydaemon.Spec.Config != "" {
+		container.EnvFrom = []corev1.EnvFromSource{
+			{
+				ConfigMapRef: &corev1.ConfigMapEnvSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: deploydaemon.Spec.Config},
 				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:  "nginx",
-							Image: "nginx:latest",
-						},
-					},
+			},
+		}
+	}
+
+	for _, secret := range deploydaemon.Spec.Secrets {
+		container.Env = append(container.Env, corev1.EnvVar{
+			Name: secret.Name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secret.Secret},
+					Key:                  secret.Name,
 				},
 			},
-		},
-	},nil
+		})
+	}
+
+	return container
 }
 
-func ( c *Controller ) isDone(status *v1alpha1.DeploydaemonStatus, err error) error {
+func ( c *Controller ) isDone(deploydaemon *v1alpha1.DeployDaemon, err error) error {
 	// judge is deploydaemon is done
 
-	if status == nil || status.Conditions.Status == false || err !=nil {
+	if !c.conditions.IsTrue(deploydaemon, v1alpha1.Ready) || err !=nil {
 		return fmt.Errorf("Sync is ongoing!")
 	}
 	return nil
@@ -0,0 +1,626 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned/fake"
+	extInformers "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/informers/externalversions"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/templates"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var noResyncPeriodFunc = func() time.Duration { return 0 }
+
+type fixture struct {
+	t *testing.T
+
+	kubeclient *k8sfake.Clientset
+	extclient  *fake.Clientset
+
+	kubeInformers kubeinformers.SharedInformerFactory
+	extInformers  extInformers.SharedInformerFactory
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{t: t}
+	f.kubeclient = k8sfake.NewSimpleClientset()
+	f.extclient = fake.NewSimpleClientset()
+	f.kubeInformers = kubeinformers.NewSharedInformerFactory(f.kubeclient, noResyncPeriodFunc())
+	f.extInformers = extInformers.NewSharedInformerFactory(f.extclient, noResyncPeriodFunc())
+	return f
+}
+
+func (f *fixture) newController() *Controller {
+	return NewController(f.kubeclient, f.extclient,
+		f.kubeInformers.Apps().V1().Deployments(),
+		f.kubeInformers.Core().V1().Pods(),
+		f.kubeInformers.Core().V1().ConfigMaps(),
+		f.kubeInformers.Core().V1().Services(),
+		f.extInformers.Deploycontrol().V1alpha1().DeployDaemons(),
+		nil,
+		workqueue.DefaultControllerRateLimiter())
+}
+
+func newDeployDaemon(name string, replicas int32) *v1alpha1.DeployDaemon {
+	return &v1alpha1.DeployDaemon{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: "DeployDaemon"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: metav1.NamespaceDefault,
+		},
+		Spec: v1alpha1.DeploydaemonSpec{
+			Tenant:      "demo",
+			Environment: "qa",
+			EnvType:     "auth",
+			Component:   "ts-app",
+			Image:       "registry.example.com/ts-app:9.0.1.2",
+			Version:     "9.0.1.2",
+			Config:      "demoqaauth",
+			Secrets: []v1alpha1.SecretsRef{
+				{Name: "VAULT_TOKEN", Secret: "demoqaauth-vaulttoken"},
+				{Name: "DB_PASSWORD", Secret: "demoqaauth-db"},
+			},
+			Expose:  "online",
+			Replica: &replicas,
+		},
+	}
+}
+
+func TestMakeDeploymentUsesSpecImage(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newDeployDaemon("test", 2)
+
+	dp, err := c.makeDeployment(dd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if dp.Name != "demoqaauth-ts-app-9.0.1.2" {
+		t.Errorf("expected deployment name demoqaauth-ts-app-9.0.1.2, got %s", dp.Name)
+	}
+	if *dp.Spec.Replicas != 2 {
+		t.Errorf("expected 2 replicas, got %d", *dp.Spec.Replicas)
+	}
+
+	containers := dp.Spec.Template.Spec.Containers
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(containers))
+	}
+	if containers[0].Name != "ts-app" {
+		t.Errorf("expected container name ts-app, got %s", containers[0].Name)
+	}
+	if containers[0].Image != dd.Spec.Image {
+		t.Errorf("expected image %s, got %s", dd.Spec.Image, containers[0].Image)
+	}
+}
+
+func TestMakeDeploymentInjectsConfigAndSecrets(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newDeployDaemon("test", 1)
+
+	dp, err := c.makeDeployment(dd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	container := dp.Spec.Template.Spec.Containers[0]
+
+	if len(container.EnvFrom) != 1 || container.EnvFrom[0].ConfigMapRef == nil {
+		t.Fatalf("expected a single configmap envFrom, got %v", container.EnvFrom)
+	}
+	if container.EnvFrom[0].ConfigMapRef.Name != "demoqaauth" {
+		t.Errorf("expected configmap demoqaauth, got %s", container.EnvFrom[0].ConfigMapRef.Name)
+	}
+
+	if len(container.Env) != len(dd.Spec.Secrets) {
+		t.Fatalf("expected %d env vars, got %d", len(dd.Spec.Secrets), len(container.Env))
+	}
+	for i, secret := range dd.Spec.Secrets {
+		env := container.Env[i]
+		if env.Name != secret.Name {
+			t.Errorf("expected env %s, got %s", secret.Name, env.Name)
+		}
+		if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil {
+			t.Fatalf("expected env %s to be sourced from a secret", env.Name)
+		}
+		if env.ValueFrom.SecretKeyRef.Name != secret.Secret || env.ValueFrom.SecretKeyRef.Key != secret.Name {
+			t.Errorf("expected env %s from %s/%s, got %s/%s", env.Name, secret.Secret, secret.Name,
+				env.ValueFrom.SecretKeyRef.Name, env.ValueFrom.SecretKeyRef.Key)
+		}
+	}
+}
+
+func TestMakeDeploymentWithoutConfigAndSecrets(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.Config = ""
+	dd.Spec.Secrets = nil
+
+	dp, err := c.makeDeployment(dd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	container := dp.Spec.Template.Spec.Containers[0]
+
+	if container.EnvFrom != nil || container.Env != nil {
+		t.Errorf("expected no env injected, got envFrom %v env %v", container.EnvFrom, container.Env)
+	}
+}
+
+func TestCreateDeploymentFromSpec(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+
+	if _, err := c.createDeployent(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dp, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(dd.Status.Cluster.DeploymentName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected deployment to be created: %v", err)
+	}
+	if dp.Spec.Template.Spec.Containers[0].Image != dd.Spec.Image {
+		t.Errorf("expected image %s, got %s", dd.Spec.Image, dp.Spec.Template.Spec.Containers[0].Image)
+	}
+	if len(dp.OwnerReferences) != 1 || dp.OwnerReferences[0].Kind != "DeployDaemon" {
+		t.Errorf("expected deployment to be owned by the deploydaemon, got %v", dp.OwnerReferences)
+	}
+}
+
+// newSyncedDeployment creates the deployment of dd through the controller and registers it in the
+// informer cache, reporting every replica as rolled out and available.
+func (f *fixture) newSyncedDeployment(c *Controller, dd *v1alpha1.DeployDaemon) *appsv1.Deployment {
+	dp, err := c.createDeployent(dd)
+	if err != nil {
+		f.t.Fatalf("unexpected error: %v", err)
+	}
+	// The template the operator rendered, recorded once the API server stored it
+	dp.Annotations[templateHashAnnotation], _ = specHash(&dp.Spec.Template)
+	dp.Status = appsv1.DeploymentStatus{
+		Replicas:          *dp.Spec.Replicas,
+		UpdatedReplicas:   *dp.Spec.Replicas,
+		ReadyReplicas:     *dp.Spec.Replicas,
+		AvailableReplicas: *dp.Spec.Replicas,
+	}
+	f.kubeInformers.Apps().V1().Deployments().Informer().GetIndexer().Add(dp)
+	return dp
+}
+
+func TestSyncDeploymentInSync(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	dp := f.newSyncedDeployment(c, dd)
+
+	if err := c.syncDeployment(dd, dp); err != nil {
+		t.Fatalf("expected deployment in sync, got %v", err)
+	}
+	for _, action := range f.kubeclient.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("unexpected update of in sync deployment")
+		}
+	}
+}
+
+func TestSyncDeploymentPatchesTemplateDrift(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	dp := f.newSyncedDeployment(c, dd)
+
+	dd.Spec.Image = "registry.example.com/ts-app:9.0.1.2-hotfix"
+	dd.Spec.Secrets = dd.Spec.Secrets[:1]
+
+	if err := c.syncDeployment(dd, dp); err == nil {
+		t.Fatalf("expected sync to wait for template rollout")
+	}
+
+	updated, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(dp.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	container := updated.Spec.Template.Spec.Containers[0]
+	if container.Image != dd.Spec.Image {
+		t.Errorf("expected image %s, got %s", dd.Spec.Image, container.Image)
+	}
+	if len(container.Env) != 1 {
+		t.Errorf("expected 1 env var, got %d", len(container.Env))
+	}
+	podTemplate, _ := c.makePodTemplate(dd)
+	hash, _ := specHash(&podTemplate)
+	if updated.Annotations[specHashAnnotation] != hash {
+		t.Errorf("expected spec hash %s, got %s", hash, updated.Annotations[specHashAnnotation])
+	}
+	if dp.Spec.Template.Spec.Containers[0].Image == dd.Spec.Image {
+		t.Errorf("cached deployment must not be mutated")
+	}
+}
+
+func TestSyncDeployDaemonPropagatesScale(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 2)
+	dp := f.newSyncedDeployment(c, dd)
+
+	// kubectl scale and HorizontalPodAutoscalers write the replica count of the spec through the scale subresource
+	replicas := int32(5)
+	dd.Spec.Replica = &replicas
+	c.syncDeployDaemon(dd, dp)
+
+	updated, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(dp.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *updated.Spec.Replicas != 5 {
+		t.Errorf("expected the deployment to be scaled to 5 replicas, got %d", *updated.Spec.Replicas)
+	}
+	if dd.Status.Replicas != 2 {
+		t.Errorf("expected the status to report the 2 replicas of the deployment, got %d", dd.Status.Replicas)
+	}
+	if selector := "app=" + dd.GetDeploymentName() + ",version=9.0.1.2"; dd.Status.Selector != selector {
+		t.Errorf("expected selector %s, got %s", selector, dd.Status.Selector)
+	}
+}
+
+func TestSyncDeploymentRollsNewVersion(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	old := f.newSyncedDeployment(c, dd)
+
+	dd.Spec.Version = "9.0.1.3"
+
+	if err := c.syncDeployment(dd, old); err == nil {
+		t.Fatalf("expected sync to wait for new version deployment")
+	}
+	if dd.Status.Cluster.DeploymentName != "demoqaauth-ts-app-9.0.1.3" {
+		t.Errorf("expected status to track new deployment, got %s", dd.Status.Cluster.DeploymentName)
+	}
+	if dd.Status.Cluster.PreviousDeploymentName != old.Name {
+		t.Errorf("expected previous deployment %s, got %s", old.Name, dd.Status.Cluster.PreviousDeploymentName)
+	}
+	if _, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get("demoqaauth-ts-app-9.0.1.3", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected new version deployment to be created: %v", err)
+	}
+	if _, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(old.Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected old version deployment to be kept until new version ready: %v", err)
+	}
+}
+
+func TestSyncDeploymentRetiresPreviousVersion(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	old := f.newSyncedDeployment(c, dd)
+
+	dd.Spec.Version = "9.0.1.3"
+	current := f.newSyncedDeployment(c, dd)
+	dd.Status.Cluster.PreviousDeploymentName = old.Name
+
+	if err := c.syncDeployment(dd, current); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dd.Status.Cluster.PreviousDeploymentName != "" {
+		t.Errorf("expected previous deployment to be cleared, got %s", dd.Status.Cluster.PreviousDeploymentName)
+	}
+	retired, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(old.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected old version deployment to be kept for rollback: %v", err)
+	}
+	if *retired.Spec.Replicas != 0 {
+		t.Errorf("expected old version deployment to be scaled down, got %d replicas", *retired.Spec.Replicas)
+	}
+}
+
+func TestSyncDeploymentDeletesPreviousVersionWithoutHistory(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	limit := int32(0)
+	dd.Spec.RevisionHistoryLimit = &limit
+	old := f.newSyncedDeployment(c, dd)
+
+	dd.Spec.Version = "9.0.1.3"
+	current := f.newSyncedDeployment(c, dd)
+	dd.Status.Cluster.PreviousDeploymentName = old.Name
+
+	if err := c.syncDeployment(dd, current); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(old.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected old version deployment to be deleted, got %v", err)
+	}
+}
+
+func TestMakeDeploymentAppliesPodTemplate(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.TemplateRef = "ts-app-template"
+
+	f.kubeInformers.Core().V1().ConfigMaps().Informer().GetIndexer().Add(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ts-app-template", Namespace: dd.Namespace},
+		Data: map[string]string{
+			templates.TemplateKey: `
+metadata:
+  annotations:
+    deploycontrol.k8s.io/tenant: "{{ .Tenant }}"
+spec:
+  containers:
+  - name: ts-app
+    readinessProbe:
+      tcpSocket:
+        port: 8080
+`,
+		},
+	})
+
+	dp, err := c.makeDeployment(dd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dp.Spec.Template.Annotations["deploycontrol.k8s.io/tenant"] != "demo" {
+		t.Errorf("expected tenant annotation demo, got %v", dp.Spec.Template.Annotations)
+	}
+	if dp.Spec.Template.Spec.Containers[0].ReadinessProbe == nil {
+		t.Errorf("expected readiness probe from pod template")
+	}
+	if dp.Spec.Template.Spec.Containers[0].Image != dd.Spec.Image {
+		t.Errorf("expected image %s, got %s", dd.Spec.Image, dp.Spec.Template.Spec.Containers[0].Image)
+	}
+}
+
+func TestMakeDeploymentMissingPodTemplate(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.TemplateRef = "missing"
+
+	if _, err := c.makeDeployment(dd); err == nil {
+		t.Errorf("expected error for missing pod template")
+	}
+}
+
+func TestReconcileSetsConditions(t *testing.T) {
+	f := newFixture(t)
+	dd := newDeployDaemon("test", 1)
+	dd.Generation = 3
+	f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Create(dd)
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	c := f.newController()
+
+	if err := c.reconcile(dd.Namespace + "/" + dd.Name); err == nil {
+		t.Fatalf("expected sync to wait for the deployment")
+	}
+
+	updated, err := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for conditionType, status := range map[v1alpha1.ConditionType]corev1.ConditionStatus{
+		v1alpha1.DeploymentCreated:   corev1.ConditionTrue,
+		v1alpha1.DeploymentAvailable: corev1.ConditionFalse,
+		v1alpha1.Ready:               corev1.ConditionFalse,
+		v1alpha1.Degraded:            corev1.ConditionFalse,
+	} {
+		condition := c.conditions.GetCondition(updated, conditionType)
+		if condition == nil || condition.Status != status || condition.ObservedGeneration != 3 {
+			t.Errorf("expected %s %s at generation 3, got %+v", conditionType, status, condition)
+		}
+	}
+	if c.conditions.GetCondition(updated, v1alpha1.Scheduled) != nil {
+		t.Errorf("expected no Scheduled condition without scheduler")
+	}
+}
+
+func TestReconcileRetriesFailedCreate(t *testing.T) {
+	f := newFixture(t)
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.TemplateRef = "ts-app-template"
+	f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Create(dd)
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	c := f.newController()
+	key := dd.Namespace + "/" + dd.Name
+
+	// The pod template does not exist yet, no deployment is recorded
+	c.reconcile(key)
+	updated, _ := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	if updated.Status.Cluster != nil {
+		t.Errorf("expected no deployment to be recorded after a failed create, got %+v", updated.Status.Cluster)
+	}
+	if condition := c.conditions.GetCondition(updated, v1alpha1.DeploymentCreated); condition == nil || condition.Reason != "DeploymentCreateFailed" {
+		t.Errorf("expected the failed create to be reported, got %+v", condition)
+	}
+
+	f.kubeInformers.Core().V1().ConfigMaps().Informer().GetIndexer().Add(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ts-app-template", Namespace: dd.Namespace},
+		Data:       map[string]string{templates.TemplateKey: "spec: {}"},
+	})
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Update(updated)
+
+	c.reconcile(key)
+	updated, _ = f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	if updated.Status.Cluster == nil || updated.Status.Cluster.DeploymentName != deploymentNameFor(dd) {
+		t.Fatalf("expected the retried deployment to be recorded, got %+v", updated.Status.Cluster)
+	}
+	if _, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(deploymentNameFor(dd), metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the deployment to be created on retry: %v", err)
+	}
+}
+
+func TestCreateDeploymentAdoptsExisting(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	dp, _ := c.makeDeployment(dd)
+	f.kubeclient.AppsV1().Deployments(dd.Namespace).Create(dp)
+
+	// The status written after the create was lost, the deployment this deploydaemon controls is recorded again
+	if _, err := c.createDeployent(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dd.Status.Cluster == nil || dd.Status.Cluster.DeploymentName != dp.Name {
+		t.Errorf("expected deployment %s to be recorded, got %+v", dp.Name, dd.Status.Cluster)
+	}
+
+	other := newDeployDaemon("test", 1)
+	other.UID = "other"
+	if _, err := c.createDeployent(other); !errors.IsAlreadyExists(err) {
+		t.Errorf("expected a deployment of another deploydaemon not to be adopted, got %v", err)
+	}
+}
+
+func TestReconcileOnlyWritesChangedStatus(t *testing.T) {
+	f := newFixture(t)
+	dd := newDeployDaemon("test", 1)
+	dd.Generation = 2
+	f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Create(dd)
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	c := f.newController()
+	key := dd.Namespace + "/" + dd.Name
+
+	c.reconcile(key)
+
+	writes := func() []string {
+		var verbs []string
+		for _, action := range f.extclient.Actions() {
+			if action.GetVerb() == "update" || action.GetVerb() == "patch" {
+				verbs = append(verbs, action.GetVerb()+"/"+action.GetSubresource())
+			}
+		}
+		f.extclient.ClearActions()
+		return verbs
+	}
+	if verbs := writes(); len(verbs) != 2 || verbs[0] != "patch/" || verbs[1] != "update/status" {
+		t.Fatalf("expected the finalizer to be patched then the status to be written, got %v", verbs)
+	}
+
+	updated, _ := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	if updated.Status.ObservedGeneration != 2 {
+		t.Errorf("expected observed generation 2, got %d", updated.Status.ObservedGeneration)
+	}
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Update(updated)
+	dp, _ := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(updated.Status.Cluster.DeploymentName, metav1.GetOptions{})
+	f.kubeInformers.Apps().V1().Deployments().Informer().GetIndexer().Add(dp)
+
+	c.reconcile(key)
+	if verbs := writes(); len(verbs) != 0 {
+		t.Errorf("expected no write for an unchanged status, got %v", verbs)
+	}
+}
+
+func TestReconcileFallsBackToDefaults(t *testing.T) {
+	f := newFixture(t)
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.Tenant = "Demo"
+	dd.Spec.Replica = nil
+	dd.Spec.Expose = ""
+	f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Create(dd)
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	c := f.newController()
+
+	c.reconcile(dd.Namespace + "/" + dd.Name)
+
+	// Without the admission webhook the controller falls back to the default replicas and expose, and writes neither
+	updated, _ := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	if !equality.Semantic.DeepEqual(updated.Spec, dd.Spec) || len(updated.Labels) != 0 {
+		t.Errorf("expected the spec and the labels not to be written, got %+v with labels %v", updated.Spec, updated.Labels)
+	}
+
+	dp, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(updated.Status.Cluster.DeploymentName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the deployment to be created: %v", err)
+	}
+	if *dp.Spec.Replicas != v1alpha1.DefaultInstance || dp.Spec.Template.Labels[exposeLabel] != exposeOffline {
+		t.Errorf("expected %d offline pods, got %d %s", v1alpha1.DefaultInstance, *dp.Spec.Replicas, dp.Spec.Template.Labels[exposeLabel])
+	}
+}
+
+func TestUpdateDeployDaemonStatusKeepsSpec(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	original := newRevisionedDeployDaemon()
+	original.Spec.RollbackTo = &v1alpha1.RollbackConfig{}
+	f.extclient.Deploycontrol().DeployDaemons(original.Namespace).Create(original)
+
+	dd := original.DeepCopy()
+	if err := c.syncRollback(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.updateDeployDaemonStatus(original, dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var verbs []string
+	for _, action := range f.extclient.Actions() {
+		if action.GetVerb() == "update" || action.GetVerb() == "patch" {
+			verbs = append(verbs, action.GetVerb()+"/"+action.GetSubresource())
+		}
+	}
+	if len(verbs) != 1 || verbs[0] != "update/status" {
+		t.Errorf("expected only the status to be written, got %v", verbs)
+	}
+
+	updated, _ := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	if !equality.Semantic.DeepEqual(updated.Spec, original.Spec) {
+		t.Errorf("expected the spec not to be written, got %+v", updated.Spec)
+	}
+	if updated.Status.RolledBackTo == nil || updated.Status.RolledBackTo.Version != "9.0.1.2" || updated.Status.History[2].Outcome != revisionRolledBack {
+		t.Errorf("expected rollback recorded in status, got %+v %+v", updated.Status.RolledBackTo, updated.Status.History)
+	}
+}
+
+func TestUpdateDeployDaemonStatusPatchesMetadata(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	original := newDeployDaemon("test", 1)
+	original.Annotations = map[string]string{promoteAnnotation: "true", "team": "ts"}
+	original.Finalizers = []string{"other"}
+	f.extclient.Deploycontrol().DeployDaemons(original.Namespace).Create(original)
+
+	dd := original.DeepCopy()
+	delete(dd.Annotations, promoteAnnotation)
+	ensureFinalizer(dd)
+	dd.Spec.Version = "9.0.1.3"
+	if err := c.updateDeployDaemonStatus(original, dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The fake client merges the patched annotations into the stored ones, the patch is applied to the original
+	var patch []byte
+	for _, action := range f.extclient.Actions() {
+		if action.GetVerb() == "patch" {
+			patch = action.(k8stesting.PatchAction).GetPatch()
+		}
+	}
+	decoded, err := jsonpatch.DecodePatch(patch)
+	if err != nil {
+		t.Fatalf("expected a JSON patch, got %s: %v", patch, err)
+	}
+	data, _ := json.Marshal(original)
+	if data, err = decoded.Apply(data); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated := &v1alpha1.DeployDaemon{}
+	json.Unmarshal(data, updated)
+	if len(updated.Annotations) != 1 || updated.Annotations["team"] != "ts" {
+		t.Errorf("expected the promote annotation to be removed, got %v", updated.Annotations)
+	}
+	if len(updated.Finalizers) != 2 || !hasFinalizer(updated) {
+		t.Errorf("expected the drain finalizer to be added, got %v", updated.Finalizers)
+	}
+	if stored, _ := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{}); stored.Spec.Version != "9.0.1.2" {
+		t.Errorf("expected the spec not to be written, got version %s", stored.Spec.Version)
+	}
+}
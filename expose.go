@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// planPodExpose decides the expose label of every pod of one version of deploydaemon.
+//
+// Pods named in offlinePods are always offline and left out of the ready pool.
+// Without percent every other pod follows spec.expose. With percent and an online expose, exactly
+// percent of the ready pods (rounded down) are online and the rest is offline. percent is spec.exposePercent,
+// scaled by the canary weight during a canary. Pods already online are
+// picked first and ties are broken by pod name, so the choice is deterministic and pods only flip when the
+// ready pods or the percentage change.
+func planPodExpose(deploydaemon *v1alpha1.DeployDaemon, pods []*corev1.Pod, percent *int32) (map[string]string, *v1alpha1.ExposeStatus, error) {
+	exposes := make(map[string]string, len(pods))
+
+	offline := make(map[string]bool, len(deploydaemon.Spec.OfflinePods))
+	for _, name := range deploydaemon.Spec.OfflinePods {
+		offline[name] = true
+	}
+
+	var ready []*corev1.Pod
+	var drained []string
+	for _, pod := range pods {
+		if offline[pod.Name] {
+			drained = append(drained, pod.Name)
+			continue
+		}
+		exposes[pod.Name] = deploydaemon.Spec.Expose
+		if isPodReady(pod) {
+			ready = append(ready, pod)
+		}
+	}
+
+	if percent != nil && deploydaemon.Spec.Expose == exposeOnline {
+		if *percent < 0 || *percent > 100 {
+			return nil, nil, fmt.Errorf("exposePercent %d is out of range 0-100", *percent)
+		}
+
+		sort.Slice(ready, func(i, j int) bool {
+			iOnline, jOnline := ready[i].Labels[exposeLabel] == exposeOnline, ready[j].Labels[exposeLabel] == exposeOnline
+			if iOnline != jOnline {
+				return iOnline
+			}
+			return ready[i].Name < ready[j].Name
+		})
+
+		online := len(ready) * int(*percent) / 100
+		for name := range exposes {
+			exposes[name] = exposeOffline
+		}
+		for _, pod := range ready[:online] {
+			exposes[pod.Name] = exposeOnline
+		}
+	}
+
+	for _, name := range drained {
+		exposes[name] = exposeOffline
+	}
+
+	status := exposeStatusFor(exposes, ready)
+	if len(drained) > 0 {
+		sort.Strings(drained)
+		status.OfflinePods = drained
+	}
+
+	return exposes, status, nil
+}
+
+// exposeStatusFor summarizes the planned expose labels of the pods
+func exposeStatusFor(exposes map[string]string, ready []*corev1.Pod) *v1alpha1.ExposeStatus {
+	status := &v1alpha1.ExposeStatus{}
+
+	for _, expose := range exposes {
+		if expose == exposeOnline {
+			status.OnlineReplicas++
+		} else {
+			status.OfflineReplicas++
+		}
+	}
+
+	var readyOnline int32
+	for _, pod := range ready {
+		if exposes[pod.Name] == exposeOnline {
+			readyOnline++
+		}
+	}
+	if len(ready) > 0 {
+		status.Percent = readyOnline * 100 / int32(len(ready))
+	}
+
+	return status
+}
+
+// isPodReady returns true if the pod is running, ready and not being deleted
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
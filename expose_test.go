@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newPod(dd *v1alpha1.DeployDaemon, name, expose string, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: dd.Namespace,
+			Labels: map[string]string{
+				"app":       dd.GetDeploymentName(),
+				"version":   dd.Spec.Version,
+				exposeLabel: expose,
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+func newPods(dd *v1alpha1.DeployDaemon, count int, expose string) []*corev1.Pod {
+	var pods []*corev1.Pod
+	for i := 0; i < count; i++ {
+		pods = append(pods, newPod(dd, fmt.Sprintf("pod-%d", i), expose, true))
+	}
+	return pods
+}
+
+// newTemplatedPods returns count pods of dd labeled as the pod template of deployment labels them
+func newTemplatedPods(dd *v1alpha1.DeployDaemon, deployment *appsv1.Deployment, count int, ready bool) []*corev1.Pod {
+	var pods []*corev1.Pod
+	for i := 0; i < count; i++ {
+		pod := newPod(dd, fmt.Sprintf("pod-%d", i), "", ready)
+		pod.Labels = map[string]string{}
+		for k, v := range deployment.Spec.Template.Labels {
+			pod.Labels[k] = v
+		}
+		pods = append(pods, pod)
+	}
+	return pods
+}
+
+// addPods creates pods in the client and the informer cache of f
+func (f *fixture) addPods(pods ...*corev1.Pod) {
+	for _, pod := range pods {
+		f.kubeclient.CoreV1().Pods(pod.Namespace).Create(pod)
+		f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Add(pod)
+	}
+}
+
+func countOnline(exposes map[string]string) int {
+	online := 0
+	for _, expose := range exposes {
+		if expose == exposeOnline {
+			online++
+		}
+	}
+	return online
+}
+
+func TestPlanPodExposeFollowsSpec(t *testing.T) {
+	dd := newDeployDaemon("test", 3)
+	dd.Spec.Expose = exposeOffline
+
+	exposes, status, err := planPodExpose(dd, newPods(dd, 3, exposeOnline), dd.Spec.ExposePercent)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if countOnline(exposes) != 0 || status.OfflineReplicas != 3 || status.Percent != 0 {
+		t.Errorf("expected all pods offline, got %v %+v", exposes, *status)
+	}
+}
+
+func TestPlanPodExposePercent(t *testing.T) {
+	dd := newDeployDaemon("test", 10)
+	percent := int32(30)
+	dd.Spec.ExposePercent = &percent
+
+	pods := newPods(dd, 10, exposeOffline)
+	pods = append(pods, newPod(dd, "pod-starting", exposeOnline, false))
+
+	exposes, status, err := planPodExpose(dd, pods, dd.Spec.ExposePercent)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if countOnline(exposes) != 3 {
+		t.Errorf("expected 3 pods online, got %d", countOnline(exposes))
+	}
+	if exposes["pod-starting"] != exposeOffline {
+		t.Errorf("expected not ready pod offline")
+	}
+	for _, name := range []string{"pod-0", "pod-1", "pod-2"} {
+		if exposes[name] != exposeOnline {
+			t.Errorf("expected %s online by name order", name)
+		}
+	}
+	if status.OnlineReplicas != 3 || status.OfflineReplicas != 8 || status.Percent != 30 {
+		t.Errorf("unexpected expose status %+v", *status)
+	}
+}
+
+func TestPlanPodExposePercentKeepsOnlinePods(t *testing.T) {
+	dd := newDeployDaemon("test", 4)
+	percent := int32(50)
+	dd.Spec.ExposePercent = &percent
+
+	pods := newPods(dd, 4, exposeOffline)
+	pods[2].Labels[exposeLabel] = exposeOnline
+	pods[3].Labels[exposeLabel] = exposeOnline
+
+	exposes, _, err := planPodExpose(dd, pods, dd.Spec.ExposePercent)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exposes["pod-2"] != exposeOnline || exposes["pod-3"] != exposeOnline || countOnline(exposes) != 2 {
+		t.Errorf("expected already online pods to stay online, got %v", exposes)
+	}
+
+	// pod-3 goes away, a ready offline pod is picked to rebalance
+	exposes, _, _ = planPodExpose(dd, pods[:3], dd.Spec.ExposePercent)
+	if countOnline(exposes) != 1 || exposes["pod-2"] != exposeOnline {
+		t.Errorf("expected pod-2 to stay online after rebalance, got %v", exposes)
+	}
+}
+
+func TestPlanPodExposePercentOutOfRange(t *testing.T) {
+	dd := newDeployDaemon("test", 1)
+	percent := int32(101)
+	dd.Spec.ExposePercent = &percent
+
+	if _, _, err := planPodExpose(dd, newPods(dd, 1, exposeOnline), dd.Spec.ExposePercent); err == nil {
+		t.Errorf("expected error for out of range percent")
+	}
+}
+
+func TestSyncPodExposeStatusUpdatesPods(t *testing.T) {
+	f := newFixture(t)
+	dd := newDeployDaemon("test", 2)
+	percent := int32(50)
+	dd.Spec.ExposePercent = &percent
+	dd.Status = &v1alpha1.DeploydaemonStatus{}
+
+	for _, pod := range newPods(dd, 2, exposeOffline) {
+		f.kubeclient.CoreV1().Pods(pod.Namespace).Create(pod)
+		f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Add(pod)
+	}
+	c := f.newController()
+
+	if err := c.syncPodExposeStatus(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	pod, err := f.kubeclient.CoreV1().Pods(dd.Namespace).Get("pod-0", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pod.Labels[exposeLabel] != exposeOnline {
+		t.Errorf("expected pod-0 online, got %s", pod.Labels[exposeLabel])
+	}
+	if dd.Status.Expose == nil || dd.Status.Expose.Percent != 50 {
+		t.Errorf("expected 50 percent reported in status, got %v", dd.Status.Expose)
+	}
+}
+
+func TestPlanPodExposeOfflinePods(t *testing.T) {
+	dd := newDeployDaemon("test", 3)
+	dd.Spec.OfflinePods = []string{"pod-1", "pod-gone"}
+
+	exposes, status, err := planPodExpose(dd, newPods(dd, 3, exposeOnline), dd.Spec.ExposePercent)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exposes["pod-1"] != exposeOffline || exposes["pod-0"] != exposeOnline || exposes["pod-2"] != exposeOnline {
+		t.Errorf("expected only pod-1 offline, got %v", exposes)
+	}
+	if len(status.OfflinePods) != 1 || status.OfflinePods[0] != "pod-1" {
+		t.Errorf("expected pod-1 reported offline, got %v", status.OfflinePods)
+	}
+	if status.Percent != 100 {
+		t.Errorf("expected offline pods out of the percentage, got %d", status.Percent)
+	}
+}
+
+func TestPlanPodExposeOfflinePodsOutOfPercentPool(t *testing.T) {
+	dd := newDeployDaemon("test", 4)
+	percent := int32(50)
+	dd.Spec.ExposePercent = &percent
+	dd.Spec.OfflinePods = []string{"pod-0"}
+
+	exposes, status, err := planPodExpose(dd, newPods(dd, 5, exposeOffline), dd.Spec.ExposePercent)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exposes["pod-0"] != exposeOffline {
+		t.Errorf("expected pod-0 offline")
+	}
+	if countOnline(exposes) != 2 || exposes["pod-1"] != exposeOnline || exposes["pod-2"] != exposeOnline {
+		t.Errorf("expected half of the remaining 4 pods online, got %v", exposes)
+	}
+	if status.OnlineReplicas != 2 || status.OfflineReplicas != 3 || status.Percent != 50 {
+		t.Errorf("unexpected expose status %+v", *status)
+	}
+}
+
+func TestSyncDeployDaemonExposesReadyPodsDuringRollout(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 4)
+	percent := int32(50)
+	dd.Spec.ExposePercent = &percent
+	dp := f.newSyncedDeployment(c, dd)
+	dp.Status.ReadyReplicas, dp.Status.AvailableReplicas = 2, 2
+
+	// Two pods are ready while the other two are still starting
+	ready := newTemplatedPods(dd, dp, 2, true)
+	starting := newTemplatedPods(dd, dp, 2, false)
+	starting[0].Name, starting[1].Name = "pod-2", "pod-3"
+	f.addPods(append(ready, starting...)...)
+
+	c.syncDeployDaemon(dd, dp)
+
+	if ready := c.conditions.GetCondition(dd, v1alpha1.Ready); ready == nil || ready.Reason != "DeploymentProgressing" {
+		t.Errorf("expected the deploydaemon to wait for the deployment, got %+v", ready)
+	}
+	online, _ := f.kubeclient.CoreV1().Pods(dd.Namespace).List(metav1.ListOptions{LabelSelector: exposeLabel + "=" + exposeOnline})
+	if len(online.Items) != 1 || dd.Status.Expose == nil || dd.Status.Expose.Percent != 50 {
+		t.Errorf("expected half of the 2 ready pods online, got %d online and %+v", len(online.Items), dd.Status.Expose)
+	}
+}
+
+func TestSyncDeployDaemonTakesOfflinePodsOfflineWhileUnready(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 3)
+	dd.Spec.OfflinePods = []string{"pod-0"}
+	dp := f.newSyncedDeployment(c, dd)
+	// A failing pod keeps the deployment unready
+	dp.Status.ReadyReplicas, dp.Status.AvailableReplicas = 2, 2
+	pods := newPods(dd, 2, exposeOnline)
+	failing := newPod(dd, "pod-2", exposeOnline, false)
+	f.addPods(append(pods, failing)...)
+
+	c.syncDeployDaemon(dd, dp)
+
+	pod, _ := f.kubeclient.CoreV1().Pods(dd.Namespace).Get("pod-0", metav1.GetOptions{})
+	if pod.Labels[exposeLabel] != exposeOffline {
+		t.Errorf("expected pod-0 offline while the deployment is unready, got %s", pod.Labels[exposeLabel])
+	}
+	if dd.Status.Expose == nil || len(dd.Status.Expose.OfflinePods) != 1 {
+		t.Errorf("expected pod-0 reported offline, got %+v", dd.Status.Expose)
+	}
+	if !c.conditions.IsTrue(dd, v1alpha1.ExposeSynced) {
+		t.Errorf("expected the expose labels to be synced, got %+v", c.conditions.GetCondition(dd, v1alpha1.ExposeSynced))
+	}
+}
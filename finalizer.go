@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// drainFinalizer keeps a deleted deploydaemon until its pods are drained and its objects are removed
+const drainFinalizer = "deploycontrol.k8s.io/drain"
+
+// defaultDrainPeriod keeps the pods running offline when the spec sets no drainPeriod
+const defaultDrainPeriod = 30 * time.Second
+
+func hasFinalizer(deploydaemon *v1alpha1.DeployDaemon) bool {
+	for _, finalizer := range deploydaemon.Finalizers {
+		if finalizer == drainFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureFinalizer adds the drain finalizer to deploydaemon, it is patched before the status of the sync is written
+func ensureFinalizer(deploydaemon *v1alpha1.DeployDaemon) {
+	if !hasFinalizer(deploydaemon) {
+		deploydaemon.Finalizers = append(deploydaemon.Finalizers, drainFinalizer)
+	}
+}
+
+func removeFinalizer(deploydaemon *v1alpha1.DeployDaemon) {
+	var finalizers []string
+	for _, finalizer := range deploydaemon.Finalizers {
+		if finalizer != drainFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	deploydaemon.Finalizers = finalizers
+}
+
+// syncDeletion drains the deleted deploydaemon and returns how long to wait for the next stage:
+//  1. every pod of its deployments is labeled offline, so the Service and the traffic provider stop sending requests
+//  2. the pods keep running for drainPeriod to finish the requests in flight
+//  3. the deploydaemon is taken out of the Service and the routing of its component, both go away with the last one
+//  4. its deployments are deleted and the finalizer is removed, which lets the API server delete it
+func (c *Controller) syncDeletion(deploydaemon *v1alpha1.DeployDaemon, now time.Time) (time.Duration, error) {
+	if !hasFinalizer(deploydaemon) {
+		return 0, nil
+	}
+	if deploydaemon.Status == nil {
+		deploydaemon.Status = &v1alpha1.DeploydaemonStatus{}
+	}
+
+	deployments, err := c.controlledDeployments(deploydaemon)
+	if err != nil {
+		return 0, err
+	}
+
+	if deploydaemon.Status.DrainStartTime == nil {
+		start := metav1.NewTime(now.Truncate(time.Second))
+		deploydaemon.Status.DrainStartTime = &start
+		c.recorder.Event(deploydaemon, corev1.EventTypeNormal, "Draining", "Taking pods offline before deletion")
+	}
+
+	if err := c.drainPods(deploydaemon, deployments); err != nil {
+		return 0, err
+	}
+
+	period := defaultDrainPeriod
+	if deploydaemon.Spec.DrainPeriod != nil {
+		period = deploydaemon.Spec.DrainPeriod.Duration
+	}
+	if wait := deploydaemon.Status.DrainStartTime.Add(period).Sub(now); wait > 0 {
+		return wait, nil
+	}
+
+	if err := c.releaseTraffic(deploydaemon); err != nil {
+		return 0, fmt.Errorf("release traffic failed: %s", err.Error())
+	}
+	if err := c.releaseService(deploydaemon); err != nil {
+		return 0, err
+	}
+	c.recorder.Event(deploydaemon, corev1.EventTypeNormal, "Released", "Removed from the service and the routing of the component")
+
+	for _, dp := range deployments {
+		klog.Infof("delete deployment %s of deleted deploydaemon %s", dp.Name, deploydaemon.Name)
+		if err := c.kubeclientset.AppsV1().Deployments(deploydaemon.Namespace).Delete(dp.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return 0, fmt.Errorf("delete deployment %s failed: %s", dp.Name, err.Error())
+		}
+	}
+	c.recorder.Eventf(deploydaemon, corev1.EventTypeNormal, "DeploymentsDeleted", "Deleted %d deployments", len(deployments))
+
+	removeFinalizer(deploydaemon)
+	c.recorder.Event(deploydaemon, corev1.EventTypeNormal, "Drained", "Removed finalizer, deletion can proceed")
+	return 0, nil
+}
+
+// drainPods labels every pod of the deployments of deploydaemon offline
+func (c *Controller) drainPods(deploydaemon *v1alpha1.DeployDaemon, deployments []*appsv1.Deployment) error {
+	drained := deploydaemon.DeepCopy()
+	drained.Spec.Expose = exposeOffline
+
+	for _, dp := range deployments {
+		exposeStatus, err := c.syncPodExpose(drained, dp.Labels["version"], nil)
+		if err != nil {
+			return err
+		}
+		if deploydaemon.Status.Cluster != nil && dp.Name == deploydaemon.Status.Cluster.DeploymentName {
+			deploydaemon.Status.Expose = exposeStatus
+		}
+	}
+	return nil
+}
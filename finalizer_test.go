@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconcileAddsFinalizer(t *testing.T) {
+	f := newFixture(t)
+	dd := newDeployDaemon("test", 1)
+	f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Create(dd)
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	c := f.newController()
+
+	c.reconcile(dd.Namespace + "/" + dd.Name)
+
+	updated, _ := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	if !hasFinalizer(updated) {
+		t.Errorf("expected finalizer %s, got %v", drainFinalizer, updated.Finalizers)
+	}
+}
+
+func TestSyncDeletionDrainsBeforeDeleting(t *testing.T) {
+	f := newFixture(t)
+	dd := newVersionedDeployDaemon("ts-app", "9.0.1.2")
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	for _, pod := range newPods(dd, 2, exposeOnline) {
+		f.kubeclient.CoreV1().Pods(dd.Namespace).Create(pod)
+		f.kubeInformers.Core().V1().Pods().Informer().GetIndexer().Add(pod)
+	}
+	c := f.newController()
+	provider := &fakeTrafficProvider{}
+	c.traffic = provider
+
+	dp := f.newSyncedDeployment(c, dd)
+	if err := c.syncService(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service, _ := f.kubeclient.CoreV1().Services(dd.Namespace).Get(dd.GetDeploymentName(), metav1.GetOptions{})
+	f.kubeInformers.Core().V1().Services().Informer().GetIndexer().Add(service)
+
+	deleted := metav1.NewTime(time.Date(2019, 1, 5, 3, 0, 0, 0, time.UTC))
+	dd.DeletionTimestamp = &deleted
+	ensureFinalizer(dd)
+
+	if wait, err := c.syncDeletion(dd, deleted.Time); err != nil || wait != defaultDrainPeriod {
+		t.Fatalf("expected to drain for %s, got %s %v", defaultDrainPeriod, wait, err)
+	}
+	pods, _ := f.kubeclient.CoreV1().Pods(dd.Namespace).List(metav1.ListOptions{})
+	for _, pod := range pods.Items {
+		if pod.Labels[exposeLabel] != exposeOffline {
+			t.Errorf("expected pod %s offline while draining", pod.Name)
+		}
+	}
+	if _, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(dp.Name, metav1.GetOptions{}); err != nil {
+		t.Errorf("expected deployment to keep running while draining: %v", err)
+	}
+	if !hasFinalizer(dd) {
+		t.Fatalf("expected finalizer to be kept while draining")
+	}
+
+	if wait, err := c.syncDeletion(dd, deleted.Add(defaultDrainPeriod)); err != nil || wait != 0 {
+		t.Fatalf("expected drain to be over, got %s %v", wait, err)
+	}
+	if _, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(dp.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected deployment to be deleted, got %v", err)
+	}
+	if _, err := f.kubeclient.CoreV1().Services(dd.Namespace).Get(service.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected service of the last deploydaemon to be deleted, got %v", err)
+	}
+	if len(provider.removed) != 1 {
+		t.Errorf("expected routing to be removed, got %v", provider.removed)
+	}
+	if hasFinalizer(dd) {
+		t.Errorf("expected finalizer to be removed")
+	}
+}
+
+func TestReleaseServiceKeepsPeers(t *testing.T) {
+	f := newFixture(t)
+	v1 := newVersionedDeployDaemon("ts-app-v1", "9.0.1.2")
+	v2 := newVersionedDeployDaemon("ts-app-v2", "9.0.1.3")
+	for _, dd := range []*v1alpha1.DeployDaemon{v1, v2} {
+		f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	}
+	c := f.newController()
+	if err := c.syncService(v1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service, _ := f.kubeclient.CoreV1().Services(v1.Namespace).Get(v1.GetDeploymentName(), metav1.GetOptions{})
+	f.kubeInformers.Core().V1().Services().Informer().GetIndexer().Add(service)
+
+	if err := c.releaseService(v1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service, err := f.kubeclient.CoreV1().Services(v1.Namespace).Get(v1.GetDeploymentName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected service to be kept for the other version: %v", err)
+	}
+	if len(service.OwnerReferences) != 1 || service.OwnerReferences[0].Name != v2.Name {
+		t.Errorf("expected service owned by %s only, got %v", v2.Name, service.OwnerReferences)
+	}
+}
@@ -0,0 +1,46 @@
+// Command crd-gen writes the CustomResourceDefinition of DeployDaemon generated from the Go types of its versions,
+// converted by the webhook of the operator. Run it from the root of the repository after changing the types:
+//
+//	go run hack/crd-gen/main.go
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1beta1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/config"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/crdgen"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/webhook"
+	"k8s.io/klog"
+)
+
+func main() {
+	defaults := config.Default().Webhook
+	output := flag.String("output", "artifacts/deploydaemon-crd.yaml", "The file the CustomResourceDefinition is written to.")
+	service := flag.String("webhook-service", defaults.ServiceName, "The Service of the conversion webhook, the operator updates it once running.")
+	namespace := flag.String("webhook-service-namespace", defaults.ServiceNamespace, "The namespace of the conversion webhook Service.")
+	flag.Parse()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		klog.Fatal(err)
+	}
+	crd, err := crdgen.Generate(wd,
+		crdgen.Version{GroupVersion: v1beta1.SchemeGroupVersion, Object: &v1beta1.DeployDaemon{}},
+		crdgen.Version{GroupVersion: v1alpha1.SchemeGroupVersion, Object: &v1alpha1.DeployDaemon{}},
+	)
+	if err != nil {
+		klog.Fatalf("generate the CustomResourceDefinition failed: %s", err.Error())
+	}
+	crd.Spec.Conversion = crdgen.WebhookConversion(*namespace, *service, webhook.ConvertPath)
+	data, err := crdgen.Marshal(crd)
+	if err != nil {
+		klog.Fatal(err)
+	}
+	if err := ioutil.WriteFile(*output, data, 0644); err != nil {
+		klog.Fatal(err)
+	}
+}
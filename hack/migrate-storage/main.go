@@ -0,0 +1,40 @@
+// Command migrate-storage rewrites every DeployDaemon in the storage version of its CustomResourceDefinition and
+// records it as the only stored version. Run it after applying a definition with a new storage version, before
+// applying one that no longer serves the previous version. It also converts the status.conditions object written by
+// the releases before the condition list, run it once after upgrading from those releases:
+//
+//	go run hack/migrate-storage/main.go --kubeconfig ~/.kube/config
+package main
+
+import (
+	"flag"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/config"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/migration"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog"
+)
+
+func main() {
+	var cfg config.Config
+	flag.StringVar(&cfg.Kubeconfig, "kubeconfig", "", "Path to a kubeconfig, $KUBECONFIG or ~/.kube/config are used when not set and not in a cluster.")
+	flag.StringVar(&cfg.Master, "master", "", "The address of the Kubernetes API server, overrides the one of the kubeconfig.")
+	klog.InitFlags(nil)
+	flag.Set("logtostderr", "true")
+	flag.Parse()
+
+	restConfig, err := cfg.RestConfig()
+	if err != nil {
+		klog.Fatalf("Error building kubeconfig: %s", err.Error())
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		klog.Fatalf("Error build dynamic client: %s", err.Error())
+	}
+
+	version, err := migration.MigrateStorage(client)
+	if err != nil {
+		klog.Fatalf("Error migrating the deploydaemons: %s", err.Error())
+	}
+	klog.Infof("DeployDaemons are stored in %s", version)
+}
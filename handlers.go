@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// objectFromTombstone returns the object of a delete event, which is a tombstone when the informer missed the deletion
+func objectFromTombstone(obj interface{}) (metav1.Object, bool) {
+	if object, ok := obj.(metav1.Object); ok {
+		return object, true
+	}
+
+	tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("error decoding object, invalid type"))
+		return nil, false
+	}
+	object, ok := tombstone.Obj.(metav1.Object)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("error decoding object tombstone, invalid type"))
+		return nil, false
+	}
+	return object, true
+}
+
+// handleDeployment enqueues the deploydaemon controlling a deployment, so a rollout, a scale or a manual edit of the
+// deployment is synced at once instead of at the next resync
+func (c *Controller) handleDeployment(obj interface{}) {
+	object, ok := objectFromTombstone(obj)
+	if !ok {
+		return
+	}
+
+	ownerRef := metav1.GetControllerOf(object)
+	if ownerRef == nil || ownerRef.Kind != "DeployDaemon" || ownerRef.APIVersion != v1alpha1.SchemeGroupVersion.String() {
+		return
+	}
+
+	deploydaemon, err := c.deploydaemonLister.DeployDaemons(object.GetNamespace()).Get(ownerRef.Name)
+	if err != nil || deploydaemon.UID != ownerRef.UID {
+		klog.V(4).Infof("ignoring orphaned deployment %s/%s of deploydaemon %s", object.GetNamespace(), object.GetName(), ownerRef.Name)
+		return
+	}
+	c.enqueueDeployDaemon(deploydaemon)
+}
+
+// handlePod enqueues the deploydaemon controlling the deployment of a pod. Pods are owned by the replica sets of the
+// deployments, which are named after their deployment and the pod-template-hash label of their pods, so the
+// deployment is found without listing the deploydaemons or the replica sets.
+func (c *Controller) handlePod(obj interface{}) {
+	object, ok := objectFromTombstone(obj)
+	if !ok {
+		return
+	}
+
+	ownerRef := metav1.GetControllerOf(object)
+	suffix := "-" + object.GetLabels()[appsv1.DefaultDeploymentUniqueLabelKey]
+	if ownerRef == nil || ownerRef.Kind != "ReplicaSet" || suffix == "-" || !strings.HasSuffix(ownerRef.Name, suffix) {
+		return
+	}
+
+	deployment, err := c.deploymentsLister.Deployments(object.GetNamespace()).Get(strings.TrimSuffix(ownerRef.Name, suffix))
+	if err != nil {
+		klog.V(4).Infof("ignoring pod %s/%s of unknown replica set %s", object.GetNamespace(), object.GetName(), ownerRef.Name)
+		return
+	}
+	c.handleDeployment(deployment)
+}
+
+// deploymentEventHandler and podEventHandler skip the periodic resyncs, the deploydaemon informer already resyncs
+// every deploydaemon
+func (c *Controller) deploymentEventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: c.handleDeployment,
+		UpdateFunc: func(old, new interface{}) {
+			if old.(*appsv1.Deployment).ResourceVersion == new.(*appsv1.Deployment).ResourceVersion {
+				return
+			}
+			c.handleDeployment(new)
+		},
+		DeleteFunc: c.handleDeployment,
+	}
+}
+
+func (c *Controller) podEventHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: c.handlePod,
+		UpdateFunc: func(old, new interface{}) {
+			if old.(*corev1.Pod).ResourceVersion == new.(*corev1.Pod).ResourceVersion {
+				return
+			}
+			c.handlePod(new)
+		},
+		DeleteFunc: c.handlePod,
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/templates"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// queuedKeys returns the keys the queue holds
+func queuedKeys(c *Controller) map[string]bool {
+	keys := map[string]bool{}
+	for c.workqueue.Len() > 0 {
+		key, _ := c.workqueue.Get()
+		keys[key.(string)] = true
+		c.workqueue.Done(key)
+	}
+	return keys
+}
+
+func TestHandleDeploymentEnqueuesOwner(t *testing.T) {
+	f := newFixture(t)
+	dd := newVersionedDeployDaemon("ts-app", "9.0.1.2")
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	c := f.newController()
+
+	dp, err := c.makeDeployment(dd)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c.handleDeployment(dp)
+	if keys := queuedKeys(c); len(keys) != 1 || !keys[dd.Namespace+"/"+dd.Name] {
+		t.Errorf("expected owner %s to be enqueued, got %v", dd.Name, keys)
+	}
+
+	c.handleDeployment(cache.DeletedFinalStateUnknown{Key: dd.Namespace + "/" + dp.Name, Obj: dp})
+	if keys := queuedKeys(c); len(keys) != 1 {
+		t.Errorf("expected owner of deleted deployment to be enqueued, got %v", keys)
+	}
+
+	dp.OwnerReferences = nil
+	c.handleDeployment(dp)
+	if keys := queuedKeys(c); len(keys) != 0 {
+		t.Errorf("expected unowned deployment to be ignored, got %v", keys)
+	}
+}
+
+// newReplicaSetPod returns a pod of dd created by the replica set of dp
+func newReplicaSetPod(dd *v1alpha1.DeployDaemon, dp *appsv1.Deployment, name string) *corev1.Pod {
+	pod := newPod(dd, name, exposeOnline, true)
+	pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey] = "5d4b8c7f9"
+	controller := true
+	pod.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: appsv1.SchemeGroupVersion.String(),
+		Kind:       "ReplicaSet",
+		Name:       dp.Name + "-5d4b8c7f9",
+		Controller: &controller,
+	}}
+	return pod
+}
+
+func TestHandlePodEnqueuesDeploymentOwner(t *testing.T) {
+	f := newFixture(t)
+	dd := newVersionedDeployDaemon("ts-app", "9.0.1.3")
+	// Another deploydaemon of the same component, its app label matches the pods as well
+	other := newVersionedDeployDaemon("ts-app-copy", "9.0.1.2")
+	other.UID = "other"
+	for _, deploydaemon := range []*v1alpha1.DeployDaemon{dd, other} {
+		f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(deploydaemon)
+	}
+	c := f.newController()
+
+	// The deployment of the version dd replaces is still controlled by dd
+	previous := dd.DeepCopy()
+	previous.Spec.Version = "9.0.1.2"
+	dp, err := c.makeDeployment(previous)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f.kubeInformers.Apps().V1().Deployments().Informer().GetIndexer().Add(dp)
+
+	pod := newReplicaSetPod(previous, dp, "pod-0")
+	c.handlePod(pod)
+	if keys := queuedKeys(c); len(keys) != 1 || !keys[dd.Namespace+"/"+dd.Name] {
+		t.Errorf("expected only the owner %s to be enqueued, got %v", dd.Name, keys)
+	}
+
+	c.handlePod(cache.DeletedFinalStateUnknown{Key: pod.Namespace + "/" + pod.Name, Obj: pod})
+	if keys := queuedKeys(c); len(keys) != 1 {
+		t.Errorf("expected owner of deleted pod to be enqueued, got %v", keys)
+	}
+
+	c.handlePod(newPod(dd, "unowned", exposeOnline, true))
+	c.handlePod(newReplicaSetPod(dd, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "removed"}}, "orphan"))
+	if keys := queuedKeys(c); len(keys) != 0 {
+		t.Errorf("expected pods without a known deployment to be ignored, got %v", keys)
+	}
+}
+
+func TestHandlePodDoesNotBackOff(t *testing.T) {
+	f := newFixture(t)
+	dd := newVersionedDeployDaemon("ts-app", "9.0.1.2")
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	c := f.newController()
+	dp := f.newSyncedDeployment(c, dd)
+	key := dd.Namespace + "/" + dd.Name
+
+	for i := 0; i < 20; i++ {
+		c.handlePod(newReplicaSetPod(dd, dp, "pod-0"))
+	}
+	if requeues := c.workqueue.NumRequeues(key); requeues != 0 {
+		t.Errorf("expected watch events not to back off the deploydaemon, got %d requeues", requeues)
+	}
+	if keys := queuedKeys(c); len(keys) != 1 || !keys[key] {
+		t.Errorf("expected %s to be enqueued at once, got %v", key, keys)
+	}
+}
+
+func TestSyncDeploymentRevertsManualEdit(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	dp := f.newSyncedDeployment(c, dd)
+
+	edited := dp.DeepCopy()
+	edited.Spec.Template.Spec.Containers[0].Image = "registry.example.com/ts-app:debug"
+	f.kubeclient.AppsV1().Deployments(dd.Namespace).Update(edited)
+
+	if err := c.syncDeployment(dd, edited); err == nil {
+		t.Fatalf("expected sync to wait for the reverted template")
+	}
+	updated, _ := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(dp.Name, metav1.GetOptions{})
+	if image := updated.Spec.Template.Spec.Containers[0].Image; image != dd.Spec.Image {
+		t.Errorf("expected image reverted to %s, got %s", dd.Spec.Image, image)
+	}
+
+}
+
+func TestSyncDeploymentRecordsDefaultedTemplate(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.TemplateRef = "ts-app-template"
+	f.kubeInformers.Core().V1().ConfigMaps().Informer().GetIndexer().Add(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "ts-app-template", Namespace: dd.Namespace},
+		Data: map[string]string{
+			templates.TemplateKey: `
+spec:
+  containers:
+  - name: ts-app
+    readinessProbe:
+      httpGet:
+        path: /
+        port: 80
+`,
+		},
+	})
+	dp := f.newSyncedDeployment(c, dd)
+
+	// The deployment as the API server stores the rendered one, with the defaults of the probe and the container
+	// and without the template hash the operator records afterwards
+	defaulted := dp.DeepCopy()
+	delete(defaulted.Annotations, templateHashAnnotation)
+	pod := &defaulted.Spec.Template.Spec
+	pod.DNSPolicy, pod.RestartPolicy, pod.SchedulerName = corev1.DNSClusterFirst, corev1.RestartPolicyAlways, corev1.DefaultSchedulerName
+	container := &pod.Containers[0]
+	container.ImagePullPolicy = corev1.PullIfNotPresent
+	container.TerminationMessagePath, container.TerminationMessagePolicy = corev1.TerminationMessagePathDefault, corev1.TerminationMessageReadFile
+	probe := container.ReadinessProbe
+	probe.TimeoutSeconds, probe.PeriodSeconds, probe.SuccessThreshold, probe.FailureThreshold = 1, 10, 1, 3
+	probe.HTTPGet.Scheme = corev1.URISchemeHTTP
+	f.kubeclient.AppsV1().Deployments(dd.Namespace).Update(defaulted)
+	f.kubeclient.ClearActions()
+
+	for i := 0; i < 3; i++ {
+		if err := c.syncDeployment(dd, defaulted); err != nil {
+			t.Fatalf("sync %d: expected defaulted deployment in sync, got %v", i, err)
+		}
+		defaulted, _ = f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(dp.Name, metav1.GetOptions{})
+	}
+	updates := 0
+	for _, action := range f.kubeclient.Actions() {
+		if action.GetVerb() == "update" {
+			updates++
+		}
+	}
+	if updates != 1 {
+		t.Errorf("expected the defaulted template to be recorded once, got %d updates", updates)
+	}
+	if probe := defaulted.Spec.Template.Spec.Containers[0].ReadinessProbe; probe.PeriodSeconds != 10 {
+		t.Errorf("expected the defaulted probe to be kept, got %+v", probe)
+	}
+
+	// An edit after the template was recorded is reverted
+	edited := defaulted.DeepCopy()
+	edited.Spec.Template.Spec.Containers[0].ReadinessProbe.PeriodSeconds = 30
+	f.kubeclient.AppsV1().Deployments(dd.Namespace).Update(edited)
+	if err := c.syncDeployment(dd, edited); err == nil {
+		t.Fatalf("expected sync to wait for the reverted template")
+	}
+	updated, _ := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(dp.Name, metav1.GetOptions{})
+	if _, ok := updated.Annotations[templateHashAnnotation]; ok || updated.Spec.Template.Spec.Containers[0].ReadinessProbe.PeriodSeconds != 0 {
+		t.Errorf("expected the rendered template to be written again, got %+v", updated.Spec.Template.Spec.Containers[0].ReadinessProbe)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+)
+
+// workerProgress tracks the workers of the controller. The workers are wedged when all of them have been busy
+// without finishing an item for a while and items keep waiting in the queue.
+type workerProgress struct {
+	// started is the number of workers, 0 until they are started, e.g. on a standby replica
+	started int32
+	// busy is the number of workers processing an item
+	busy int32
+	// lastProgress is the time a worker last finished an item or the workers were started, in unix nanoseconds
+	lastProgress int64
+}
+
+func (w *workerProgress) start(threadiness int, now time.Time) {
+	atomic.StoreInt64(&w.lastProgress, now.UnixNano())
+	atomic.StoreInt32(&w.started, int32(threadiness))
+}
+
+func (w *workerProgress) take() {
+	atomic.AddInt32(&w.busy, 1)
+}
+
+func (w *workerProgress) done(now time.Time) {
+	atomic.StoreInt64(&w.lastProgress, now.UnixNano())
+	atomic.AddInt32(&w.busy, -1)
+}
+
+// Ready returns an error until the caches the workers wait for are synced
+func (c *Controller) Ready() error {
+	var unsynced []string
+	for name, synced := range map[string]cache.InformerSynced{
+		"deploydaemons": c.deploydaemonSynced,
+		"pods":          c.podsSynced,
+		"deployments":   c.deploymentsSynced,
+		"configmaps":    c.configMapsSynced,
+		"services":      c.servicesSynced,
+	} {
+		if !synced() {
+			unsynced = append(unsynced, name)
+		}
+	}
+	if len(unsynced) > 0 {
+		return fmt.Errorf("caches not synced: %s", strings.Join(unsynced, ", "))
+	}
+	return nil
+}
+
+// Healthy returns an error when every worker has been busy for longer than stallTimeout while items are queued
+func (c *Controller) Healthy(now time.Time, stallTimeout time.Duration) error {
+	started := atomic.LoadInt32(&c.workers.started)
+	if started == 0 || atomic.LoadInt32(&c.workers.busy) < started || c.workqueue.Len() == 0 {
+		return nil
+	}
+
+	stalled := now.Sub(time.Unix(0, atomic.LoadInt64(&c.workers.lastProgress)))
+	if stalled > stallTimeout {
+		return fmt.Errorf("all %d workers busy without progress for %s, %d items queued", started, stalled.Truncate(time.Second), c.workqueue.Len())
+	}
+	return nil
+}
+
+// healthHandler answers ok, or 500 with the error of check
+func healthHandler(check func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			klog.Warningf("%s check failed: %s", r.URL.Path, err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}
+}
+
+// serveHealth serves the liveness probe on /healthz and the readiness probe on /readyz
+func serveHealth(addr string, controller *Controller, stallTimeout time.Duration) {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", healthHandler(func() error {
+		return controller.Healthy(time.Now(), stallTimeout)
+	}))
+	mux.Handle("/readyz", healthHandler(controller.Ready))
+
+	klog.Infof("Serving health probes on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		klog.Fatalf("Error serving health probes: %s", err.Error())
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadyWaitsForCaches(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+
+	if err := c.Ready(); err == nil {
+		t.Fatalf("expected not ready before the caches are synced")
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	f.kubeInformers.Start(stopCh)
+	f.extInformers.Start(stopCh)
+	f.kubeInformers.WaitForCacheSync(stopCh)
+	f.extInformers.WaitForCacheSync(stopCh)
+
+	if err := c.Ready(); err != nil {
+		t.Errorf("expected ready once the caches are synced, got %v", err)
+	}
+}
+
+func TestHealthyDetectsWedgedWorkers(t *testing.T) {
+	c := newFixture(t).newController()
+	now := time.Date(2019, 1, 5, 3, 0, 0, 0, time.UTC)
+
+	c.workqueue.Add("default/test")
+	if err := c.Healthy(now, time.Minute); err != nil {
+		t.Errorf("expected healthy before the workers are started, got %v", err)
+	}
+
+	c.workers.start(2, now)
+	c.workers.take()
+	if err := c.Healthy(now.Add(time.Hour), time.Minute); err != nil {
+		t.Errorf("expected healthy with an idle worker, got %v", err)
+	}
+
+	c.workers.take()
+	if err := c.Healthy(now.Add(30*time.Second), time.Minute); err != nil {
+		t.Errorf("expected healthy within the stall timeout, got %v", err)
+	}
+	if err := c.Healthy(now.Add(2*time.Minute), time.Minute); err == nil {
+		t.Errorf("expected unhealthy when all workers are stuck with items queued")
+	}
+
+	c.workers.done(now.Add(2 * time.Minute))
+	if err := c.Healthy(now.Add(2*time.Minute), time.Minute); err != nil {
+		t.Errorf("expected healthy once a worker makes progress, got %v", err)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	c := newFixture(t).newController()
+
+	recorder := httptest.NewRecorder()
+	healthHandler(c.Ready)(recorder, httptest.NewRequest("GET", "/readyz", nil))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("expected /readyz to fail before the caches are synced, got %d", recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	healthHandler(func() error { return c.Healthy(time.Now(), time.Minute) })(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "ok" {
+		t.Errorf("expected /healthz ok, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/metrics"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+)
+
+const defaultRevisionHistoryLimit = 10
+
+const (
+	revisionProgressing = "Progressing"
+	revisionSucceeded   = "Succeeded"
+	revisionFailed      = "Failed"
+	revisionSuperseded  = "Superseded"
+	revisionRolledBack  = "RolledBack"
+)
+
+// revisionHistoryLimit returns the number of retired deployments of deploydaemon kept for a rollback
+func revisionHistoryLimit(deploydaemon *v1alpha1.DeployDaemon) int {
+	if deploydaemon.Spec.RevisionHistoryLimit == nil || *deploydaemon.Spec.RevisionHistoryLimit < 0 {
+		return defaultRevisionHistoryLimit
+	}
+	return int(*deploydaemon.Spec.RevisionHistoryLimit)
+}
+
+// recordRevision appends the spec deployed to deploymentName to the history when it differs from the latest revision.
+// The history keeps the current revision and as many older ones as revisionHistoryLimit.
+func recordRevision(deploydaemon *v1alpha1.DeployDaemon, deploymentName, hash string, now time.Time) {
+	history := deploydaemon.Status.History
+
+	var number int64 = 1
+	if len(history) > 0 {
+		latest := &history[len(history)-1]
+		if latest.SpecHash == hash && latest.DeploymentName == deploymentName {
+			return
+		}
+		if latest.Outcome == revisionProgressing {
+			latest.Outcome = revisionSuperseded
+		}
+		number = latest.Revision + 1
+	}
+
+	deployTime := metav1.NewTime(now.Truncate(time.Second))
+	history = append(history, v1alpha1.Revision{
+		Revision:       number,
+		Version:        deploydaemon.Spec.Version,
+		Image:          deploydaemon.Spec.Image,
+		Config:         deploydaemon.Spec.Config,
+		Secrets:        deploydaemon.Spec.Secrets,
+		TemplateRef:    deploydaemon.Spec.TemplateRef,
+		SpecHash:       hash,
+		DeploymentName: deploymentName,
+		DeployTime:     &deployTime,
+		Outcome:        revisionProgressing,
+	})
+
+	if limit := revisionHistoryLimit(deploydaemon) + 1; len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	deploydaemon.Status.History = history
+}
+
+// markRevision records the outcome of the latest revision from its deployment
+func markRevision(deploydaemon *v1alpha1.DeployDaemon, deployment *appsv1.Deployment, now time.Time) {
+	history := deploydaemon.Status.History
+	if len(history) == 0 {
+		return
+	}
+	latest := &history[len(history)-1]
+	if latest.Outcome != revisionProgressing || latest.DeploymentName != deployment.Name {
+		return
+	}
+
+	if isDeploymentReady(deployment) {
+		readyTime := metav1.NewTime(now.Truncate(time.Second))
+		latest.ReadyTime = &readyTime
+		latest.Outcome = revisionSucceeded
+		if latest.DeployTime != nil {
+			metrics.ObserveRolloutReady(deploydaemon.Namespace, deploydaemon.Name, readyTime.Sub(latest.DeployTime.Time))
+		}
+		return
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+			latest.Outcome = revisionFailed
+		}
+	}
+}
+
+// syncRollback deploys the revision named by spec.rollbackTo in place of the spec. The revision is resolved once and
+// kept in status.rolledBackTo, so it stays deployed, even once pruned from the history, until rollbackTo is removed.
+// The spec is never written back: the rest of the sync re-renders the deployment of that revision, adopting it when
+// it is still kept, and exposes it again.
+func (c *Controller) syncRollback(deploydaemon *v1alpha1.DeployDaemon) error {
+	rollbackTo := deploydaemon.Spec.RollbackTo
+	if rollbackTo == nil {
+		if deploydaemon.Status != nil {
+			deploydaemon.Status.RolledBackTo = nil
+		}
+		return nil
+	}
+	if deploydaemon.Status == nil {
+		deploydaemon.Status = &v1alpha1.DeploydaemonStatus{}
+	}
+
+	target := deploydaemon.Status.RolledBackTo
+	if target == nil || rollbackTo.Revision != 0 && rollbackTo.Revision != target.Revision {
+		history := deploydaemon.Status.History
+		target = nil
+		for i := range history {
+			if rollbackTo.Revision == 0 && i == len(history)-2 || rollbackTo.Revision != 0 && history[i].Revision == rollbackTo.Revision {
+				target = history[i].DeepCopy()
+			}
+		}
+		if target == nil {
+			c.recorder.Eventf(deploydaemon, corev1.EventTypeWarning, "RollbackRevisionNotFound", "Unable to find revision %d to roll back to", rollbackTo.Revision)
+			return fmt.Errorf("revision %d to roll back to is not in history", rollbackTo.Revision)
+		}
+
+		klog.Infof("roll back deploydaemon %s to revision %d version %s", deploydaemon.Name, target.Revision, target.Version)
+		if latest := &history[len(history)-1]; latest.Revision != target.Revision {
+			latest.Outcome = revisionRolledBack
+		}
+		deploydaemon.Status.RolledBackTo = target
+		c.recorder.Eventf(deploydaemon, corev1.EventTypeNormal, "RolledBack", "Rolled back to revision %d version %s", target.Revision, target.Version)
+	}
+
+	restoreRevision(deploydaemon, target)
+	return nil
+}
+
+// restoreRevision sets the fields of the spec of deploydaemon that deploy a version to the ones of revision
+func restoreRevision(deploydaemon *v1alpha1.DeployDaemon, revision *v1alpha1.Revision) {
+	deploydaemon.Spec.Version = revision.Version
+	deploydaemon.Spec.Image = revision.Image
+	deploydaemon.Spec.Config = revision.Config
+	deploydaemon.Spec.Secrets = append([]v1alpha1.SecretsRef(nil), revision.Secrets...)
+	deploydaemon.Spec.TemplateRef = revision.TemplateRef
+}
+
+// asDeployed returns deploydaemon, read from the lister, as its sync deploys it: with the spec of the revision
+// spec.rollbackTo restored, or of the current revision while a new version waits for its schedule. deploydaemon is
+// copied before it is changed.
+func asDeployed(deploydaemon *v1alpha1.DeployDaemon) *v1alpha1.DeployDaemon {
+	status := deploydaemon.Status
+	var revision *v1alpha1.Revision
+	if status != nil && deploydaemon.Spec.RollbackTo != nil && status.RolledBackTo != nil {
+		revision = status.RolledBackTo
+	} else if status != nil && deploydaemon.Spec.Scheduler != "" && status.NextScheduleTime != nil {
+		revision = currentRevision(deploydaemon)
+	}
+	if revision == nil {
+		return deploydaemon
+	}
+	deploydaemon = deploydaemon.DeepCopy()
+	restoreRevision(deploydaemon, revision)
+	return deploydaemon
+}
+
+// currentRevision returns the revision of the deployment of the current version of deploydaemon, nil when none is
+// deployed
+func currentRevision(deploydaemon *v1alpha1.DeployDaemon) *v1alpha1.Revision {
+	if deploydaemon.Status == nil || deploydaemon.Status.Cluster == nil || deploydaemon.Status.Cluster.DeploymentName == "" {
+		return nil
+	}
+	history := deploydaemon.Status.History
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].DeploymentName == deploydaemon.Status.Cluster.DeploymentName {
+			return history[i].DeepCopy()
+		}
+	}
+	return nil
+}
+
+// pruneDeployments deletes the oldest retired deployments of deploydaemon beyond revisionHistoryLimit.
+// The current deployment and the one being replaced are never pruned.
+func (c *Controller) pruneDeployments(deploydaemon *v1alpha1.DeployDaemon) error {
+	deployments, err := c.controlledDeployments(deploydaemon)
+	if err != nil {
+		return err
+	}
+
+	var retired []*appsv1.Deployment
+	for _, dp := range deployments {
+		if dp.Name == deploydaemon.Status.Cluster.DeploymentName || dp.Name == deploydaemon.Status.Cluster.PreviousDeploymentName {
+			continue
+		}
+		retired = append(retired, dp)
+	}
+
+	limit := revisionHistoryLimit(deploydaemon)
+	if len(retired) <= limit {
+		return nil
+	}
+
+	// Newest first
+	sort.Slice(retired, func(i, j int) bool {
+		if !retired[i].CreationTimestamp.Equal(&retired[j].CreationTimestamp) {
+			return retired[j].CreationTimestamp.Before(&retired[i].CreationTimestamp)
+		}
+		return retired[i].Name > retired[j].Name
+	})
+
+	for _, dp := range retired[limit:] {
+		klog.Infof("prune deployment %s of deploydaemon %s", dp.Name, deploydaemon.Name)
+		if err := c.kubeclientset.AppsV1().Deployments(deploydaemon.Namespace).Delete(dp.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("prune deployment %s failed: %s", dp.Name, err.Error())
+		}
+	}
+	return nil
+}
+
+// controlledDeployments lists the deployments of every version of deploydaemon, retired ones included
+func (c *Controller) controlledDeployments(deploydaemon *v1alpha1.DeployDaemon) ([]*appsv1.Deployment, error) {
+	selector := labels.SelectorFromSet(map[string]string{"app": deploydaemon.GetDeploymentName()})
+	deployments, err := c.deploymentsLister.Deployments(deploydaemon.Namespace).List(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var controlled []*appsv1.Deployment
+	for _, dp := range deployments {
+		if metav1.IsControlledBy(dp, deploydaemon) {
+			controlled = append(controlled, dp)
+		}
+	}
+	return controlled, nil
+}
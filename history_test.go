@@ -0,0 +1,208 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecordRevision(t *testing.T) {
+	dd := newDeployDaemon("test", 1)
+	dd.Status = &v1alpha1.DeploydaemonStatus{}
+	limit := int32(1)
+	dd.Spec.RevisionHistoryLimit = &limit
+	now := time.Now()
+
+	recordRevision(dd, "demoqaauth-ts-app-9.0.1.2", "hash-1", now)
+	recordRevision(dd, "demoqaauth-ts-app-9.0.1.2", "hash-1", now)
+	if len(dd.Status.History) != 1 || dd.Status.History[0].Revision != 1 {
+		t.Fatalf("expected one revision, got %+v", dd.Status.History)
+	}
+
+	dd.Spec.Image = "registry.example.com/ts-app:9.0.1.2-hotfix"
+	recordRevision(dd, "demoqaauth-ts-app-9.0.1.2", "hash-2", now)
+	dd.Spec.Version = "9.0.1.3"
+	recordRevision(dd, "demoqaauth-ts-app-9.0.1.3", "hash-3", now)
+
+	history := dd.Status.History
+	if len(history) != 2 {
+		t.Fatalf("expected history bounded to 2 revisions, got %+v", history)
+	}
+	if history[0].Revision != 2 || history[0].Image != "registry.example.com/ts-app:9.0.1.2-hotfix" || history[0].Outcome != revisionSuperseded {
+		t.Errorf("unexpected revision %+v", history[0])
+	}
+	if history[1].Revision != 3 || history[1].Version != "9.0.1.3" || history[1].Outcome != revisionProgressing {
+		t.Errorf("unexpected revision %+v", history[1])
+	}
+}
+
+func TestSyncDeploymentRecordsRevision(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	dp := f.newSyncedDeployment(c, dd)
+
+	if err := c.syncDeployment(dd, dp); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	history := dd.Status.History
+	if len(history) != 1 || history[0].DeploymentName != dp.Name || history[0].SpecHash != dp.Annotations[specHashAnnotation] {
+		t.Fatalf("expected revision of deployment %s, got %+v", dp.Name, history)
+	}
+	if history[0].Outcome != revisionSucceeded || history[0].ReadyTime == nil {
+		t.Errorf("expected ready revision to succeed, got %+v", history[0])
+	}
+}
+
+func newRevisionedDeployDaemon() *v1alpha1.DeployDaemon {
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.Version = "9.0.1.3"
+	dd.Spec.Image = "registry.example.com/ts-app:9.0.1.3"
+	dd.Status = &v1alpha1.DeploydaemonStatus{
+		History: []v1alpha1.Revision{
+			{Revision: 1, Version: "9.0.1.1", Image: "registry.example.com/ts-app:9.0.1.1", Config: "demoqaauth", Outcome: revisionSucceeded},
+			{Revision: 2, Version: "9.0.1.2", Image: "registry.example.com/ts-app:9.0.1.2", Config: "demoqaauth-v2", Outcome: revisionSucceeded},
+			{Revision: 3, Version: "9.0.1.3", Image: "registry.example.com/ts-app:9.0.1.3", Config: "demoqaauth-v2", Outcome: revisionFailed},
+		},
+	}
+	return dd
+}
+
+func TestSyncRollbackToPreviousRevision(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newRevisionedDeployDaemon()
+	dd.Spec.RollbackTo = &v1alpha1.RollbackConfig{}
+	spec := dd.Spec.DeepCopy()
+
+	if err := c.syncRollback(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dd.Spec.Version != "9.0.1.2" || dd.Spec.Image != "registry.example.com/ts-app:9.0.1.2" || dd.Spec.Config != "demoqaauth-v2" {
+		t.Errorf("expected spec of revision 2, got %+v", dd.Spec)
+	}
+	if dd.Status.RolledBackTo == nil || dd.Status.RolledBackTo.Revision != 2 {
+		t.Errorf("expected revision 2 recorded in status, got %+v", dd.Status.RolledBackTo)
+	}
+	if dd.Status.History[2].Outcome != revisionRolledBack {
+		t.Errorf("expected revision 3 rolled back, got %s", dd.Status.History[2].Outcome)
+	}
+
+	// The next sync starts from the spec as it is stored, with the revision deployed since recorded in history
+	status := dd.Status
+	status.History = append(status.History, v1alpha1.Revision{Revision: 4, Version: "9.0.1.2", Outcome: revisionSucceeded})
+	dd = newRevisionedDeployDaemon()
+	dd.Spec = *spec
+	dd.Status = status
+	if err := c.syncRollback(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dd.Spec.Version != "9.0.1.2" || dd.Status.History[3].Outcome != revisionSucceeded {
+		t.Errorf("expected revision 2 to stay deployed while rollbackTo is set, got %+v %+v", dd.Spec, dd.Status.History)
+	}
+
+	// Removing rollbackTo deploys the spec again
+	dd = newRevisionedDeployDaemon()
+	dd.Status = status
+	if err := c.syncRollback(dd); err != nil || dd.Spec.Version != "9.0.1.3" || dd.Status.RolledBackTo != nil {
+		t.Errorf("expected the spec deployed once rollbackTo is removed, got %+v %+v %v", dd.Spec, dd.Status.RolledBackTo, err)
+	}
+}
+
+func TestSyncRollbackToRevision(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newRevisionedDeployDaemon()
+	dd.Spec.RollbackTo = &v1alpha1.RollbackConfig{Revision: 1}
+
+	if err := c.syncRollback(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if dd.Spec.Version != "9.0.1.1" || dd.Spec.Config != "demoqaauth" {
+		t.Errorf("expected spec of revision 1, got %+v", dd.Spec)
+	}
+}
+
+func TestSyncRollbackIsNotScheduled(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newRevisionedDeployDaemon()
+	dd.Spec.Scheduler = "30 2 * * 6"
+	now := time.Date(2019, 1, 2, 10, 0, 0, 0, time.UTC)
+	dd.Status.ScheduledSpecHash, _ = scheduleHash(dd.Spec)
+	dd.Spec.RollbackTo = &v1alpha1.RollbackConfig{}
+	stored := dd.DeepCopy()
+
+	if wait, _, _ := c.syncSchedule(dd, now); wait != 0 {
+		t.Fatalf("expected rollbackTo not to be scheduled, got %s", wait)
+	}
+	if err := c.syncRollback(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The restored spec is not written back, the next sync does not hold the stored one back until the cron schedule
+	stored.Status = dd.Status
+	if wait, _, _ := c.syncSchedule(stored, now); wait != 0 {
+		t.Errorf("expected the stored spec not to be scheduled, got %s", wait)
+	}
+}
+
+func TestAsDeployedRestoresRolledBackRevision(t *testing.T) {
+	dd := newRevisionedDeployDaemon()
+	if asDeployed(dd) != dd {
+		t.Errorf("expected a deploydaemon without rollbackTo to be deployed as it is")
+	}
+
+	dd.Spec.RollbackTo = &v1alpha1.RollbackConfig{}
+	dd.Status.RolledBackTo = dd.Status.History[1].DeepCopy()
+	if deployed := asDeployed(dd); deployed.Spec.Version != "9.0.1.2" || dd.Spec.Version != "9.0.1.3" {
+		t.Errorf("expected a copy deploying revision 2, got %s from %s", deployed.Spec.Version, dd.Spec.Version)
+	}
+}
+
+func TestSyncRollbackUnknownRevision(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newRevisionedDeployDaemon()
+	dd.Spec.RollbackTo = &v1alpha1.RollbackConfig{Revision: 7}
+
+	if err := c.syncRollback(dd); err == nil {
+		t.Errorf("expected error for unknown revision")
+	}
+	if dd.Spec.Version != "9.0.1.3" || dd.Status.RolledBackTo != nil {
+		t.Errorf("expected spec kept, got %+v %+v", dd.Spec, dd.Status.RolledBackTo)
+	}
+}
+
+func TestPruneDeploymentsKeepsHistoryLimit(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newDeployDaemon("test", 1)
+	limit := int32(1)
+	dd.Spec.RevisionHistoryLimit = &limit
+
+	created := time.Date(2019, 1, 5, 3, 0, 0, 0, time.UTC)
+	for i, version := range []string{"9.0.1.1", "9.0.1.2", "9.0.1.3", "9.0.1.4"} {
+		dd.Spec.Version = version
+		dp, err := c.makeDeployment(dd)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		dp.CreationTimestamp = metav1.NewTime(created.Add(time.Duration(i) * time.Hour))
+		f.kubeclient.AppsV1().Deployments(dd.Namespace).Create(dp)
+		f.kubeInformers.Apps().V1().Deployments().Informer().GetIndexer().Add(dp)
+	}
+	dd.Status = &v1alpha1.DeploydaemonStatus{Cluster: &v1alpha1.ClusterSpec{DeploymentName: deploymentNameFor(dd)}}
+
+	if err := c.pruneDeployments(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for version, kept := range map[string]bool{"9.0.1.1": false, "9.0.1.2": false, "9.0.1.3": true, "9.0.1.4": true} {
+		_, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get("demoqaauth-ts-app-"+version, metav1.GetOptions{})
+		if kept && err != nil {
+			t.Errorf("expected deployment of version %s to be kept: %v", version, err)
+		}
+		if !kept && !errors.IsNotFound(err) {
+			t.Errorf("expected deployment of version %s to be pruned, got %v", version, err)
+		}
+	}
+}
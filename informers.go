@@ -0,0 +1,133 @@
+package main
+
+import (
+	"time"
+
+	clientset "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned"
+	extInformers "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/informers/externalversions"
+	deploycontrinformer "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/informers/externalversions/deploycontrol/v1alpha1"
+	listers "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/listers/deploycontrol/v1alpha1"
+	utils "github.com/kongyi-ibm/k8s-deployment-operator/pkg/utilities"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	appsinformer "k8s.io/client-go/informers/apps/v1"
+	corev1informer "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchedInformers holds a pair of informer factories per watched namespace and the informers the controller reads,
+// each one merging the informers of that resource in every watched namespace
+type watchedInformers struct {
+	kubeFactories []kubeinformers.SharedInformerFactory
+	extFactories  []extInformers.SharedInformerFactory
+
+	deployments   appsinformer.DeploymentInformer
+	pods          corev1informer.PodInformer
+	configMaps    corev1informer.ConfigMapInformer
+	services      corev1informer.ServiceInformer
+	deploydaemons deploycontrinformer.DeployDaemonInformer
+}
+
+// newWatchedInformers creates the informers of namespaces, all namespaces when empty. Only the deploydaemons
+// matching the label selector are watched, the objects they manage are found through them.
+func newWatchedInformers(kubeClient kubernetes.Interface, extClient clientset.Interface, namespaces []string, deploydaemonSelector string, resync time.Duration) *watchedInformers {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	w := &watchedInformers{}
+	deployments := map[string]cache.SharedIndexInformer{}
+	pods := map[string]cache.SharedIndexInformer{}
+	configMaps := map[string]cache.SharedIndexInformer{}
+	services := map[string]cache.SharedIndexInformer{}
+	deploydaemons := map[string]cache.SharedIndexInformer{}
+
+	for _, ns := range namespaces {
+		kubeFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, resync,
+			kubeinformers.WithNamespace(ns))
+		extFactory := extInformers.NewSharedInformerFactoryWithOptions(extClient, resync,
+			extInformers.WithNamespace(ns),
+			extInformers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = deploydaemonSelector
+			}))
+		w.kubeFactories = append(w.kubeFactories, kubeFactory)
+		w.extFactories = append(w.extFactories, extFactory)
+
+		// Requesting the informers registers them in the factories before they are started
+		deployments[ns] = kubeFactory.Apps().V1().Deployments().Informer()
+		pods[ns] = kubeFactory.Core().V1().Pods().Informer()
+		configMaps[ns] = kubeFactory.Core().V1().ConfigMaps().Informer()
+		services[ns] = kubeFactory.Core().V1().Services().Informer()
+		deploydaemons[ns] = extFactory.Deploycontrol().V1alpha1().DeployDaemons().Informer()
+	}
+
+	w.deployments = deploymentInformer{mergeInformers(deployments)}
+	w.pods = podInformer{mergeInformers(pods)}
+	w.configMaps = configMapInformer{mergeInformers(configMaps)}
+	w.services = serviceInformer{mergeInformers(services)}
+	w.deploydaemons = deploydaemonInformer{mergeInformers(deploydaemons)}
+	return w
+}
+
+// mergeInformers returns the informer of a single namespace as is
+func mergeInformers(informers map[string]cache.SharedIndexInformer) cache.SharedIndexInformer {
+	if len(informers) == 1 {
+		for _, informer := range informers {
+			return informer
+		}
+	}
+	return utils.NewMultiNamespaceInformer(informers)
+}
+
+// Start starts the informers of every watched namespace
+func (w *watchedInformers) Start(stopCh <-chan struct{}) {
+	for _, factory := range w.kubeFactories {
+		factory.Start(stopCh)
+	}
+	for _, factory := range w.extFactories {
+		factory.Start(stopCh)
+	}
+}
+
+type deploymentInformer struct{ informer cache.SharedIndexInformer }
+
+func (i deploymentInformer) Informer() cache.SharedIndexInformer { return i.informer }
+
+func (i deploymentInformer) Lister() appslisters.DeploymentLister {
+	return appslisters.NewDeploymentLister(i.informer.GetIndexer())
+}
+
+type podInformer struct{ informer cache.SharedIndexInformer }
+
+func (i podInformer) Informer() cache.SharedIndexInformer { return i.informer }
+
+func (i podInformer) Lister() corelisters.PodLister {
+	return corelisters.NewPodLister(i.informer.GetIndexer())
+}
+
+type configMapInformer struct{ informer cache.SharedIndexInformer }
+
+func (i configMapInformer) Informer() cache.SharedIndexInformer { return i.informer }
+
+func (i configMapInformer) Lister() corelisters.ConfigMapLister {
+	return corelisters.NewConfigMapLister(i.informer.GetIndexer())
+}
+
+type serviceInformer struct{ informer cache.SharedIndexInformer }
+
+func (i serviceInformer) Informer() cache.SharedIndexInformer { return i.informer }
+
+func (i serviceInformer) Lister() corelisters.ServiceLister {
+	return corelisters.NewServiceLister(i.informer.GetIndexer())
+}
+
+type deploydaemonInformer struct{ informer cache.SharedIndexInformer }
+
+func (i deploydaemonInformer) Informer() cache.SharedIndexInformer { return i.informer }
+
+func (i deploydaemonInformer) Lister() listers.DeployDaemonLister {
+	return listers.NewDeployDaemonLister(i.informer.GetIndexer())
+}
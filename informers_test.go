@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestWatchedInformersFilterNamespacesAndDeployDaemons(t *testing.T) {
+	var kubeobjects, extobjects []runtime.Object
+	for _, ns := range []string{"team-a", "team-b", "team-c"} {
+		for _, tenant := range []string{"demo", "other"} {
+			dd := newVersionedDeployDaemon("ts-app-"+tenant, "9.0.1.2")
+			dd.Namespace = ns
+			dd.Labels = map[string]string{"tenant": tenant}
+			extobjects = append(extobjects, dd)
+		}
+		kubeobjects = append(kubeobjects, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "ts-app-0", Namespace: ns}})
+	}
+
+	informers := newWatchedInformers(k8sfake.NewSimpleClientset(kubeobjects...), fake.NewSimpleClientset(extobjects...), []string{"team-a", "team-b"}, "tenant=demo", 0)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	informers.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informers.deploydaemons.Informer().HasSynced, informers.pods.Informer().HasSynced) {
+		t.Fatal("caches not synced")
+	}
+
+	deploydaemons, _ := informers.deploydaemons.Lister().List(labels.Everything())
+	keys := map[string]bool{}
+	for _, dd := range deploydaemons {
+		keys[dd.Namespace+"/"+dd.Name] = true
+	}
+	if len(keys) != 2 || !keys["team-a/ts-app-demo"] || !keys["team-b/ts-app-demo"] {
+		t.Errorf("expected the demo deploydaemons of team-a and team-b, got %v", keys)
+	}
+
+	if _, err := informers.pods.Lister().Pods("team-b").Get("ts-app-0"); err != nil {
+		t.Errorf("expected the pod of a watched namespace, got %s", err.Error())
+	}
+	if _, err := informers.pods.Lister().Pods("team-c").Get("ts-app-0"); err == nil {
+		t.Error("expected the pod of an unwatched namespace not to be found")
+	}
+}
+
+func TestWatchedInformersAllNamespaces(t *testing.T) {
+	dd := newVersionedDeployDaemon("ts-app", "9.0.1.2")
+	informers := newWatchedInformers(k8sfake.NewSimpleClientset(), fake.NewSimpleClientset(dd), nil, "", 0)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	informers.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, informers.deploydaemons.Informer().HasSynced) {
+		t.Fatal("caches not synced")
+	}
+
+	if _, err := informers.deploydaemons.Lister().DeployDaemons(dd.Namespace).Get(dd.Name); err != nil {
+		t.Errorf("expected the deploydaemon to be watched, got %s", err.Error())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog"
+)
+
+// runLeaderElection calls run with a stop channel once this replica is elected through a ConfigMap lock named after
+// the controller, standby replicas block until they take over. The informers are started before, so a standby has
+// warm caches when it takes over. Losing the lease exits the process, unless stopCh is closed.
+func runLeaderElection(le config.LeaderElection, kubeClient kubernetes.Interface, run func(stopCh <-chan struct{}), stopCh <-chan struct{}) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		klog.Fatalf("Error getting hostname for leader election: %s", err.Error())
+	}
+	identity := fmt.Sprintf("%s_%d", hostname, os.Getpid())
+
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events(le.Namespace)})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
+
+	lock, err := resourcelock.New(resourcelock.ConfigMapsResourceLock, le.Namespace, controllerAgentName, kubeClient.CoreV1(),
+		resourcelock.ResourceLockConfig{
+			Identity:      identity,
+			EventRecorder: recorder,
+		})
+	if err != nil {
+		klog.Fatalf("Error creating leader election lock: %s", err.Error())
+	}
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: le.LeaseDuration.Duration,
+		RenewDeadline: le.RenewDeadline.Duration,
+		RetryPeriod:   le.RetryPeriod.Duration,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				klog.Infof("%s is elected leader", identity)
+				run(ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				select {
+				case <-stopCh:
+					klog.Infof("%s stops leading on shutdown", identity)
+				default:
+					klog.Fatalf("%s lost the leader election", identity)
+				}
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					klog.Infof("%s is the leader, waiting to take over", leader)
+				}
+			},
+		},
+	})
+	if err != nil {
+		klog.Fatalf("Error setting up leader election: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	klog.Infof("%s starts leader election on configmap %s/%s", identity, le.Namespace, controllerAgentName)
+	elector.Run(ctx)
+}
@@ -3,56 +3,68 @@ package main
 import (
 	"flag"
 	clientset "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned"
-	extInformers "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/informers/externalversions"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/config"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/metrics"
 	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/signals"
-	kubeinformers "k8s.io/client-go/informers"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/traffic"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/webhook"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
-	"time"
-)
-
-var (
-	masterURL string
-	kubeconfig string
+	"net/http"
+	"os"
+	"strconv"
 )
 
 func main() {
 
-	//TODO:  make those paramter as the input parameter for Debug flag
-	flag.Set("alsologtostderr", "true")
-	flag.Set("log_dir", "/tmp")
-	flag.Set("v", "4")
+	// Log to stderr unless the klog flags say otherwise
+	flag.Set("logtostderr", "true")
 
-	flag.Parse()
+	cfg, err := config.Load(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		klog.Fatalf("Error loading configuration: %s", err.Error())
+	}
+	setLogLevel(cfg.LogLevel)
 
 	klog.V(0).Info("Start deploy daemon server .....")
 
 	stopCh := signals.SetupSignalHandler()
-	// Based on input parameter to generate kube configuration
-	cfg,err := clientcmd.BuildConfigFromFlags(masterURL,kubeconfig)
+	// Based on the configuration to generate kube configuration, in cluster or out of it
+	restConfig, err := cfg.RestConfig()
 
 	if err !=nil {
 		klog.Fatalf("Error building kubeconfig: %s", err.Error())
 	}
 
 	// Based on kube configuration to generate kube client
-	kubeClient, err := kubernetes.NewForConfig(cfg)
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
 
 	if err !=nil {
 		klog.Fatalf("Error generate kubeclient: %s",err.Error())
 	}
 
 	// Based on extension object api client set to generate extension client
-	extClient, err := clientset.NewForConfig(cfg)
+	extClient, err := clientset.NewForConfig(restConfig)
 
 	if err !=nil {
 		klog.Fatalf("Error build deploycontrol client: %s", err.Error())
 	}
 
-	// Generate SharedIndexInformerFactory based on the clientset
-	kubeInformerFactory :=kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
-	extInformerFactory := extInformers.NewSharedInformerFactory(extClient, time.Second*30)
+	// The dynamic client reaches the resources without a typed client, the Istio routes and the custom resource definition
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		klog.Fatalf("Error build dynamic client: %s", err.Error())
+	}
+
+	// Traffic between versions of a component is only routed when a traffic provider is enabled
+	var trafficRouter traffic.Provider
+	if cfg.TrafficProvider == "istio" {
+		trafficRouter = traffic.NewIstioProvider(dynamicClient)
+	}
+
+	// Generate SharedIndexInformerFactory based on the clientset for every watched namespace, their informers are merged
+	informers := newWatchedInformers(kubeClient, extClient, cfg.Namespaces, cfg.DeployDaemonSelector, cfg.ResyncPeriod.Duration)
 
 
 	//NewController(
@@ -60,27 +72,82 @@ func main() {
 	//	extclientset clientset.Interface,
 	//	deploymentInformer appsinformer.DeploymentInformer,
 	//	podInformer corev1informer.PodInformer,
-	//	deploydaemonInformer deploycontrinformer.DeployDaemonInformer) *Controller
+	//	configMapInformer corev1informer.ConfigMapInformer,
+	//	serviceInformer corev1informer.ServiceInformer,
+	//	deploydaemonInformer deploycontrinformer.DeployDaemonInformer,
+	//	trafficProvider traffic.Provider,
+	//	rateLimiter workqueue.RateLimiter) *Controller
 
 	controller := NewController(kubeClient, extClient,
-		kubeInformerFactory.Apps().V1().Deployments(),
-		kubeInformerFactory.Core().V1().Pods(),
-		extInformerFactory.Deploycontrol().V1alpha1().DeployDaemons())
+		informers.deployments,
+		informers.pods,
+		informers.configMaps,
+		informers.services,
+		informers.deploydaemons,
+		trafficRouter,
+		cfg.NewRateLimiter())
+
+
+	metrics.RegisterStateCollector(
+		informers.deploydaemons.Lister(),
+		informers.pods.Lister())
+	if cfg.MetricsAddr != "" {
+		go serveMetrics(cfg.MetricsAddr)
+	}
+	if cfg.HealthAddr != "" {
+		go serveHealth(cfg.HealthAddr, controller, cfg.WorkerStallTimeout.Duration)
+	}
+	// Every replica serves the admission webhook, standby replicas included
+	if cfg.Webhook.Addr != "" {
+		go func() {
+			if err := webhook.Run(cfg.Webhook, kubeClient, dynamicClient, stopCh); err != nil {
+				klog.Fatalf("Error serving admission webhook: %s", err.Error())
+			}
+		}()
+	}
 
+	informers.Start(stopCh)
 
-	kubeInformerFactory.Start(stopCh)
-	extInformerFactory.Start(stopCh)
+	run := func(stopCh <-chan struct{}) {
+		if err := controller.Run(cfg.Workers, stopCh); err != nil {
+			klog.Fatalf("Error running controller: %s", err.Error())
+		}
+	}
 
-	if err = controller.Run(2, stopCh); err != nil {
-		klog.Fatalf("Error running controller: %s", err.Error())
+	// With several replicas only the leader runs the workers
+	if cfg.LeaderElection.Enabled {
+		runLeaderElection(cfg.LeaderElection, kubeClient, run, stopCh)
+	} else {
+		run(stopCh)
 	}
 
 	<-stopCh
 }
 
 
+// serveMetrics serves the Prometheus metrics of every replica, standby replicas included
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	klog.Infof("Serving metrics on %s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		klog.Fatalf("Error serving metrics: %s", err.Error())
+	}
+}
+
+// setLogLevel sets the klog verbosity to the configured log level, unless -v is given on the command line
+func setLogLevel(level int) {
+	verbositySet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "v" {
+			verbositySet = true
+		}
+	})
+	if !verbositySet {
+		flag.Set("v", strconv.Itoa(level))
+	}
+}
+
 func init() {
 	klog.InitFlags(nil)
-	flag.StringVar(&kubeconfig, "kubeconfig", "/Users/kongyi/.kube/config", "Path to a kubeconfig. Only required if out-of-cluster.")
-	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
-}
\ No newline at end of file
+}
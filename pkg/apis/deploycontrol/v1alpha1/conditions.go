@@ -0,0 +1,171 @@
+package v1alpha1
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConditionManager maintains the conditions of a DeployDaemon status
+type ConditionManager struct{}
+
+// GetCondition returns the condition of type condType, nil when it is not set
+func (condM ConditionManager) GetCondition(dd *DeployDaemon, condType ConditionType) *Condition {
+	if dd.Status == nil {
+		return nil
+	}
+	for i := range dd.Status.Conditions {
+		if dd.Status.Conditions[i].Type == condType {
+			return &dd.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// IsTrue returns true when the condition of type condType is set and True
+func (condM ConditionManager) IsTrue(dd *DeployDaemon, condType ConditionType) bool {
+	condition := condM.GetCondition(dd, condType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// SetCondition sets the condition of type condType for the current generation of dd. LastTransitionTime only moves
+// when the status changes. It returns true when the condition changed.
+func (condM ConditionManager) SetCondition(dd *DeployDaemon, condType ConditionType, status corev1.ConditionStatus, reason, message string) bool {
+	if dd.Status == nil {
+		dd.Status = &DeploydaemonStatus{}
+	}
+
+	condition := Condition{
+		Type:               condType,
+		Status:             status,
+		ObservedGeneration: dd.Generation,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+
+	existing := condM.GetCondition(dd, condType)
+	if existing == nil {
+		dd.Status.Conditions = append(dd.Status.Conditions, condition)
+		return true
+	}
+
+	if existing.Status == status {
+		if existing.Reason == reason && existing.Message == message && existing.ObservedGeneration == dd.Generation {
+			return false
+		}
+		condition.LastTransitionTime = existing.LastTransitionTime
+	}
+	*existing = condition
+	return true
+}
+
+// RemoveCondition removes the condition of type condType. It returns true when it was set.
+func (condM ConditionManager) RemoveCondition(dd *DeployDaemon, condType ConditionType) bool {
+	if condM.GetCondition(dd, condType) == nil {
+		return false
+	}
+
+	var conditions []Condition
+	for _, condition := range dd.Status.Conditions {
+		if condition.Type != condType {
+			conditions = append(conditions, condition)
+		}
+	}
+	dd.Status.Conditions = conditions
+	return true
+}
+
+// UpdateStatus sets the DeploymentCreated and DeploymentAvailable conditions of dd from its deployment dp.
+// A nil dp means the deployment does not exist.
+func (condM ConditionManager) UpdateStatus(dd *DeployDaemon, dp *appsv1.Deployment) {
+	if dp == nil {
+		condM.SetCondition(dd, DeploymentCreated, corev1.ConditionFalse, "DeploymentNotFound", "The deployment does not exist")
+		condM.SetCondition(dd, DeploymentAvailable, corev1.ConditionUnknown, "DeploymentNotFound", "The deployment does not exist")
+		return
+	}
+
+	condM.SetCondition(dd, DeploymentCreated, corev1.ConditionTrue, "DeploymentCreated", "Deployment "+dp.Name+" exists")
+
+	replicas := int32(1)
+	if dp.Spec.Replicas != nil {
+		replicas = *dp.Spec.Replicas
+	}
+
+	switch {
+	case dp.Status.ObservedGeneration < dp.Generation:
+		condM.SetCondition(dd, DeploymentAvailable, corev1.ConditionUnknown, "DeploymentNotObserved", "Deployment "+dp.Name+" spec is not observed yet")
+	case dp.Status.UpdatedReplicas == replicas && dp.Status.AvailableReplicas == replicas:
+		condM.SetCondition(dd, DeploymentAvailable, corev1.ConditionTrue, "ReplicasAvailable", "Deployment "+dp.Name+" has all its replicas available")
+	case isProgressDeadlineExceeded(dp):
+		condM.SetCondition(dd, DeploymentAvailable, corev1.ConditionFalse, "ProgressDeadlineExceeded", "Deployment "+dp.Name+" exceeded its progress deadline")
+	default:
+		condM.SetCondition(dd, DeploymentAvailable, corev1.ConditionFalse, "ReplicasUnavailable", "Deployment "+dp.Name+" is rolling out")
+	}
+}
+
+func isProgressDeadlineExceeded(dp *appsv1.Deployment) bool {
+	for _, condition := range dp.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyCondition is the single object the releases before the condition list wrote in status.conditions, it told
+// whether the deploydaemon was ready
+type legacyCondition struct {
+	LastUpdateTime metav1.Time `json:"lastupdatetime,omitempty"`
+	Status         bool        `json:"status,omitempty"`
+	Reason         string      `json:"reason,omitempty"`
+	Message        string      `json:"message,omitempty"`
+}
+
+// UnmarshalJSON decodes the status. The status.conditions object written by the releases before the condition list is
+// read as the Ready condition, so the deploydaemons they synced still decode, the next sync writes the list.
+func (in *DeploydaemonStatus) UnmarshalJSON(data []byte) error {
+	type status DeploydaemonStatus
+	decoded := struct {
+		*status
+		Conditions json.RawMessage `json:"conditions,omitempty"`
+	}{status: (*status)(in)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	in.Conditions = nil
+	conditions := bytes.TrimSpace(decoded.Conditions)
+	if len(conditions) == 0 || bytes.Equal(conditions, []byte("null")) {
+		return nil
+	}
+	if conditions[0] != '{' {
+		return json.Unmarshal(conditions, &in.Conditions)
+	}
+
+	var legacy legacyCondition
+	if err := json.Unmarshal(conditions, &legacy); err != nil {
+		return err
+	}
+	// An object left empty never recorded a sync
+	if legacy.Reason == "" && legacy.Message == "" && !legacy.Status {
+		return nil
+	}
+	ready := Condition{
+		Type:               Ready,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: legacy.LastUpdateTime,
+		// The reasons were sentences, e.g. "All Status Synced"
+		Reason:  strings.Replace(legacy.Reason, " ", "", -1),
+		Message: legacy.Message,
+	}
+	if legacy.Status {
+		ready.Status = corev1.ConditionTrue
+	}
+	in.Conditions = []Condition{ready}
+	return nil
+}
@@ -0,0 +1,128 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetConditionKeepsTransitionTime(t *testing.T) {
+	condM := ConditionManager{}
+	dd := &DeployDaemon{ObjectMeta: metav1.ObjectMeta{Generation: 1}}
+
+	if !condM.SetCondition(dd, Ready, corev1.ConditionFalse, "DeploymentProgressing", "Waiting Pod Status Ready") {
+		t.Fatalf("expected new condition to be a change")
+	}
+	transition := metav1.NewTime(time.Date(2019, 1, 5, 3, 0, 0, 0, time.UTC))
+	dd.Status.Conditions[0].LastTransitionTime = transition
+
+	if condM.SetCondition(dd, Ready, corev1.ConditionFalse, "DeploymentProgressing", "Waiting Pod Status Ready") {
+		t.Errorf("expected identical condition not to be a change")
+	}
+
+	dd.Generation = 2
+	condM.SetCondition(dd, Ready, corev1.ConditionFalse, "ExposeSyncFailed", "exposePercent 120 is out of range 0-100")
+	condition := condM.GetCondition(dd, Ready)
+	if !condition.LastTransitionTime.Equal(&transition) || condition.Reason != "ExposeSyncFailed" || condition.ObservedGeneration != 2 {
+		t.Errorf("expected reason and generation to change without transition, got %+v", *condition)
+	}
+
+	condM.SetCondition(dd, Ready, corev1.ConditionTrue, "Synced", "Deployment success!")
+	if condition := condM.GetCondition(dd, Ready); condition.LastTransitionTime.Equal(&transition) {
+		t.Errorf("expected status change to move the transition time")
+	}
+	if !condM.IsTrue(dd, Ready) || len(dd.Status.Conditions) != 1 {
+		t.Errorf("expected a single Ready condition, got %+v", dd.Status.Conditions)
+	}
+}
+
+func TestRemoveCondition(t *testing.T) {
+	condM := ConditionManager{}
+	dd := &DeployDaemon{}
+	condM.SetCondition(dd, Scheduled, corev1.ConditionTrue, "ScheduleDue", "")
+	condM.SetCondition(dd, Ready, corev1.ConditionTrue, "Synced", "")
+
+	if !condM.RemoveCondition(dd, Scheduled) || condM.GetCondition(dd, Scheduled) != nil || !condM.IsTrue(dd, Ready) {
+		t.Errorf("expected only Scheduled to be removed, got %+v", dd.Status.Conditions)
+	}
+	if condM.RemoveCondition(dd, Scheduled) {
+		t.Errorf("expected removing a missing condition not to be a change")
+	}
+}
+
+func TestUpdateStatusFromDeployment(t *testing.T) {
+	replicas := int32(2)
+	progressDeadline := appsv1.DeploymentCondition{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded"}
+
+	cases := []struct {
+		name      string
+		dp        *appsv1.Deployment
+		created   corev1.ConditionStatus
+		available corev1.ConditionStatus
+		reason    string
+	}{
+		{"missing", nil, corev1.ConditionFalse, corev1.ConditionUnknown, "DeploymentNotFound"},
+		{"not observed", &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Generation: 2}, Spec: appsv1.DeploymentSpec{Replicas: &replicas}, Status: appsv1.DeploymentStatus{ObservedGeneration: 1}},
+			corev1.ConditionTrue, corev1.ConditionUnknown, "DeploymentNotObserved"},
+		{"available", &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: &replicas}, Status: appsv1.DeploymentStatus{UpdatedReplicas: 2, AvailableReplicas: 2}},
+			corev1.ConditionTrue, corev1.ConditionTrue, "ReplicasAvailable"},
+		{"rolling out", &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: &replicas}, Status: appsv1.DeploymentStatus{UpdatedReplicas: 1, AvailableReplicas: 2}},
+			corev1.ConditionTrue, corev1.ConditionFalse, "ReplicasUnavailable"},
+		{"stuck", &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Replicas: &replicas}, Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{progressDeadline}}},
+			corev1.ConditionTrue, corev1.ConditionFalse, "ProgressDeadlineExceeded"},
+	}
+
+	for _, tc := range cases {
+		condM := ConditionManager{}
+		dd := &DeployDaemon{}
+		condM.UpdateStatus(dd, tc.dp)
+
+		if created := condM.GetCondition(dd, DeploymentCreated); created.Status != tc.created {
+			t.Errorf("%s: expected DeploymentCreated %s, got %s", tc.name, tc.created, created.Status)
+		}
+		available := condM.GetCondition(dd, DeploymentAvailable)
+		if available.Status != tc.available || available.Reason != tc.reason {
+			t.Errorf("%s: expected DeploymentAvailable %s %s, got %s %s", tc.name, tc.available, tc.reason, available.Status, available.Reason)
+		}
+	}
+}
+
+func TestUnmarshalLegacyConditions(t *testing.T) {
+	// The status written by the releases before the condition list
+	legacy := `{"cluster":{"deployment":"demoqaauth-ts-app-9.0.1.2"},"conditions":{"lastupdatetime":"2019-01-05T03:00:00Z","status":true,"reason":"All Status Synced","message":"Deployment success!"}}`
+	var status DeploydaemonStatus
+	if err := json.Unmarshal([]byte(legacy), &status); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []Condition{{
+		Type:               Ready,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.NewTime(time.Date(2019, 1, 5, 3, 0, 0, 0, time.UTC)),
+		Reason:             "AllStatusSynced",
+		Message:            "Deployment success!",
+	}}
+	if !equality.Semantic.DeepEqual(status.Conditions, expected) {
+		t.Errorf("expected the Ready condition %+v, got %+v", expected, status.Conditions)
+	}
+	if status.Cluster == nil || status.Cluster.DeploymentName != "demoqaauth-ts-app-9.0.1.2" {
+		t.Errorf("expected the rest of the status to be decoded, got %+v", status.Cluster)
+	}
+
+	// An empty object never recorded a sync
+	status = DeploydaemonStatus{}
+	if err := json.Unmarshal([]byte(`{"conditions":{"lastupdatetime":null}}`), &status); err != nil || status.Conditions != nil {
+		t.Errorf("expected no condition, got %+v %v", status.Conditions, err)
+	}
+
+	// The condition list round trips
+	data, _ := json.Marshal(&DeploydaemonStatus{ObservedGeneration: 2, Conditions: expected})
+	status = DeploydaemonStatus{}
+	if err := json.Unmarshal(data, &status); err != nil || status.ObservedGeneration != 2 || !equality.Semantic.DeepEqual(status.Conditions, expected) {
+		t.Errorf("expected %s to round trip, got %+v %v", data, status, err)
+	}
+}
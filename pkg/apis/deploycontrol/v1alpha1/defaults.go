@@ -0,0 +1,59 @@
+package v1alpha1
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Labels stamped on every DeployDaemon from its spec, so they can be selected with kubectl
+const (
+	TenantLabel      = "tenant"
+	EnvironmentLabel = "environment"
+	ComponentLabel   = "component"
+	VersionLabel     = "version"
+)
+
+const (
+	// DefaultInstance is the number of pods of a DeployDaemon without instance
+	DefaultInstance int32 = 1
+	// DefaultExpose is the expose of a new version without expose, it is deployed without receiving traffic
+	DefaultExpose = "offline"
+)
+
+// SetDeployDaemonDefaults fills the fields of the spec left empty, lower-cases the tenant, environment and envtype
+// and stamps the standard labels. old is the DeployDaemon being updated, nil on a create: expose defaults to offline
+// on a create or a new version, the same version keeps its previous expose.
+func SetDeployDaemonDefaults(dd, old *DeployDaemon) {
+	spec := &dd.Spec
+
+	if spec.Replica == nil {
+		instance := DefaultInstance
+		spec.Replica = &instance
+	}
+	if spec.Expose == "" {
+		spec.Expose = DefaultExpose
+		if old != nil && old.Spec.Version == spec.Version && old.Spec.Expose != "" {
+			spec.Expose = old.Spec.Expose
+		}
+	}
+	spec.Tenant = strings.ToLower(spec.Tenant)
+	spec.Environment = strings.ToLower(spec.Environment)
+	spec.EnvType = strings.ToLower(spec.EnvType)
+
+	for _, label := range []struct{ key, value string }{
+		{TenantLabel, spec.Tenant},
+		{EnvironmentLabel, spec.Environment},
+		{ComponentLabel, spec.Component},
+		{VersionLabel, spec.Version},
+	} {
+		// An invalid value is left to the validation of the spec, the API server would reject the label instead
+		if label.value == "" || len(validation.IsValidLabelValue(label.value)) > 0 {
+			continue
+		}
+		if dd.Labels == nil {
+			dd.Labels = map[string]string{}
+		}
+		dd.Labels[label.key] = label.value
+	}
+}
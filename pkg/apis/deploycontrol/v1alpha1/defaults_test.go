@@ -0,0 +1,100 @@
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newDefaultedDeployDaemon() *DeployDaemon {
+	instance := int32(3)
+	dd := &DeployDaemon{Spec: DeploydaemonSpec{
+		Tenant:      "demo",
+		Environment: "qa",
+		EnvType:     "auth",
+		Component:   "ts-app",
+		Version:     "9.0.1.2",
+		Expose:      "online",
+		Replica:     &instance,
+	}}
+	SetDeployDaemonDefaults(dd, nil)
+	return dd
+}
+
+func TestSetDeployDaemonDefaults(t *testing.T) {
+	dd := &DeployDaemon{Spec: DeploydaemonSpec{
+		Tenant:      "Demo",
+		Environment: "QA",
+		EnvType:     "Auth",
+		Component:   "ts-app",
+		Version:     "9.0.1.2",
+	}}
+	SetDeployDaemonDefaults(dd, nil)
+
+	if dd.Spec.Replica == nil || *dd.Spec.Replica != DefaultInstance {
+		t.Errorf("expected instance %d, got %v", DefaultInstance, dd.Spec.Replica)
+	}
+	if dd.Spec.Expose != DefaultExpose {
+		t.Errorf("expected expose %s, got %s", DefaultExpose, dd.Spec.Expose)
+	}
+	if dd.Spec.Tenant != "demo" || dd.Spec.Environment != "qa" || dd.Spec.EnvType != "auth" {
+		t.Errorf("expected lower-case names, got %s/%s/%s", dd.Spec.Tenant, dd.Spec.Environment, dd.Spec.EnvType)
+	}
+	expected := map[string]string{TenantLabel: "demo", EnvironmentLabel: "qa", ComponentLabel: "ts-app", VersionLabel: "9.0.1.2"}
+	if !reflect.DeepEqual(dd.Labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, dd.Labels)
+	}
+
+	// Defaults are idempotent
+	defaulted := dd.DeepCopy()
+	SetDeployDaemonDefaults(defaulted, nil)
+	if !reflect.DeepEqual(defaulted, dd) {
+		t.Errorf("expected defaults to be applied once, got %+v", defaulted)
+	}
+}
+
+func TestSetDeployDaemonDefaultsKeepsSetFields(t *testing.T) {
+	dd := newDefaultedDeployDaemon()
+	dd.Labels["team"] = "payments"
+	dd.Labels[VersionLabel] = "9.0.1.1"
+
+	SetDeployDaemonDefaults(dd, nil)
+	if *dd.Spec.Replica != 3 || dd.Spec.Expose != "online" {
+		t.Errorf("expected instance and expose to be kept, got %d and %s", *dd.Spec.Replica, dd.Spec.Expose)
+	}
+	if dd.Labels["team"] != "payments" || dd.Labels[VersionLabel] != "9.0.1.2" {
+		t.Errorf("expected other labels to be kept and the version label to follow the spec, got %v", dd.Labels)
+	}
+}
+
+func TestSetDeployDaemonDefaultsExposeOnUpdate(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		version string
+		expose  string
+	}{
+		{"same version keeps its expose", "9.0.1.2", "online"},
+		{"new version is offline", "9.0.1.3", DefaultExpose},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			old := newDefaultedDeployDaemon()
+			dd := old.DeepCopy()
+			dd.Spec.Version = test.version
+			dd.Spec.Expose = ""
+
+			SetDeployDaemonDefaults(dd, old)
+			if dd.Spec.Expose != test.expose {
+				t.Errorf("expected expose %s, got %s", test.expose, dd.Spec.Expose)
+			}
+		})
+	}
+}
+
+func TestSetDeployDaemonDefaultsSkipsInvalidLabelValues(t *testing.T) {
+	dd := &DeployDaemon{Spec: DeploydaemonSpec{Tenant: "demo", Component: "ts-app", Version: "9.0.1-"}}
+	SetDeployDaemonDefaults(dd, nil)
+
+	expected := map[string]string{TenantLabel: "demo", ComponentLabel: "ts-app"}
+	if !reflect.DeepEqual(dd.Labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, dd.Labels)
+	}
+}
@@ -3,11 +3,23 @@ package v1alpha1
 import (
 	"fmt"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// DeployDaemon deploys a version of a component of a tenant environment and exposes its pods
+// +kubebuilder:resource:path=deploydaemons,shortName=dd
+// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.instance,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Component",type="string",JSONPath=".spec.component"
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".spec.version"
+// +kubebuilder:printcolumn:name="Expose",type="string",JSONPath=".spec.expose"
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".spec.instance"
+// +kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.deploymentStatus.readyReplicas"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type DeployDaemon struct {
 
 	// TypeMeta is the metadata for the resource, like kind and apiversion
@@ -22,8 +34,11 @@ type DeployDaemon struct {
 	//  - ... etc ...
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
+	// Spec is the version of the component to deploy and how to expose it
 	Spec DeploydaemonSpec `json:"spec"`
 
+	// Status is the state of the deployed spec, written by the controller
+	// +optional
 	Status *DeploydaemonStatus `json:"status"`
 }
 
@@ -36,6 +51,7 @@ func (d DeployDaemon) String() string {
 	_output+=fmt.Sprintln("Version: ", d.Spec.Version)
 	_output+=fmt.Sprintln("Expose: ", d.Spec.Expose)
 	_output+=fmt.Sprintln("ConfigRef: ", d.Spec.Config)
+	_output+=fmt.Sprintln("TemplateRef: ", d.Spec.TemplateRef)
 
 	return _output
 }
@@ -55,29 +71,143 @@ type DeployDaemonList struct {
 
 
 type DeploydaemonSpec struct {
+	// Component is the application deployed, the last part of the deployment and Service names
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
 	Component string `json:"component"`
+	// Tenant starts the deployment and Service names, it is lower-cased
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z][-a-zA-Z0-9]*$`
 	Tenant string `json:"tenant"`
+	// Environment follows the tenant in the deployment and Service names, it is lower-cased
+	// +kubebuilder:validation:Pattern=`^[-a-zA-Z0-9]+$`
 	Environment string `json:"environment"`
+	// EnvType follows the environment in the deployment and Service names, it is lower-cased
+	// +kubebuilder:validation:Pattern=`^[-a-zA-Z0-9]+$`
 	EnvType   string   `json:"envtype"`
+	// Scheduler deploys a new image, version, pod template, config or secrets at an RFC3339 time, e.g.
+	// "2019-01-05T03:00:00Z", after a delay, e.g. "10m", or at the next time of a cron schedule in UTC, e.g. "30 2 * * 6".
+	// Changes of the other fields, e.g. instance, expose, offlinePods or weight, are not scheduled, they are synced on
+	// the deployed version while the new one waits.
+	// +optional
 	Scheduler string `json:"scheduler,omitempty"`
-    Image     string  `json:"image"`
+	// Image is the image of the application container
+	Image     string  `json:"image"`
+	// Version names the deployment of the spec next to the other versions of the component
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`
 	Version   string `json:"version"`
+	// Config is the name of a ConfigMap whose keys are set as environment variables
+	// +optional
+	// +kubebuilder:validation:Pattern=`^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*)?$`
 	Config    string `json:"configRef"`
-	Secrets   []SecretsRef  `json:"secretRefs"'`
+	// Secrets are keys of Secrets set as environment variables
+	// +optional
+	Secrets   []SecretsRef  `json:"secretRefs"`
+	// Expose labels the pods online, receiving traffic, or offline, offline for a new version when not set
+	// +optional
+	// +kubebuilder:validation:Enum=online;offline
 	Expose    string `json:"expose"`
+	// Replica is the number of pods, 1 when not set
+	// +optional
+	// +kubebuilder:validation:Minimum=0
 	Replica   *int32 `json:"instance"`
+	// ExposePercent is the percentage of ready pods labeled online when expose is online, the rest is offline.
+	// All pods follow expose when it is not set.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	ExposePercent *int32 `json:"exposePercent,omitempty"`
+	// OfflinePods are names of pods kept offline whatever expose is, e.g. to debug a single replica.
+	// They are left out of the exposePercent pool.
+	// +optional
+	OfflinePods []string `json:"offlinePods,omitempty"`
+	// Ports are exposed by the Service shared by every version of the component, port 80 when none declares any
+	// +optional
+	Ports []corev1.ServicePort `json:"ports,omitempty"`
+	// Weight is the share of the component traffic routed to this version by the traffic provider.
+	// Weights of the online versions, 100 when not set, are scaled to 100, offline versions get none.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Weight *int32 `json:"weight,omitempty"`
+	// TemplateRef is the name of a ConfigMap in the same namespace holding the pod template under the "template" key
+	// +optional
+	// +kubebuilder:validation:Pattern=`^([a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*)?$`
+	TemplateRef string `json:"templateRef,omitempty"`
+	// Strategy controls how a new version is exposed, the new version replaces the previous one at once when not set
+	// +optional
+	Strategy *DeployStrategy `json:"strategy,omitempty"`
+	// RollbackTo deploys a revision of status.history in place of the spec until it is removed
+	// +optional
+	RollbackTo *RollbackConfig `json:"rollbackTo,omitempty"`
+	// RevisionHistoryLimit is the number of retired deployments kept scaled down for a rollback, 10 when not set
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+	// DrainPeriod is how long the pods stay running offline once the deploydaemon is deleted, 30s when not set
+	// +optional
+	DrainPeriod *metav1.Duration `json:"drainPeriod,omitempty"`
+}
+
+type RollbackConfig struct {
+	// Revision to roll back to, 0 rolls back to the revision before the current one
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Revision int64 `json:"revision,omitempty"`
+}
+
+type DeployStrategy struct {
+	// Canary exposes the new version step by step next to the previous one
+	// +optional
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+	// BlueGreen deploys the new version offline as a preview and switches all the exposure to it once promoted.
+	// Canary is used when both are set.
+	// +optional
+	BlueGreen *BlueGreenStrategy `json:"blueGreen,omitempty"`
+}
+
+type BlueGreenStrategy struct {
+	// AutoPromoteAfter promotes the preview once it has been ready for this long, only the promote annotation does when not set
+	// +optional
+	AutoPromoteAfter *metav1.Duration `json:"autoPromoteAfter,omitempty"`
+	// ScaleDownDelay keeps the deployment of the previous version after the promotion for an instant rollback, 30s when not set
+	// +optional
+	ScaleDownDelay *metav1.Duration `json:"scaleDownDelay,omitempty"`
+}
+
+type CanaryStrategy struct {
+	// Steps are run in order when the version changes, the new version is fully exposed after the last one
+	// +kubebuilder:validation:MinItems=1
+	Steps []CanaryStep `json:"steps"`
+}
+
+// CanaryStep sets the exposure of the new version, then waits for pause before the next step
+type CanaryStep struct {
+	// SetWeight is the percentage of exposure given to the new version, the previous version gets the rest
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	SetWeight *int32 `json:"setWeight,omitempty"`
+	// Pause is how long to stay at this step, e.g. "5m"
+	// +optional
+	Pause *metav1.Duration `json:"pause,omitempty"`
 }
 
 
 
 // Define Secret Reference, Support associate with multiple secret as environment parameter
 type SecretsRef struct{
+	// Name is the environment variable, read from the key of the same name in the Secret
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z][-._a-zA-Z0-9]*$`
 	Name string `json:"paramName"`
+	// Secret is the name of the Secret
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
 	Secret string `json:"secretName"`
 }
 
 type DeploydaemonStatus struct {
 
+	// ObservedGeneration is the generation of the spec the status was last synced from.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
 	Cluster *ClusterSpec `json:"cluster,omitempty"`
 
 	// StartTime is the time the build is actually started.
@@ -88,44 +218,161 @@ type DeploydaemonStatus struct {
 	// +optional
 	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
 
+	// NextScheduleTime is the time the scheduler will deploy the spec, empty once it is deployed.
+	// +optional
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+
+	// LastScheduleTime is the time the scheduler last deployed the spec.
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// ScheduledSpecHash is the hash of the spec NextScheduleTime and LastScheduleTime refer to.
+	// +optional
+	ScheduledSpecHash string `json:"scheduledSpecHash,omitempty"`
+
+	// DrainStartTime is the time the pods were taken offline after the deploydaemon was deleted.
+	// +optional
+	DrainStartTime *metav1.Time `json:"drainStartTime,omitempty"`
+
 	// Define Current Deploy Daemon Status
-	Conditions ConditionsSpec `json:"conditions,omitempty"`
+	// +optional
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// Define Pod Expose Status
+	Expose *ExposeStatus `json:"expose,omitempty"`
+
+	// Define Canary Rollout Status of the current version
+	// +optional
+	Canary *CanaryStatus `json:"canary,omitempty"`
+
+	// Define Blue/Green Rollout Status of the current version
+	// +optional
+	BlueGreen *BlueGreenStatus `json:"blueGreen,omitempty"`
+
+	// Define Revision History, oldest first
+	// +optional
+	History []Revision `json:"history,omitempty"`
+
+	// RolledBackTo is the revision spec.rollbackTo restored, it is deployed in place of the spec until rollbackTo
+	// is removed.
+	// +optional
+	RolledBackTo *Revision `json:"rolledBackTo,omitempty"`
+
+	// Replicas is the number of pods of the deployment of the current version, read by the scale subresource.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Selector is the label selector of the pods of the current version, HorizontalPodAutoscalers scaling the
+	// deploydaemon measure those pods.
+	// +optional
+	Selector string `json:"selector,omitempty"`
 
 	// Define Deployment Status
 	Deployment appsv1.DeploymentStatus `json:"deploymentStatus,omitempty"`
 }
 
+// Revision records a spec the deploydaemon deployed
+type Revision struct {
+	Revision       int64        `json:"revision"`
+	Version        string       `json:"version"`
+	Image          string       `json:"image"`
+	Config         string       `json:"configRef,omitempty"`
+	Secrets        []SecretsRef `json:"secretRefs,omitempty"`
+	TemplateRef    string       `json:"templateRef,omitempty"`
+	SpecHash       string       `json:"specHash"`
+	DeploymentName string       `json:"deployment"`
+	// DeployTime is the time the revision was deployed
+	// +optional
+	DeployTime *metav1.Time `json:"deployTime,omitempty"`
+	// ReadyTime is the time the deployment of the revision was first ready
+	// +optional
+	ReadyTime *metav1.Time `json:"readyTime,omitempty"`
+	// Outcome is one of Progressing, Succeeded, Failed, Superseded or RolledBack
+	Outcome string `json:"outcome"`
+}
+
 type ClusterSpec struct{
 	Name      string   `json:"name,omitempty"`
 	NameSpace string `json:"namespace,omitempty"`
 	DeploymentName string `json:"deployment,omitempty"`
+	// PreviousDeploymentName is the deployment of the replaced version, it is retired once DeploymentName is ready
+	PreviousDeploymentName string `json:"previousDeployment,omitempty"`
+	// ServiceName is the Service shared by every version of the component
+	ServiceName string `json:"service,omitempty"`
 }
 
-type ConditionsSpec struct{
-	LastUpdateTime metav1.Time `json:"lastupdatetime,omitempty"`
-	Type           string      `json:"type,omitempty"`
-	Status         bool      `json:"status,omitempty"`
-	Reason         string    `json:"reason,omitempty"`
-	Message        string   `json:"message,omitempty"`
+type ExposeStatus struct {
+	// OnlineReplicas is the number of pods labeled online
+	OnlineReplicas int32 `json:"onlineReplicas"`
+	// OfflineReplicas is the number of pods labeled offline
+	OfflineReplicas int32 `json:"offlineReplicas"`
+	// Percent is the achieved percentage of online pods among the ready pods, pods in OfflinePods excluded
+	Percent int32 `json:"percent"`
+	// OfflinePods are the existing pods kept offline by spec.offlinePods
+	OfflinePods []string `json:"offlinePods,omitempty"`
 }
 
-
-type ConditionManager struct {
-   status DeploydaemonStatus
+type BlueGreenStatus struct {
+	// Version is the version deployed as a preview
+	Version string `json:"version"`
+	// ActiveVersion is the version exposed until Version is promoted
+	ActiveVersion string `json:"activeVersion"`
+	// Phase is one of Preview, Promoted or Completed
+	Phase string `json:"phase"`
+	// PreviewStartTime is the time Version was ready as a preview
+	// +optional
+	PreviewStartTime *metav1.Time `json:"previewStartTime,omitempty"`
+	// PromoteTime is the time Version was promoted
+	// +optional
+	PromoteTime *metav1.Time `json:"promoteTime,omitempty"`
 }
 
-
-func (condM ConditionManager) UpdateStatus(dd *DeployDaemon, dp *appsv1.Deployment) {
-	//here we update or create new status for DeployDaemon
+type CanaryStatus struct {
+	// Version is the version rolled out by the canary
+	Version string `json:"version"`
+	// StableVersion is the version the canary replaces
+	StableVersion string `json:"stableVersion"`
+	// CurrentStep is the index of the running step, the number of steps once they are all done
+	CurrentStep int32 `json:"currentStep"`
+	// Weight is the percentage of exposure given to Version
+	Weight int32 `json:"weight"`
+	// Phase is one of Progressing, Paused, Completed or Aborted
+	Phase string `json:"phase"`
+	// StepStartTime is the time the running step started
+	// +optional
+	StepStartTime *metav1.Time `json:"stepStartTime,omitempty"`
 }
 
-var condManager ConditionManager
+// ConditionType is the type of a DeployDaemon condition
+type ConditionType string
+
+const (
+	// DeploymentCreated is True once the deployment of the current version exists
+	DeploymentCreated ConditionType = "DeploymentCreated"
+	// DeploymentAvailable is True when all the replicas of the deployment are updated and available
+	DeploymentAvailable ConditionType = "DeploymentAvailable"
+	// ExposeSynced is True when the expose label of every pod matches the spec
+	ExposeSynced ConditionType = "ExposeSynced"
+	// Scheduled is False while a scheduled spec waits for its time, it is only set when the spec has a scheduler
+	Scheduled ConditionType = "Scheduled"
+	// Ready is True when everything the spec asks for is synced
+	Ready ConditionType = "Ready"
+	// Degraded is True when the sync failed for another reason than waiting for the cluster
+	Degraded ConditionType = "Degraded"
+)
 
-func init(){
-	condManager = ConditionManager{}
+type Condition struct {
+	Type   ConditionType          `json:"type"`
+	Status corev1.ConditionStatus `json:"status"`
+	// ObservedGeneration is the generation of the deploydaemon the condition was computed from
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastTransitionTime is the last time the status changed
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// Reason is a CamelCase reason for the last transition
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
 }
-
-
-
-
-
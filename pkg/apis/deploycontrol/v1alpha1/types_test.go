@@ -1,2 +1,29 @@
 package v1alpha1
 
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSecretRefsWireFormat(t *testing.T) {
+	// The secretRefs tag once carried a stray quote, which go vet rejects but encoding/json read as secretRefs.
+	// Fixing it must keep the DeployDaemons already stored readable.
+	stored := []byte(`{"secretRefs":[{"paramName":"VAULT_TOKEN","secretName":"demoqaauth-vaulttoken"}]}`)
+	var spec DeploydaemonSpec
+	if err := json.Unmarshal(stored, &spec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(spec.Secrets) != 1 || spec.Secrets[0].Name != "VAULT_TOKEN" || spec.Secrets[0].Secret != "demoqaauth-vaulttoken" {
+		t.Fatalf("expected the stored secretRefs to be read, got %+v", spec.Secrets)
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	json.Unmarshal(data, &fields)
+	if string(fields["secretRefs"]) != `[{"paramName":"VAULT_TOKEN","secretName":"demoqaauth-vaulttoken"}]` {
+		t.Errorf("expected secretRefs to be written unchanged, got %s", data)
+	}
+}
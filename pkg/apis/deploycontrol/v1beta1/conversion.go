@@ -0,0 +1,375 @@
+package v1beta1
+
+import (
+	"strings"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SchedulerAnnotation keeps the v1alpha1 scheduler of a deploydaemon read as v1beta1 when its schedule does not write
+// it back the same way, e.g. a time with a time zone or a duration like "90s", so a v1alpha1 client reads it unchanged
+const SchedulerAnnotation = "deploycontrol.k8s.io/v1alpha1-scheduler"
+
+// ConvertFromV1alpha1 returns the v1beta1 version of in, in is left unchanged
+func ConvertFromV1alpha1(in *v1alpha1.DeployDaemon) *DeployDaemon {
+	in = in.DeepCopy()
+	out := &DeployDaemon{
+		TypeMeta:   in.TypeMeta,
+		ObjectMeta: in.ObjectMeta,
+	}
+	if out.APIVersion != "" {
+		out.APIVersion = SchemeGroupVersion.String()
+	}
+
+	spec := &in.Spec
+	out.Spec = DeployDaemonSpec{
+		Tenant:               spec.Tenant,
+		Environment:          spec.Environment,
+		EnvType:              spec.EnvType,
+		Component:            spec.Component,
+		Version:              spec.Version,
+		Image:                spec.Image,
+		Replicas:             spec.Replica,
+		Schedule:             parseScheduler(spec.Scheduler),
+		ConfigRef:            spec.Config,
+		SecretRefs:           secretRefsFromV1alpha1(spec.Secrets),
+		TemplateRef:          spec.TemplateRef,
+		Expose:               spec.Expose,
+		ExposePercent:        spec.ExposePercent,
+		OfflinePods:          spec.OfflinePods,
+		Ports:                spec.Ports,
+		Weight:               spec.Weight,
+		Strategy:             strategyFromV1alpha1(spec.Strategy),
+		RevisionHistoryLimit: spec.RevisionHistoryLimit,
+		DrainPeriod:          spec.DrainPeriod,
+	}
+	if spec.RollbackTo != nil {
+		out.Spec.RollbackTo = &RollbackConfig{Revision: spec.RollbackTo.Revision}
+	}
+	delete(out.Annotations, SchedulerAnnotation)
+	if formatSchedule(out.Spec.Schedule) != spec.Scheduler {
+		if out.Annotations == nil {
+			out.Annotations = map[string]string{}
+		}
+		out.Annotations[SchedulerAnnotation] = spec.Scheduler
+	}
+
+	if in.Status != nil {
+		out.Status = statusFromV1alpha1(in.Status)
+	}
+	return out
+}
+
+// ConvertToV1alpha1 returns the v1alpha1 version of in, in is left unchanged
+func ConvertToV1alpha1(in *DeployDaemon) *v1alpha1.DeployDaemon {
+	in = in.DeepCopy()
+	out := &v1alpha1.DeployDaemon{
+		TypeMeta:   in.TypeMeta,
+		ObjectMeta: in.ObjectMeta,
+	}
+	if out.APIVersion != "" {
+		out.APIVersion = v1alpha1.SchemeGroupVersion.String()
+	}
+
+	spec := &in.Spec
+	out.Spec = v1alpha1.DeploydaemonSpec{
+		Tenant:               spec.Tenant,
+		Environment:          spec.Environment,
+		EnvType:              spec.EnvType,
+		Component:            spec.Component,
+		Version:              spec.Version,
+		Image:                spec.Image,
+		Replica:              spec.Replicas,
+		Scheduler:            formatSchedule(spec.Schedule),
+		Config:               spec.ConfigRef,
+		Secrets:              secretRefsToV1alpha1(spec.SecretRefs),
+		TemplateRef:          spec.TemplateRef,
+		Expose:               spec.Expose,
+		ExposePercent:        spec.ExposePercent,
+		OfflinePods:          spec.OfflinePods,
+		Ports:                spec.Ports,
+		Weight:               spec.Weight,
+		Strategy:             strategyToV1alpha1(spec.Strategy),
+		RevisionHistoryLimit: spec.RevisionHistoryLimit,
+		DrainPeriod:          spec.DrainPeriod,
+	}
+	if spec.RollbackTo != nil {
+		out.Spec.RollbackTo = &v1alpha1.RollbackConfig{Revision: spec.RollbackTo.Revision}
+	}
+	// The annotation is only trusted while the schedule is the one it was written for
+	if scheduler, ok := out.Annotations[SchedulerAnnotation]; ok {
+		if formatSchedule(parseScheduler(scheduler)) == out.Spec.Scheduler {
+			out.Spec.Scheduler = scheduler
+		}
+		delete(out.Annotations, SchedulerAnnotation)
+		if len(out.Annotations) == 0 {
+			out.Annotations = nil
+		}
+	}
+
+	if in.Status != nil {
+		out.Status = statusToV1alpha1(in.Status)
+	}
+	return out
+}
+
+// parseScheduler returns the schedule of a v1alpha1 scheduler, tried as a time, a duration then a cron schedule the
+// way the controller parses it. A scheduler the controller rejects is kept as a cron schedule.
+func parseScheduler(scheduler string) *Schedule {
+	scheduler = strings.TrimSpace(scheduler)
+	if scheduler == "" {
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339, scheduler); err == nil {
+		at := metav1.NewTime(t)
+		return &Schedule{At: &at}
+	}
+	if d, err := time.ParseDuration(scheduler); err == nil {
+		return &Schedule{Delay: &metav1.Duration{Duration: d}}
+	}
+	return &Schedule{Cron: scheduler}
+}
+
+// formatSchedule returns the v1alpha1 scheduler of schedule. Only one of the fields of a valid schedule is set, the
+// first one set is used otherwise.
+func formatSchedule(schedule *Schedule) string {
+	switch {
+	case schedule == nil:
+		return ""
+	case schedule.At != nil:
+		return schedule.At.UTC().Format(time.RFC3339)
+	case schedule.Delay != nil:
+		return schedule.Delay.Duration.String()
+	}
+	return schedule.Cron
+}
+
+func secretRefsFromV1alpha1(in []v1alpha1.SecretsRef) []SecretRef {
+	if in == nil {
+		return nil
+	}
+	out := make([]SecretRef, len(in))
+	for i, ref := range in {
+		out[i] = SecretRef{EnvName: ref.Name, SecretName: ref.Secret}
+	}
+	return out
+}
+
+func secretRefsToV1alpha1(in []SecretRef) []v1alpha1.SecretsRef {
+	if in == nil {
+		return nil
+	}
+	out := make([]v1alpha1.SecretsRef, len(in))
+	for i, ref := range in {
+		out[i] = v1alpha1.SecretsRef{Name: ref.EnvName, Secret: ref.SecretName}
+	}
+	return out
+}
+
+func strategyFromV1alpha1(in *v1alpha1.DeployStrategy) *DeployStrategy {
+	if in == nil {
+		return nil
+	}
+	out := &DeployStrategy{}
+	if in.Canary != nil {
+		out.Canary = &CanaryStrategy{}
+		if in.Canary.Steps != nil {
+			out.Canary.Steps = make([]CanaryStep, len(in.Canary.Steps))
+			for i, step := range in.Canary.Steps {
+				out.Canary.Steps[i] = CanaryStep{SetWeight: step.SetWeight, Pause: step.Pause}
+			}
+		}
+	}
+	if in.BlueGreen != nil {
+		out.BlueGreen = &BlueGreenStrategy{
+			AutoPromoteAfter: in.BlueGreen.AutoPromoteAfter,
+			ScaleDownDelay:   in.BlueGreen.ScaleDownDelay,
+		}
+	}
+	return out
+}
+
+func strategyToV1alpha1(in *DeployStrategy) *v1alpha1.DeployStrategy {
+	if in == nil {
+		return nil
+	}
+	out := &v1alpha1.DeployStrategy{}
+	if in.Canary != nil {
+		out.Canary = &v1alpha1.CanaryStrategy{}
+		if in.Canary.Steps != nil {
+			out.Canary.Steps = make([]v1alpha1.CanaryStep, len(in.Canary.Steps))
+			for i, step := range in.Canary.Steps {
+				out.Canary.Steps[i] = v1alpha1.CanaryStep{SetWeight: step.SetWeight, Pause: step.Pause}
+			}
+		}
+	}
+	if in.BlueGreen != nil {
+		out.BlueGreen = &v1alpha1.BlueGreenStrategy{
+			AutoPromoteAfter: in.BlueGreen.AutoPromoteAfter,
+			ScaleDownDelay:   in.BlueGreen.ScaleDownDelay,
+		}
+	}
+	return out
+}
+
+func statusFromV1alpha1(in *v1alpha1.DeploydaemonStatus) *DeployDaemonStatus {
+	out := &DeployDaemonStatus{
+		ObservedGeneration: in.ObservedGeneration,
+		StartTime:          in.StartTime,
+		CompletionTime:     in.CompletionTime,
+		NextScheduleTime:   in.NextScheduleTime,
+		LastScheduleTime:   in.LastScheduleTime,
+		ScheduledSpecHash:  in.ScheduledSpecHash,
+		DrainStartTime:     in.DrainStartTime,
+		Replicas:           in.Replicas,
+		Selector:           in.Selector,
+		Deployment:         in.Deployment,
+	}
+	if in.Cluster != nil {
+		out.Cluster = &ClusterStatus{
+			Name:               in.Cluster.Name,
+			Namespace:          in.Cluster.NameSpace,
+			Deployment:         in.Cluster.DeploymentName,
+			PreviousDeployment: in.Cluster.PreviousDeploymentName,
+			Service:            in.Cluster.ServiceName,
+		}
+	}
+	if in.Conditions != nil {
+		out.Conditions = make([]Condition, len(in.Conditions))
+		for i, condition := range in.Conditions {
+			out.Conditions[i] = Condition{
+				Type:               ConditionType(condition.Type),
+				Status:             condition.Status,
+				ObservedGeneration: condition.ObservedGeneration,
+				LastTransitionTime: condition.LastTransitionTime,
+				Reason:             condition.Reason,
+				Message:            condition.Message,
+			}
+		}
+	}
+	if in.Expose != nil {
+		out.Expose = &ExposeStatus{
+			OnlineReplicas:  in.Expose.OnlineReplicas,
+			OfflineReplicas: in.Expose.OfflineReplicas,
+			Percent:         in.Expose.Percent,
+			OfflinePods:     in.Expose.OfflinePods,
+		}
+	}
+	if in.Canary != nil {
+		canary := CanaryStatus(*in.Canary)
+		out.Canary = &canary
+	}
+	if in.BlueGreen != nil {
+		blueGreen := BlueGreenStatus(*in.BlueGreen)
+		out.BlueGreen = &blueGreen
+	}
+	if in.History != nil {
+		out.History = make([]Revision, len(in.History))
+		for i := range in.History {
+			out.History[i] = revisionFromV1alpha1(&in.History[i])
+		}
+	}
+	if in.RolledBackTo != nil {
+		revision := revisionFromV1alpha1(in.RolledBackTo)
+		out.RolledBackTo = &revision
+	}
+	return out
+}
+
+func revisionFromV1alpha1(in *v1alpha1.Revision) Revision {
+	return Revision{
+		Revision:    in.Revision,
+		Version:     in.Version,
+		Image:       in.Image,
+		ConfigRef:   in.Config,
+		SecretRefs:  secretRefsFromV1alpha1(in.Secrets),
+		TemplateRef: in.TemplateRef,
+		SpecHash:    in.SpecHash,
+		Deployment:  in.DeploymentName,
+		DeployTime:  in.DeployTime,
+		ReadyTime:   in.ReadyTime,
+		Outcome:     in.Outcome,
+	}
+}
+
+func statusToV1alpha1(in *DeployDaemonStatus) *v1alpha1.DeploydaemonStatus {
+	out := &v1alpha1.DeploydaemonStatus{
+		ObservedGeneration: in.ObservedGeneration,
+		StartTime:          in.StartTime,
+		CompletionTime:     in.CompletionTime,
+		NextScheduleTime:   in.NextScheduleTime,
+		LastScheduleTime:   in.LastScheduleTime,
+		ScheduledSpecHash:  in.ScheduledSpecHash,
+		DrainStartTime:     in.DrainStartTime,
+		Replicas:           in.Replicas,
+		Selector:           in.Selector,
+		Deployment:         in.Deployment,
+	}
+	if in.Cluster != nil {
+		out.Cluster = &v1alpha1.ClusterSpec{
+			Name:                   in.Cluster.Name,
+			NameSpace:              in.Cluster.Namespace,
+			DeploymentName:         in.Cluster.Deployment,
+			PreviousDeploymentName: in.Cluster.PreviousDeployment,
+			ServiceName:            in.Cluster.Service,
+		}
+	}
+	if in.Conditions != nil {
+		out.Conditions = make([]v1alpha1.Condition, len(in.Conditions))
+		for i, condition := range in.Conditions {
+			out.Conditions[i] = v1alpha1.Condition{
+				Type:               v1alpha1.ConditionType(condition.Type),
+				Status:             condition.Status,
+				ObservedGeneration: condition.ObservedGeneration,
+				LastTransitionTime: condition.LastTransitionTime,
+				Reason:             condition.Reason,
+				Message:            condition.Message,
+			}
+		}
+	}
+	if in.Expose != nil {
+		out.Expose = &v1alpha1.ExposeStatus{
+			OnlineReplicas:  in.Expose.OnlineReplicas,
+			OfflineReplicas: in.Expose.OfflineReplicas,
+			Percent:         in.Expose.Percent,
+			OfflinePods:     in.Expose.OfflinePods,
+		}
+	}
+	if in.Canary != nil {
+		canary := v1alpha1.CanaryStatus(*in.Canary)
+		out.Canary = &canary
+	}
+	if in.BlueGreen != nil {
+		blueGreen := v1alpha1.BlueGreenStatus(*in.BlueGreen)
+		out.BlueGreen = &blueGreen
+	}
+	if in.History != nil {
+		out.History = make([]v1alpha1.Revision, len(in.History))
+		for i := range in.History {
+			out.History[i] = revisionToV1alpha1(&in.History[i])
+		}
+	}
+	if in.RolledBackTo != nil {
+		revision := revisionToV1alpha1(in.RolledBackTo)
+		out.RolledBackTo = &revision
+	}
+	return out
+}
+
+func revisionToV1alpha1(in *Revision) v1alpha1.Revision {
+	return v1alpha1.Revision{
+		Revision:       in.Revision,
+		Version:        in.Version,
+		Image:          in.Image,
+		Config:         in.ConfigRef,
+		Secrets:        secretRefsToV1alpha1(in.SecretRefs),
+		TemplateRef:    in.TemplateRef,
+		SpecHash:       in.SpecHash,
+		DeploymentName: in.Deployment,
+		DeployTime:     in.DeployTime,
+		ReadyTime:      in.ReadyTime,
+		Outcome:        in.Outcome,
+	}
+}
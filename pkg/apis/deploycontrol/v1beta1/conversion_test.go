@@ -0,0 +1,175 @@
+package v1beta1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+// newV1alpha1DeployDaemon returns a deploydaemon with every field set
+func newV1alpha1DeployDaemon() *v1alpha1.DeployDaemon {
+	now := metav1.NewTime(time.Date(2019, 10, 17, 8, 30, 0, 0, time.UTC))
+	pause := &metav1.Duration{Duration: 5 * time.Minute}
+	return &v1alpha1.DeployDaemon{
+		TypeMeta: metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: "DeployDaemon"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ts-app",
+			Namespace:   "default",
+			Labels:      map[string]string{v1alpha1.TenantLabel: "demo"},
+			Annotations: map[string]string{"team": "payments"},
+			Generation:  3,
+		},
+		Spec: v1alpha1.DeploydaemonSpec{
+			Component:            "ts-app",
+			Tenant:               "demo",
+			Environment:          "qa",
+			EnvType:              "auth",
+			Scheduler:            "30 2 * * 6",
+			Image:                "registry/ts-app:9.0.1.2",
+			Version:              "9.0.1.2",
+			Config:               "ts-app-config",
+			Secrets:              []v1alpha1.SecretsRef{{Name: "PASSWORD", Secret: "ts-app-secret"}},
+			Expose:               "online",
+			Replica:              int32Ptr(3),
+			ExposePercent:        int32Ptr(50),
+			OfflinePods:          []string{"ts-app-0"},
+			Ports:                []corev1.ServicePort{{Name: "http", Port: 8080}},
+			Weight:               int32Ptr(20),
+			TemplateRef:          "ts-app-template",
+			Strategy:             &v1alpha1.DeployStrategy{Canary: &v1alpha1.CanaryStrategy{Steps: []v1alpha1.CanaryStep{{SetWeight: int32Ptr(10), Pause: pause}, {}}}, BlueGreen: &v1alpha1.BlueGreenStrategy{AutoPromoteAfter: pause}},
+			RollbackTo:           &v1alpha1.RollbackConfig{Revision: 2},
+			RevisionHistoryLimit: int32Ptr(5),
+			DrainPeriod:          pause,
+		},
+		Status: &v1alpha1.DeploydaemonStatus{
+			ObservedGeneration: 3,
+			Cluster:            &v1alpha1.ClusterSpec{Name: "ts-app", NameSpace: "default", DeploymentName: "demoqaauth-ts-app-9.0.1.2", PreviousDeploymentName: "demoqaauth-ts-app-9.0.1.1", ServiceName: "demoqaauth-ts-app"},
+			StartTime:          &now,
+			NextScheduleTime:   &now,
+			ScheduledSpecHash:  "abc",
+			Conditions:         []v1alpha1.Condition{{Type: v1alpha1.Ready, Status: corev1.ConditionTrue, ObservedGeneration: 3, LastTransitionTime: now, Reason: "Synced"}},
+			Expose:             &v1alpha1.ExposeStatus{OnlineReplicas: 2, OfflineReplicas: 1, Percent: 66, OfflinePods: []string{"ts-app-0"}},
+			Canary:             &v1alpha1.CanaryStatus{Version: "9.0.1.2", StableVersion: "9.0.1.1", CurrentStep: 1, Weight: 10, Phase: "Paused", StepStartTime: &now},
+			BlueGreen:          &v1alpha1.BlueGreenStatus{Version: "9.0.1.2", ActiveVersion: "9.0.1.1", Phase: "Preview", PreviewStartTime: &now},
+			History:            []v1alpha1.Revision{{Revision: 1, Version: "9.0.1.1", Image: "registry/ts-app:9.0.1.1", Secrets: []v1alpha1.SecretsRef{{Name: "PASSWORD", Secret: "ts-app-secret"}}, SpecHash: "def", DeploymentName: "demoqaauth-ts-app-9.0.1.1", DeployTime: &now, Outcome: "Superseded"}},
+			RolledBackTo:       &v1alpha1.Revision{Revision: 1, Version: "9.0.1.1", Image: "registry/ts-app:9.0.1.1", Config: "ts-app-config", SpecHash: "def", DeploymentName: "demoqaauth-ts-app-9.0.1.1"},
+			Replicas:           3,
+			Selector:           "app=demoqaauth-ts-app-9.0.1.2,version=9.0.1.2",
+			Deployment:         appsv1.DeploymentStatus{Replicas: 3, ReadyReplicas: 3},
+		},
+	}
+}
+
+func TestConvertFromV1alpha1(t *testing.T) {
+	in := newV1alpha1DeployDaemon()
+	original := in.DeepCopy()
+
+	out := ConvertFromV1alpha1(in)
+	if !equality.Semantic.DeepEqual(in, original) {
+		t.Errorf("expected the v1alpha1 deploydaemon to be left unchanged")
+	}
+	if out.APIVersion != SchemeGroupVersion.String() || out.Kind != "DeployDaemon" {
+		t.Errorf("expected %s DeployDaemon, got %s %s", SchemeGroupVersion, out.APIVersion, out.Kind)
+	}
+	if out.Spec.Replicas == nil || *out.Spec.Replicas != 3 {
+		t.Errorf("expected 3 replicas, got %v", out.Spec.Replicas)
+	}
+	if out.Spec.Schedule == nil || out.Spec.Schedule.Cron != "30 2 * * 6" {
+		t.Errorf("expected a cron schedule, got %+v", out.Spec.Schedule)
+	}
+	if out.Spec.ConfigRef != "ts-app-config" || len(out.Spec.SecretRefs) != 1 ||
+		out.Spec.SecretRefs[0] != (SecretRef{EnvName: "PASSWORD", SecretName: "ts-app-secret"}) {
+		t.Errorf("expected the config and secret references, got %s %+v", out.Spec.ConfigRef, out.Spec.SecretRefs)
+	}
+	if out.Status.Cluster.Deployment != "demoqaauth-ts-app-9.0.1.2" || out.Status.History[0].Deployment != "demoqaauth-ts-app-9.0.1.1" {
+		t.Errorf("expected the deployments of the status, got %+v", out.Status)
+	}
+	if _, ok := out.Annotations[SchedulerAnnotation]; ok {
+		t.Errorf("expected no scheduler annotation, got %v", out.Annotations)
+	}
+
+	// Changing the output does not change the input
+	*out.Spec.Replicas = 1
+	out.Labels["changed"] = "true"
+	if !equality.Semantic.DeepEqual(in, original) {
+		t.Errorf("expected the v1beta1 deploydaemon not to share the v1alpha1 one")
+	}
+}
+
+func TestRoundTripFromV1alpha1(t *testing.T) {
+	for _, scheduler := range []string{
+		"",
+		"30 2 * * 6",
+		"@daily",
+		"10m0s",
+		"10m",
+		" 90s ",
+		"2019-10-17T08:30:00Z",
+		"2019-10-17T10:30:00+02:00",
+		"2019-10-17T08:30:00.5Z",
+		"not a schedule",
+	} {
+		in := newV1alpha1DeployDaemon()
+		in.Spec.Scheduler = scheduler
+
+		out := ConvertToV1alpha1(ConvertFromV1alpha1(in))
+		if !equality.Semantic.DeepEqual(out, in) {
+			t.Errorf("scheduler %q: expected %+v, got %+v", scheduler, in, out)
+		}
+	}
+
+	in := newV1alpha1DeployDaemon()
+	in.Annotations, in.Status, in.Spec.Strategy = nil, nil, nil
+	in.Spec.Secrets, in.Spec.Replica = nil, nil
+	if out := ConvertToV1alpha1(ConvertFromV1alpha1(in)); !equality.Semantic.DeepEqual(out, in) {
+		t.Errorf("expected %+v, got %+v", in, out)
+	}
+}
+
+func TestRoundTripFromV1beta1(t *testing.T) {
+	at := metav1.NewTime(time.Date(2019, 10, 17, 8, 30, 0, 0, time.UTC))
+	for _, schedule := range []*Schedule{
+		nil,
+		{At: &at},
+		{Delay: &metav1.Duration{Duration: 90 * time.Second}},
+		{Cron: "@weekly"},
+	} {
+		in := ConvertFromV1alpha1(newV1alpha1DeployDaemon())
+		in.Spec.Schedule = schedule
+
+		out := ConvertFromV1alpha1(ConvertToV1alpha1(in))
+		if !equality.Semantic.DeepEqual(out, in) {
+			t.Errorf("schedule %+v: expected %+v, got %+v", schedule, in, out)
+		}
+	}
+}
+
+func TestSchedulerAnnotation(t *testing.T) {
+	in := newV1alpha1DeployDaemon()
+	in.Spec.Scheduler = "90s"
+
+	beta := ConvertFromV1alpha1(in)
+	if beta.Spec.Schedule == nil || beta.Spec.Schedule.Delay == nil || beta.Spec.Schedule.Delay.Duration != 90*time.Second {
+		t.Fatalf("expected a delay of 90s, got %+v", beta.Spec.Schedule)
+	}
+	if beta.Annotations[SchedulerAnnotation] != "90s" {
+		t.Errorf("expected the scheduler to be kept in an annotation, got %v", beta.Annotations)
+	}
+
+	// The annotation is dropped once the schedule changes
+	beta.Spec.Schedule.Delay.Duration = 2 * time.Minute
+	alpha := ConvertToV1alpha1(beta)
+	if alpha.Spec.Scheduler != "2m0s" {
+		t.Errorf("expected scheduler 2m0s, got %s", alpha.Spec.Scheduler)
+	}
+	if _, ok := alpha.Annotations[SchedulerAnnotation]; ok {
+		t.Errorf("expected no scheduler annotation, got %v", alpha.Annotations)
+	}
+}
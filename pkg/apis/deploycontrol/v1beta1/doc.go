@@ -0,0 +1,6 @@
+// +k8s:deepcopy-gen=package
+
+// +groupName=deploycontrol.k8s.io
+// Package v1beta1 is the v1beta1 version of the API. It is converted from and to v1alpha1, which the controller
+// works with.
+package v1beta1
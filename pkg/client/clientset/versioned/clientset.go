@@ -20,6 +20,7 @@ package versioned
 
 import (
 	deploycontrolv1alpha1 "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned/typed/deploycontrol/v1alpha1"
+	deploycontrolv1beta1 "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned/typed/deploycontrol/v1beta1"
 	discovery "k8s.io/client-go/discovery"
 	rest "k8s.io/client-go/rest"
 	flowcontrol "k8s.io/client-go/util/flowcontrol"
@@ -28,6 +29,7 @@ import (
 type Interface interface {
 	Discovery() discovery.DiscoveryInterface
 	DeploycontrolV1alpha1() deploycontrolv1alpha1.DeploycontrolV1alpha1Interface
+	DeploycontrolV1beta1() deploycontrolv1beta1.DeploycontrolV1beta1Interface
 	// Deprecated: please explicitly pick a version if possible.
 	Deploycontrol() deploycontrolv1alpha1.DeploycontrolV1alpha1Interface
 }
@@ -37,6 +39,7 @@ type Interface interface {
 type Clientset struct {
 	*discovery.DiscoveryClient
 	deploycontrolV1alpha1 *deploycontrolv1alpha1.DeploycontrolV1alpha1Client
+	deploycontrolV1beta1  *deploycontrolv1beta1.DeploycontrolV1beta1Client
 }
 
 // DeploycontrolV1alpha1 retrieves the DeploycontrolV1alpha1Client
@@ -44,6 +47,11 @@ func (c *Clientset) DeploycontrolV1alpha1() deploycontrolv1alpha1.DeploycontrolV
 	return c.deploycontrolV1alpha1
 }
 
+// DeploycontrolV1beta1 retrieves the DeploycontrolV1beta1Client
+func (c *Clientset) DeploycontrolV1beta1() deploycontrolv1beta1.DeploycontrolV1beta1Interface {
+	return c.deploycontrolV1beta1
+}
+
 // Deprecated: Deploycontrol retrieves the default version of DeploycontrolClient.
 // Please explicitly pick a version.
 func (c *Clientset) Deploycontrol() deploycontrolv1alpha1.DeploycontrolV1alpha1Interface {
@@ -70,6 +78,10 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 	if err != nil {
 		return nil, err
 	}
+	cs.deploycontrolV1beta1, err = deploycontrolv1beta1.NewForConfig(&configShallowCopy)
+	if err != nil {
+		return nil, err
+	}
 
 	cs.DiscoveryClient, err = discovery.NewDiscoveryClientForConfig(&configShallowCopy)
 	if err != nil {
@@ -83,6 +95,7 @@ func NewForConfig(c *rest.Config) (*Clientset, error) {
 func NewForConfigOrDie(c *rest.Config) *Clientset {
 	var cs Clientset
 	cs.deploycontrolV1alpha1 = deploycontrolv1alpha1.NewForConfigOrDie(c)
+	cs.deploycontrolV1beta1 = deploycontrolv1beta1.NewForConfigOrDie(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClientForConfigOrDie(c)
 	return &cs
@@ -92,6 +105,7 @@ func NewForConfigOrDie(c *rest.Config) *Clientset {
 func New(c rest.Interface) *Clientset {
 	var cs Clientset
 	cs.deploycontrolV1alpha1 = deploycontrolv1alpha1.New(c)
+	cs.deploycontrolV1beta1 = deploycontrolv1beta1.New(c)
 
 	cs.DiscoveryClient = discovery.NewDiscoveryClient(c)
 	return &cs
@@ -22,6 +22,8 @@ import (
 	clientset "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned"
 	deploycontrolv1alpha1 "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned/typed/deploycontrol/v1alpha1"
 	fakedeploycontrolv1alpha1 "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned/typed/deploycontrol/v1alpha1/fake"
+	deploycontrolv1beta1 "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned/typed/deploycontrol/v1beta1"
+	fakedeploycontrolv1beta1 "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/clientset/versioned/typed/deploycontrol/v1beta1/fake"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/discovery"
@@ -76,6 +78,11 @@ func (c *Clientset) DeploycontrolV1alpha1() deploycontrolv1alpha1.DeploycontrolV
 	return &fakedeploycontrolv1alpha1.FakeDeploycontrolV1alpha1{Fake: &c.Fake}
 }
 
+// DeploycontrolV1beta1 retrieves the DeploycontrolV1beta1Client
+func (c *Clientset) DeploycontrolV1beta1() deploycontrolv1beta1.DeploycontrolV1beta1Interface {
+	return &fakedeploycontrolv1beta1.FakeDeploycontrolV1beta1{Fake: &c.Fake}
+}
+
 // Deploycontrol retrieves the DeploycontrolV1alpha1Client
 func (c *Clientset) Deploycontrol() deploycontrolv1alpha1.DeploycontrolV1alpha1Interface {
 	return &fakedeploycontrolv1alpha1.FakeDeploycontrolV1alpha1{Fake: &c.Fake}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 
 	v1alpha1 "github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	v1beta1 "github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1beta1"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
 	cache "k8s.io/client-go/tools/cache"
 )
@@ -56,6 +57,10 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 	case v1alpha1.SchemeGroupVersion.WithResource("deploydaemons"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Deploycontrol().V1alpha1().DeployDaemons().Informer()}, nil
 
+		// Group=deploycontrol.k8s.io, Version=v1beta1
+	case v1beta1.SchemeGroupVersion.WithResource("deploydaemons"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Deploycontrol().V1beta1().DeployDaemons().Informer()}, nil
+
 	}
 
 	return nil, fmt.Errorf("no informer found for %v", resource)
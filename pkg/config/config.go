@@ -0,0 +1,286 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog"
+	"sigs.k8s.io/yaml"
+)
+
+// Config holds the settings of the operator. They are read from an optional YAML file given by --config,
+// flags set on the command line override the file.
+type Config struct {
+	// Kubeconfig and Master point to the cluster out of it, the in-cluster config is used when both are empty
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	Master     string `json:"master,omitempty"`
+
+	// Namespaces limits the watched deploydaemons and their objects to these namespaces, all namespaces when empty
+	Namespaces []string `json:"namespaces,omitempty"`
+	// DeployDaemonSelector is a label selector limiting the watched deploydaemons, all of them when empty
+	DeployDaemonSelector string `json:"deployDaemonSelector,omitempty"`
+
+	Workers      int             `json:"workers"`
+	ResyncPeriod metav1.Duration `json:"resyncPeriod"`
+	RateLimiter  RateLimiter     `json:"rateLimiter"`
+
+	// LogLevel is the verbosity of the logs, the klog -v flag
+	LogLevel int `json:"logLevel"`
+
+	TrafficProvider string `json:"trafficProvider,omitempty"`
+
+	// MetricsAddr and HealthAddr are the bind addresses of the metrics and of the health probes, disabled when empty
+	MetricsAddr        string          `json:"metricsAddr"`
+	HealthAddr         string          `json:"healthAddr"`
+	WorkerStallTimeout metav1.Duration `json:"workerStallTimeout"`
+
+	LeaderElection LeaderElection `json:"leaderElection"`
+
+	Webhook Webhook `json:"webhook"`
+}
+
+// RateLimiter sets the per deploydaemon exponential backoff of failed syncs
+type RateLimiter struct {
+	BaseDelay metav1.Duration `json:"baseDelay"`
+	MaxDelay  metav1.Duration `json:"maxDelay"`
+}
+
+// LeaderElection sets the election of the replica running the workers
+type LeaderElection struct {
+	Enabled       bool            `json:"enabled"`
+	Namespace     string          `json:"namespace"`
+	LeaseDuration metav1.Duration `json:"leaseDuration"`
+	RenewDeadline metav1.Duration `json:"renewDeadline"`
+	RetryPeriod   metav1.Duration `json:"retryPeriod"`
+}
+
+// Webhook sets the admission and conversion webhooks served by every replica behind a Service. Their certificates are
+// kept in a Secret in the namespace of the Service and they are registered in the validating and mutating webhook
+// configurations named after the Service and in the conversion of the DeployDaemon custom resource definition.
+type Webhook struct {
+	// Addr is the bind address of the HTTPS server, the webhook is disabled when empty
+	Addr             string `json:"addr"`
+	ServiceName      string `json:"serviceName"`
+	ServiceNamespace string `json:"serviceNamespace"`
+	SecretName       string `json:"secretName"`
+}
+
+// Default returns the settings used when neither the config file nor a flag sets them
+func Default() *Config {
+	return &Config{
+		Workers:      2,
+		ResyncPeriod: metav1.Duration{Duration: 30 * time.Second},
+		RateLimiter: RateLimiter{
+			BaseDelay: metav1.Duration{Duration: 5 * time.Millisecond},
+			MaxDelay:  metav1.Duration{Duration: 1000 * time.Second},
+		},
+		LogLevel:           2,
+		MetricsAddr:        ":8080",
+		HealthAddr:         ":8081",
+		WorkerStallTimeout: metav1.Duration{Duration: 3 * time.Minute},
+		LeaderElection: LeaderElection{
+			Namespace:     "default",
+			LeaseDuration: metav1.Duration{Duration: 15 * time.Second},
+			RenewDeadline: metav1.Duration{Duration: 10 * time.Second},
+			RetryPeriod:   metav1.Duration{Duration: 2 * time.Second},
+		},
+		Webhook: Webhook{
+			ServiceName:      "deploydaemon-operator",
+			ServiceNamespace: "default",
+			SecretName:       "deploydaemon-operator-webhook",
+		},
+	}
+}
+
+// AddFlags binds the flags of the settings to c, their defaults are the current values of c
+func (c *Config) AddFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Kubeconfig, "kubeconfig", c.Kubeconfig, "Path to a kubeconfig. Only required if out-of-cluster, $KUBECONFIG or ~/.kube/config are used when not in a cluster.")
+	fs.StringVar(&c.Master, "master", c.Master, "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
+	fs.Var((*stringList)(&c.Namespaces), "namespaces", "Comma separated namespaces, only deploydaemons and their objects in these namespaces are watched, all namespaces if empty.")
+	fs.StringVar(&c.DeployDaemonSelector, "deploydaemon-selector", c.DeployDaemonSelector, "Label selector of the deploydaemons to watch, e.g. tenant=demo, all deploydaemons if empty.")
+	fs.IntVar(&c.Workers, "workers", c.Workers, "Number of deploydaemons synced in parallel.")
+	fs.DurationVar(&c.ResyncPeriod.Duration, "resync-period", c.ResyncPeriod.Duration, "How often every deploydaemon is synced again even without changes.")
+	fs.DurationVar(&c.RateLimiter.BaseDelay.Duration, "rate-limiter-base-delay", c.RateLimiter.BaseDelay.Duration, "Delay before the first retry of a failed sync, doubled on each further failure.")
+	fs.DurationVar(&c.RateLimiter.MaxDelay.Duration, "rate-limiter-max-delay", c.RateLimiter.MaxDelay.Duration, "Maximum delay between retries of a failed sync.")
+	fs.IntVar(&c.LogLevel, "log-level", c.LogLevel, "Verbosity of the logs, 4 logs every sync step.")
+	fs.StringVar(&c.TrafficProvider, "traffic-provider", c.TrafficProvider, "Route traffic between versions of a component with weights. Only istio is supported, disabled if empty.")
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", c.MetricsAddr, "The address the Prometheus metrics are served on at /metrics, disabled if empty.")
+	fs.StringVar(&c.HealthAddr, "health-addr", c.HealthAddr, "The address the liveness probe /healthz and the readiness probe /readyz are served on, disabled if empty.")
+	fs.DurationVar(&c.WorkerStallTimeout.Duration, "worker-stall-timeout", c.WorkerStallTimeout.Duration, "How long all workers may be busy without finishing an item while items are queued before /healthz fails.")
+	fs.BoolVar(&c.LeaderElection.Enabled, "leader-elect", c.LeaderElection.Enabled, "Elect a leader before running the workers, required to run several replicas.")
+	fs.StringVar(&c.LeaderElection.Namespace, "leader-elect-namespace", c.LeaderElection.Namespace, "The namespace of the configmap holding the leader election lock.")
+	fs.DurationVar(&c.LeaderElection.LeaseDuration.Duration, "leader-elect-lease-duration", c.LeaderElection.LeaseDuration.Duration, "How long standby replicas wait before taking over from a leader that stopped renewing.")
+	fs.DurationVar(&c.LeaderElection.RenewDeadline.Duration, "leader-elect-renew-deadline", c.LeaderElection.RenewDeadline.Duration, "How long the leader retries renewing the lease before it stops leading. Must be less than the lease duration.")
+	fs.DurationVar(&c.LeaderElection.RetryPeriod.Duration, "leader-elect-retry-period", c.LeaderElection.RetryPeriod.Duration, "How long to wait between attempts to acquire or renew the lease.")
+	fs.StringVar(&c.Webhook.Addr, "webhook-addr", c.Webhook.Addr, "The address the HTTPS admission webhook is served on, e.g. :9443, disabled if empty.")
+	fs.StringVar(&c.Webhook.ServiceName, "webhook-service", c.Webhook.ServiceName, "The Service the API server reaches the webhooks through, it also names the webhook configurations.")
+	fs.StringVar(&c.Webhook.ServiceNamespace, "webhook-service-namespace", c.Webhook.ServiceNamespace, "The namespace of the webhook Service and of the certificate Secret.")
+	fs.StringVar(&c.Webhook.SecretName, "webhook-secret", c.Webhook.SecretName, "The Secret the webhook certificates are created and renewed in.")
+}
+
+// Load parses args with the flags of the settings and --config on fs, then reads the config file when one is given.
+// Flags set in args override the file, the result is validated.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	config := Default()
+	var file string
+	fs.StringVar(&file, "config", "", "Path to a YAML file with the settings, flags override it.")
+	config.AddFlags(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if file != "" {
+		fromFile, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		// Replay the flags set on the command line over the file
+		replay := flag.NewFlagSet(fs.Name(), flag.ContinueOnError)
+		fromFile.AddFlags(replay)
+		var replayErr error
+		fs.Visit(func(f *flag.Flag) {
+			if replay.Lookup(f.Name) == nil || replayErr != nil {
+				return
+			}
+			replayErr = replay.Set(f.Name, f.Value.String())
+		})
+		if replayErr != nil {
+			return nil, replayErr
+		}
+		config = fromFile
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readFile reads the settings of a YAML file over the defaults
+func readFile(file string) (*Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read config file %s failed: %s", file, err.Error())
+	}
+	config := Default()
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("parse config file %s failed: %s", file, err.Error())
+	}
+	return config, nil
+}
+
+// Validate checks the settings are usable before anything is started
+func (c *Config) Validate() error {
+	switch {
+	case c.Workers < 1:
+		return fmt.Errorf("workers must be at least 1, got %d", c.Workers)
+	case c.ResyncPeriod.Duration < 0:
+		return fmt.Errorf("resyncPeriod must not be negative, got %s", c.ResyncPeriod.Duration)
+	case c.RateLimiter.BaseDelay.Duration <= 0:
+		return fmt.Errorf("rateLimiter baseDelay must be positive, got %s", c.RateLimiter.BaseDelay.Duration)
+	case c.RateLimiter.MaxDelay.Duration < c.RateLimiter.BaseDelay.Duration:
+		return fmt.Errorf("rateLimiter maxDelay %s must not be less than baseDelay %s", c.RateLimiter.MaxDelay.Duration, c.RateLimiter.BaseDelay.Duration)
+	case c.LogLevel < 0:
+		return fmt.Errorf("logLevel must not be negative, got %d", c.LogLevel)
+	case c.TrafficProvider != "" && c.TrafficProvider != "istio":
+		return fmt.Errorf("unknown traffic provider %s, only istio is supported", c.TrafficProvider)
+	case c.WorkerStallTimeout.Duration <= 0:
+		return fmt.Errorf("workerStallTimeout must be positive, got %s", c.WorkerStallTimeout.Duration)
+	}
+
+	seen := map[string]bool{}
+	for _, ns := range c.Namespaces {
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return fmt.Errorf("invalid namespace %q: %s", ns, strings.Join(errs, ", "))
+		}
+		if seen[ns] {
+			return fmt.Errorf("namespace %s is listed twice", ns)
+		}
+		seen[ns] = true
+	}
+	if _, err := labels.Parse(c.DeployDaemonSelector); err != nil {
+		return fmt.Errorf("invalid deployDaemonSelector: %s", err.Error())
+	}
+
+	if wh := c.Webhook; wh.Addr != "" {
+		for _, setting := range []struct{ name, value string }{
+			{"serviceName", wh.ServiceName},
+			{"serviceNamespace", wh.ServiceNamespace},
+			{"secretName", wh.SecretName},
+		} {
+			if errs := validation.IsDNS1123Label(setting.value); len(errs) > 0 {
+				return fmt.Errorf("invalid webhook %s %q: %s", setting.name, setting.value, strings.Join(errs, ", "))
+			}
+		}
+	}
+
+	if le := c.LeaderElection; le.Enabled {
+		switch {
+		case le.Namespace == "":
+			return fmt.Errorf("leaderElection namespace must be set")
+		case le.RetryPeriod.Duration <= 0:
+			return fmt.Errorf("leaderElection retryPeriod must be positive, got %s", le.RetryPeriod.Duration)
+		case le.RenewDeadline.Duration <= le.RetryPeriod.Duration:
+			return fmt.Errorf("leaderElection renewDeadline %s must be greater than retryPeriod %s", le.RenewDeadline.Duration, le.RetryPeriod.Duration)
+		case le.LeaseDuration.Duration <= le.RenewDeadline.Duration:
+			return fmt.Errorf("leaderElection leaseDuration %s must be greater than renewDeadline %s", le.LeaseDuration.Duration, le.RenewDeadline.Duration)
+		}
+	}
+	return nil
+}
+
+// RestConfig returns the config of the cluster: from Kubeconfig or Master when set, otherwise the in-cluster config
+// when running in a pod, otherwise $KUBECONFIG or ~/.kube/config
+func (c *Config) RestConfig() (*rest.Config, error) {
+	if c.Kubeconfig != "" || c.Master != "" {
+		return clientcmd.BuildConfigFromFlags(c.Master, c.Kubeconfig)
+	}
+
+	if config, err := rest.InClusterConfig(); err == nil {
+		klog.Info("Using in-cluster config")
+		return config, nil
+	}
+
+	klog.Info("Not running in a cluster, using the default kubeconfig")
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+}
+
+// NewRateLimiter returns the rate limiter of the workqueue: the exponential backoff of a failing deploydaemon, capped
+// by an overall limit of 10 qps with bursts of 100 like the default controller rate limiter
+func (c *Config) NewRateLimiter() workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(c.RateLimiter.BaseDelay.Duration, c.RateLimiter.MaxDelay.Duration),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+	)
+}
+
+// stringList is a flag holding comma separated values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a temporary file, the caller removes it
+func writeConfigFile(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "config-test-*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestLoadDefaults(t *testing.T) {
+	config, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if config.Workers != 2 || config.ResyncPeriod.Duration != 30*time.Second || config.Kubeconfig != "" {
+		t.Errorf("unexpected defaults: %+v", config)
+	}
+}
+
+func TestLoadFileWithFlagOverrides(t *testing.T) {
+	file := writeConfigFile(t, `
+workers: 4
+resyncPeriod: 1m
+namespaces: [qa]
+rateLimiter:
+  baseDelay: 1s
+leaderElection:
+  enabled: true
+  namespace: operators
+`)
+	defer os.Remove(file)
+
+	config, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--config", file, "--workers", "8", "--metrics-addr", "", "--namespaces", "team-a, team-b"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	if config.Workers != 8 {
+		t.Errorf("expected the workers flag to override the file, got %d", config.Workers)
+	}
+	if config.ResyncPeriod.Duration != time.Minute || config.RateLimiter.BaseDelay.Duration != time.Second {
+		t.Errorf("expected the settings of the file, got %+v", config)
+	}
+	if config.RateLimiter.MaxDelay.Duration != 1000*time.Second || config.LeaderElection.RetryPeriod.Duration != 2*time.Second {
+		t.Errorf("expected the defaults for settings missing from the file, got %+v", config)
+	}
+	if !config.LeaderElection.Enabled || config.LeaderElection.Namespace != "operators" {
+		t.Errorf("expected leader election from the file, got %+v", config.LeaderElection)
+	}
+	if !reflect.DeepEqual(config.Namespaces, []string{"team-a", "team-b"}) {
+		t.Errorf("expected the namespaces flag to override the file, got %v", config.Namespaces)
+	}
+	if config.MetricsAddr != "" {
+		t.Errorf("expected metrics disabled by the flag, got %s", config.MetricsAddr)
+	}
+}
+
+func TestLoadRejectsUnknownFileSettings(t *testing.T) {
+	file := writeConfigFile(t, "worker: 4\n")
+	defer os.Remove(file)
+
+	if _, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--config", file}); err == nil {
+		t.Error("expected an error for a misspelled setting")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		modify func(*Config)
+		err    string
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"no workers", func(c *Config) { c.Workers = 0 }, "workers"},
+		{"negative resync", func(c *Config) { c.ResyncPeriod.Duration = -time.Second }, "resyncPeriod"},
+		{"max below base delay", func(c *Config) { c.RateLimiter.MaxDelay.Duration = time.Millisecond }, "maxDelay"},
+		{"namespaces", func(c *Config) { c.Namespaces = []string{"team-a", "team-b"} }, ""},
+		{"invalid namespace", func(c *Config) { c.Namespaces = []string{"Team_A"} }, "invalid namespace"},
+		{"duplicate namespace", func(c *Config) { c.Namespaces = []string{"team-a", "team-a"} }, "listed twice"},
+		{"selector", func(c *Config) { c.DeployDaemonSelector = "tenant in (demo, qa),!legacy" }, ""},
+		{"invalid selector", func(c *Config) { c.DeployDaemonSelector = "tenant in demo" }, "deployDaemonSelector"},
+		{"unknown traffic provider", func(c *Config) { c.TrafficProvider = "linkerd" }, "traffic provider"},
+		{"renew deadline beyond lease", func(c *Config) {
+			c.LeaderElection.Enabled = true
+			c.LeaderElection.RenewDeadline.Duration = time.Minute
+		}, "leaseDuration"},
+		{"leader election disabled", func(c *Config) { c.LeaderElection.RenewDeadline.Duration = time.Minute }, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := Default()
+			test.modify(config)
+			err := config.Validate()
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %s", err.Error())
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("expected an error about %s, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadExampleFile(t *testing.T) {
+	config, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), []string{"--config", "../../artifacts/operator-config-example.yaml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if !reflect.DeepEqual(config, Default()) {
+		t.Errorf("expected the example to hold the defaults, got %+v", config)
+	}
+}
@@ -0,0 +1,125 @@
+package crdgen
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// comment is the doc comment of a type or a field, split in text lines and marker lines starting with "+"
+type comment struct {
+	text    []string
+	markers []string
+}
+
+func newComment(group *ast.CommentGroup) comment {
+	var c comment
+	if group == nil {
+		return c
+	}
+	for _, line := range strings.Split(group.Text(), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "+"):
+			c.markers = append(c.markers, line[1:])
+		default:
+			c.text = append(c.text, line)
+		}
+	}
+	return c
+}
+
+// description joins the text lines, markers excluded
+func (c comment) description() string {
+	return strings.Join(c.text, " ")
+}
+
+func (c comment) hasMarker(name string) bool {
+	for _, marker := range c.markers {
+		if marker == name {
+			return true
+		}
+	}
+	return false
+}
+
+// typeComments are the doc comments of a struct type and of its fields, by Go field name
+type typeComments struct {
+	doc    comment
+	fields map[string]comment
+}
+
+// packageComments reads the doc comments of the struct types declared in the source of the package pkgPath, its
+// internal tests included. The package is looked up from srcDir, which resolves the vendored packages.
+func packageComments(pkgPath, srcDir string) (map[string]*typeComments, error) {
+	pkg, err := build.Import(pkgPath, srcDir, build.FindOnly)
+	if err != nil {
+		return nil, err
+	}
+	packages, err := parser.ParseDir(token.NewFileSet(), pkg.Dir, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	types := map[string]*typeComments{}
+	for name, p := range packages {
+		if strings.HasSuffix(name, "_test") {
+			continue
+		}
+		for _, file := range p.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					typeSpec := spec.(*ast.TypeSpec)
+					structType, ok := typeSpec.Type.(*ast.StructType)
+					if !ok {
+						continue
+					}
+					// The doc of a lone type declaration is the one of the declaration
+					doc := typeSpec.Doc
+					if doc == nil && len(gen.Specs) == 1 {
+						doc = gen.Doc
+					}
+					types[typeSpec.Name.Name] = &typeComments{doc: newComment(doc), fields: fieldComments(structType)}
+				}
+			}
+		}
+	}
+	return types, nil
+}
+
+func fieldComments(structType *ast.StructType) map[string]comment {
+	fields := map[string]comment{}
+	for _, field := range structType.Fields.List {
+		doc := field.Doc
+		if doc == nil {
+			doc = field.Comment
+		}
+		names := field.Names
+		if len(names) == 0 {
+			// An embedded field is named after its type
+			switch t := field.Type.(type) {
+			case *ast.Ident:
+				names = []*ast.Ident{t}
+			case *ast.SelectorExpr:
+				names = []*ast.Ident{t.Sel}
+			case *ast.StarExpr:
+				if sel, ok := t.X.(*ast.SelectorExpr); ok {
+					names = []*ast.Ident{sel.Sel}
+				} else if ident, ok := t.X.(*ast.Ident); ok {
+					names = []*ast.Ident{ident}
+				}
+			}
+		}
+		for _, name := range names {
+			fields[name.Name] = newComment(doc)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,346 @@
+// Package crdgen generates the CustomResourceDefinition of a custom resource from its Go types. The OpenAPI v3 schema
+// follows the JSON encoding of the types and their doc comments, the kubebuilder markers of the comments add the
+// validations, the names, the subresources and the printer columns. A definition serving several versions of the
+// resource has the schema of each, the API server converts between them.
+package crdgen
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// Header is written at the top of the generated YAML
+const Header = "# Code generated by hack/crd-gen from the Go types, DO NOT EDIT.\n"
+
+// CustomResourceDefinition is the apiextensions.k8s.io/v1beta1 CustomResourceDefinition the generator writes
+type CustomResourceDefinition struct {
+	APIVersion string                       `json:"apiVersion"`
+	Kind       string                       `json:"kind"`
+	Metadata   CustomResourceDefinitionMeta `json:"metadata"`
+	Spec       CustomResourceDefinitionSpec `json:"spec"`
+}
+
+type CustomResourceDefinitionMeta struct {
+	Name string `json:"name"`
+}
+
+type CustomResourceDefinitionSpec struct {
+	Group                 string                        `json:"group"`
+	Names                 CustomResourceDefinitionNames `json:"names"`
+	Scope                 string                        `json:"scope"`
+	PreserveUnknownFields bool                          `json:"preserveUnknownFields"`
+	// Validation, Subresources and AdditionalPrinterColumns are the ones of every version when they are all the same,
+	// the API server rejects versions all setting the same ones
+	Validation               *CustomResourceValidation         `json:"validation,omitempty"`
+	Subresources             *CustomResourceSubresources       `json:"subresources,omitempty"`
+	AdditionalPrinterColumns []CustomResourceColumnDefinition  `json:"additionalPrinterColumns,omitempty"`
+	Versions                 []CustomResourceDefinitionVersion `json:"versions"`
+	Conversion               *CustomResourceConversion         `json:"conversion,omitempty"`
+}
+
+type CustomResourceDefinitionNames struct {
+	Kind       string   `json:"kind"`
+	ListKind   string   `json:"listKind"`
+	Plural     string   `json:"plural"`
+	Singular   string   `json:"singular"`
+	ShortNames []string `json:"shortNames,omitempty"`
+}
+
+type CustomResourceDefinitionVersion struct {
+	Name    string `json:"name"`
+	Served  bool   `json:"served"`
+	Storage bool   `json:"storage"`
+	// Schema is the one of the version, when the versions have different ones
+	Schema                   *CustomResourceValidation        `json:"schema,omitempty"`
+	Subresources             *CustomResourceSubresources      `json:"subresources,omitempty"`
+	AdditionalPrinterColumns []CustomResourceColumnDefinition `json:"additionalPrinterColumns,omitempty"`
+}
+
+type CustomResourceValidation struct {
+	OpenAPIV3Schema *JSONSchemaProps `json:"openAPIV3Schema"`
+}
+
+type CustomResourceSubresources struct {
+	Status *CustomResourceSubresourceStatus `json:"status,omitempty"`
+	Scale  *CustomResourceSubresourceScale  `json:"scale,omitempty"`
+}
+
+type CustomResourceSubresourceStatus struct{}
+
+// CustomResourceSubresourceScale maps the /scale subresource to the replicas and the label selector of the resource
+type CustomResourceSubresourceScale struct {
+	SpecReplicasPath   string  `json:"specReplicasPath"`
+	StatusReplicasPath string  `json:"statusReplicasPath"`
+	LabelSelectorPath  *string `json:"labelSelectorPath,omitempty"`
+}
+
+type CustomResourceColumnDefinition struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Format      string `json:"format,omitempty"`
+	Description string `json:"description,omitempty"`
+	Priority    int32  `json:"priority,omitempty"`
+	JSONPath    string `json:"JSONPath"`
+}
+
+// CustomResourceConversion converts the custom resources between their versions
+type CustomResourceConversion struct {
+	Strategy                 string               `json:"strategy"`
+	WebhookClientConfig      *WebhookClientConfig `json:"webhookClientConfig,omitempty"`
+	ConversionReviewVersions []string             `json:"conversionReviewVersions,omitempty"`
+}
+
+type WebhookClientConfig struct {
+	Service  *ServiceReference `json:"service,omitempty"`
+	CABundle []byte            `json:"caBundle,omitempty"`
+}
+
+type ServiceReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Path      string `json:"path,omitempty"`
+}
+
+// WebhookConversion returns the conversion by the webhook served on path behind the Service namespace/name. The CA
+// bundle is left to the webhook, which writes it once its certificates exist.
+func WebhookConversion(namespace, name, path string) *CustomResourceConversion {
+	return &CustomResourceConversion{
+		Strategy: "Webhook",
+		WebhookClientConfig: &WebhookClientConfig{
+			Service: &ServiceReference{Namespace: namespace, Name: name, Path: path},
+		},
+		ConversionReviewVersions: []string{"v1beta1"},
+	}
+}
+
+// Version is a version of a namespaced custom resource, object is a value of its Go type
+type Version struct {
+	GroupVersion schema.GroupVersion
+	Object       interface{}
+}
+
+// Generate returns the definition of the custom resource served in versions, which all have the same group and kind.
+// The storage version is the one whose type is marked +kubebuilder:storageversion, a single version needs no marker.
+// srcDir is a directory of the repository the packages of the types are looked up from.
+func Generate(srcDir string, versions ...Version) (*CustomResourceDefinition, error) {
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no version to generate")
+	}
+	generator := newSchemaGenerator(srcDir)
+	crd := &CustomResourceDefinition{
+		APIVersion: "apiextensions.k8s.io/v1beta1",
+		Kind:       "CustomResourceDefinition",
+	}
+	for i, version := range versions {
+		t := reflect.TypeOf(version.Object)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		comments, err := generator.comments(t)
+		if err != nil {
+			return nil, err
+		}
+
+		spec := CustomResourceDefinitionSpec{
+			Group: version.GroupVersion.Group,
+			Names: CustomResourceDefinitionNames{
+				Kind:     t.Name(),
+				ListKind: t.Name() + "List",
+				Plural:   strings.ToLower(t.Name()) + "s",
+				Singular: strings.ToLower(t.Name()),
+			},
+			Scope: "Namespaced",
+		}
+		crdVersion := CustomResourceDefinitionVersion{
+			Name:    version.GroupVersion.Version,
+			Served:  true,
+			Storage: len(versions) == 1,
+		}
+		if err := applyTypeMarkers(&spec, &crdVersion, comments.doc); err != nil {
+			return nil, fmt.Errorf("%s %s: %s", version.GroupVersion, t.Name(), err.Error())
+		}
+		if i == 0 {
+			crd.Spec = spec
+		} else if spec.Group != crd.Spec.Group || spec.Scope != crd.Spec.Scope || !reflect.DeepEqual(spec.Names, crd.Spec.Names) {
+			return nil, fmt.Errorf("%s %s: the group, names or scope differ from the ones of %s", version.GroupVersion, t.Name(), versions[0].GroupVersion)
+		}
+
+		root, err := generator.schemaFor(t, comments.doc)
+		if err != nil {
+			return nil, err
+		}
+		crdVersion.Schema = &CustomResourceValidation{OpenAPIV3Schema: &root}
+		crd.Spec.Versions = append(crd.Spec.Versions, crdVersion)
+	}
+	crd.Metadata.Name = crd.Spec.Names.Plural + "." + crd.Spec.Group
+
+	storage := 0
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			storage++
+		}
+	}
+	if storage != 1 {
+		return nil, fmt.Errorf("expected one storage version, got %d, mark the type of the storage version +%s", storage, storageVersionMarker)
+	}
+	hoistCommonVersionFields(&crd.Spec)
+	return crd, nil
+}
+
+// hoistCommonVersionFields moves the schema, the subresources and the printer columns the versions all have the same
+// to the spec
+func hoistCommonVersionFields(spec *CustomResourceDefinitionSpec) {
+	versions := spec.Versions
+	same := func(field func(version CustomResourceDefinitionVersion) interface{}) bool {
+		for _, version := range versions[1:] {
+			if !reflect.DeepEqual(field(version), field(versions[0])) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if same(func(version CustomResourceDefinitionVersion) interface{} { return version.Schema }) {
+		spec.Validation = versions[0].Schema
+		for i := range versions {
+			versions[i].Schema = nil
+		}
+	}
+	if same(func(version CustomResourceDefinitionVersion) interface{} { return version.Subresources }) {
+		spec.Subresources = versions[0].Subresources
+		for i := range versions {
+			versions[i].Subresources = nil
+		}
+	}
+	if same(func(version CustomResourceDefinitionVersion) interface{} { return version.AdditionalPrinterColumns }) {
+		spec.AdditionalPrinterColumns = versions[0].AdditionalPrinterColumns
+		for i := range versions {
+			versions[i].AdditionalPrinterColumns = nil
+		}
+	}
+}
+
+// applyTypeMarkers sets the names of the kubebuilder markers of the type on spec, and its storage, subresources and
+// printer columns on version
+func applyTypeMarkers(spec *CustomResourceDefinitionSpec, version *CustomResourceDefinitionVersion, c comment) error {
+	for _, marker := range c.markers {
+		switch {
+		case marker == storageVersionMarker:
+			version.Storage = true
+		case strings.HasPrefix(marker, resourceMarker):
+			args, err := markerArgs(strings.TrimPrefix(marker, resourceMarker))
+			if err != nil {
+				return fmt.Errorf("invalid marker +%s: %s", marker, err.Error())
+			}
+			for key, value := range args {
+				switch key {
+				case "path":
+					spec.Names.Plural = value
+				case "singular":
+					spec.Names.Singular = value
+				case "shortName":
+					spec.Names.ShortNames = strings.Split(value, ";")
+				case "scope":
+					spec.Scope = value
+				default:
+					return fmt.Errorf("invalid marker +%s: unknown argument %s", marker, key)
+				}
+			}
+		case strings.HasPrefix(marker, subresourceMarker):
+			if version.Subresources == nil {
+				version.Subresources = &CustomResourceSubresources{}
+			}
+			switch subresource := strings.TrimPrefix(marker, subresourceMarker); {
+			case subresource == "status":
+				version.Subresources.Status = &CustomResourceSubresourceStatus{}
+			case strings.HasPrefix(subresource, "scale:"):
+				scale, err := scaleSubresource(strings.TrimPrefix(subresource, "scale:"))
+				if err != nil {
+					return fmt.Errorf("invalid marker +%s: %s", marker, err.Error())
+				}
+				version.Subresources.Scale = scale
+			default:
+				return fmt.Errorf("unknown marker +%s", marker)
+			}
+		case strings.HasPrefix(marker, printColumnMarker):
+			column, err := printColumn(strings.TrimPrefix(marker, printColumnMarker))
+			if err != nil {
+				return fmt.Errorf("invalid marker +%s: %s", marker, err.Error())
+			}
+			version.AdditionalPrinterColumns = append(version.AdditionalPrinterColumns, column)
+		}
+	}
+	return nil
+}
+
+func scaleSubresource(marker string) (*CustomResourceSubresourceScale, error) {
+	args, err := markerArgs(marker)
+	if err != nil {
+		return nil, err
+	}
+	scale := &CustomResourceSubresourceScale{}
+	for key, value := range args {
+		switch key {
+		case "specpath":
+			scale.SpecReplicasPath = value
+		case "statuspath":
+			scale.StatusReplicasPath = value
+		case "selectorpath":
+			selector := value
+			scale.LabelSelectorPath = &selector
+		default:
+			return nil, fmt.Errorf("unknown argument %s", key)
+		}
+	}
+	if scale.SpecReplicasPath == "" || scale.StatusReplicasPath == "" {
+		return nil, fmt.Errorf("specpath and statuspath are required")
+	}
+	return scale, nil
+}
+
+func printColumn(marker string) (CustomResourceColumnDefinition, error) {
+	var column CustomResourceColumnDefinition
+	args, err := markerArgs(marker)
+	if err != nil {
+		return column, err
+	}
+	for key, value := range args {
+		switch key {
+		case "name":
+			column.Name = value
+		case "type":
+			column.Type = value
+		case "format":
+			column.Format = value
+		case "description":
+			column.Description = value
+		case "JSONPath":
+			column.JSONPath = value
+		case "priority":
+			var priority int32
+			if _, err := fmt.Sscanf(value, "%d", &priority); err != nil {
+				return column, fmt.Errorf("invalid priority %s", value)
+			}
+			column.Priority = priority
+		default:
+			return column, fmt.Errorf("unknown argument %s", key)
+		}
+	}
+	if column.Name == "" || column.Type == "" || column.JSONPath == "" {
+		return column, fmt.Errorf("name, type and JSONPath are required")
+	}
+	return column, nil
+}
+
+// Marshal returns the YAML of crd, with Header
+func Marshal(crd *CustomResourceDefinition) ([]byte, error) {
+	data, err := yaml.Marshal(crd)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(Header), data...), nil
+}
@@ -0,0 +1,291 @@
+package crdgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1beta1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/config"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/webhook"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Widget is a test resource
+// +kubebuilder:resource:path=widgets,shortName=wd;wdg
+// +kubebuilder:subresource:status
+// +kubebuilder:subresource:scale:specpath=.spec.size,statuspath=.status.replicas,selectorpath=.status.selector
+// +kubebuilder:printcolumn:name="Size",type="integer",JSONPath=".spec.size",description="Size, in units"
+type Widget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec WidgetSpec `json:"spec"`
+	// +optional
+	Status *WidgetStatus `json:"status,omitempty"`
+}
+
+type WidgetSpec struct {
+	// Color of the widget
+	// +kubebuilder:validation:Enum=red;blue
+	Color string `json:"color"`
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=10
+	Size *int32 `json:"size"`
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[a-z]+\.[a-z]+$`
+	Name    string             `json:"name"`
+	Labels  map[string]string  `json:"labels,omitempty"`
+	Port    intstr.IntOrString `json:"port,omitempty"`
+	Delay   *metav1.Duration   `json:"delay,omitempty"`
+	Data    []byte             `json:"data,omitempty"`
+	Parts   []WidgetPart       `json:"parts"`
+	hidden  string
+	Ignored string `json:"-"`
+}
+
+type WidgetPart struct {
+	Since metav1.Time `json:"since,omitempty"`
+}
+
+type WidgetStatus struct {
+	Phase    string `json:"phase,omitempty"`
+	Replicas int32  `json:"replicas,omitempty"`
+	Selector string `json:"selector,omitempty"`
+}
+
+func generate(t *testing.T, object interface{}) *CustomResourceDefinition {
+	crd, err := Generate(".", Version{GroupVersion: v1alpha1.SchemeGroupVersion, Object: object})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	return crd
+}
+
+func TestGenerate(t *testing.T) {
+	crd := generate(t, &Widget{})
+
+	if crd.Metadata.Name != "widgets.deploycontrol.k8s.io" || crd.Spec.Names.Kind != "Widget" || crd.Spec.Names.ListKind != "WidgetList" ||
+		crd.Spec.Names.Singular != "widget" || !reflect.DeepEqual(crd.Spec.Names.ShortNames, []string{"wd", "wdg"}) {
+		t.Errorf("unexpected names %s %+v", crd.Metadata.Name, crd.Spec.Names)
+	}
+	expectedVersions := []CustomResourceDefinitionVersion{{Name: "v1alpha1", Served: true, Storage: true}}
+	if !reflect.DeepEqual(crd.Spec.Versions, expectedVersions) {
+		t.Errorf("expected the single version to be stored and its fields on the spec, got %+v", crd.Spec.Versions)
+	}
+	if crd.Spec.Subresources == nil || crd.Spec.Subresources.Status == nil {
+		t.Error("expected the status subresource")
+	}
+	selector := ".status.selector"
+	expectedScale := &CustomResourceSubresourceScale{SpecReplicasPath: ".spec.size", StatusReplicasPath: ".status.replicas", LabelSelectorPath: &selector}
+	if crd.Spec.Subresources == nil || !reflect.DeepEqual(crd.Spec.Subresources.Scale, expectedScale) {
+		t.Errorf("expected the scale subresource %+v, got %+v", expectedScale, crd.Spec.Subresources)
+	}
+	expectedColumns := []CustomResourceColumnDefinition{{Name: "Size", Type: "integer", Description: "Size, in units", JSONPath: ".spec.size"}}
+	if !reflect.DeepEqual(crd.Spec.AdditionalPrinterColumns, expectedColumns) {
+		t.Errorf("expected columns %+v, got %+v", expectedColumns, crd.Spec.AdditionalPrinterColumns)
+	}
+
+	root := crd.Spec.Validation.OpenAPIV3Schema
+	if root.Description != "Widget is a test resource" || !reflect.DeepEqual(root.Required, []string{"spec"}) {
+		t.Errorf("unexpected root schema %+v", root)
+	}
+	if metadata := root.Properties["metadata"]; !reflect.DeepEqual(metadata, JSONSchemaProps{Type: "object"}) {
+		t.Errorf("expected metadata to only be an object, got %+v", metadata)
+	}
+	if _, ok := root.Properties["apiVersion"]; !ok {
+		t.Error("expected the inlined type meta")
+	}
+
+	spec := root.Properties["spec"]
+	one, ten := 1.0, 10.0
+	for name, expected := range map[string]JSONSchemaProps{
+		"color":  {Description: "Color of the widget", Type: "string", Enum: []string{"red", "blue"}},
+		"size":   {Type: "integer", Format: "int32", Minimum: &one, Maximum: &ten, Nullable: true},
+		"name":   {Type: "string", Pattern: `^[a-z]+\.[a-z]+$`},
+		"labels": {Type: "object", AdditionalProperties: &JSONSchemaProps{Type: "string"}},
+		"port":   {IntOrString: true},
+		"delay":  {Type: "string"},
+		"data":   {Type: "string", Format: "byte"},
+		"parts": {Type: "array", Nullable: true, Items: &JSONSchemaProps{Type: "object", Properties: map[string]JSONSchemaProps{
+			"since": {Type: "string", Format: "date-time", Nullable: true},
+		}}},
+	} {
+		if !reflect.DeepEqual(spec.Properties[name], expected) {
+			t.Errorf("expected %s to be %+v, got %+v", name, expected, spec.Properties[name])
+		}
+	}
+	if len(spec.Properties) != 8 {
+		t.Errorf("expected unexported and ignored fields to be left out, got %d properties", len(spec.Properties))
+	}
+	if !reflect.DeepEqual(spec.Required, []string{"color", "size", "parts"}) {
+		t.Errorf("expected the fields neither omitted when empty nor optional to be required, got %v", spec.Required)
+	}
+}
+
+type recursive struct {
+	Children []recursive `json:"children"`
+}
+
+type badMarker struct {
+	// +kubebuilder:validation:Enum=1;2
+	Count int32 `json:"count"`
+}
+
+type customEncoding struct {
+	Since time.Time `json:"since"`
+}
+
+// +kubebuilder:subresource:scale:specpath=.spec.count
+type badScale struct {
+	Spec badMarker `json:"spec"`
+}
+
+func TestGenerateRejectsUnsupportedTypes(t *testing.T) {
+	for name, object := range map[string]interface{}{
+		"recursive type":            &recursive{},
+		"enum of numbers":           &badMarker{},
+		"custom encoding":           &customEncoding{},
+		"scale without status path": &badScale{},
+	} {
+		if _, err := Generate(".", Version{GroupVersion: v1alpha1.SchemeGroupVersion, Object: object}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestMarkerArgs(t *testing.T) {
+	args, err := markerArgs(`name="Ready, of all",type=integer,JSONPath=".status[\"ready\"]"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	expected := map[string]string{"name": "Ready, of all", "type": "integer", "JSONPath": `.status["ready"]`}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected %v, got %v", expected, args)
+	}
+
+	for _, invalid := range []string{`name`, `name="Ready`, `name="Ready"type=integer`} {
+		if _, err := markerArgs(invalid); err == nil {
+			t.Errorf("expected %s to be invalid", invalid)
+		}
+	}
+}
+
+// generateDeployDaemon returns the definition hack/crd-gen writes with its default flags
+func generateDeployDaemon(t *testing.T) *CustomResourceDefinition {
+	crd, err := Generate(".",
+		Version{GroupVersion: v1beta1.SchemeGroupVersion, Object: &v1beta1.DeployDaemon{}},
+		Version{GroupVersion: v1alpha1.SchemeGroupVersion, Object: &v1alpha1.DeployDaemon{}},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	defaults := config.Default().Webhook
+	crd.Spec.Conversion = WebhookConversion(defaults.ServiceNamespace, defaults.ServiceName, webhook.ConvertPath)
+	return crd
+}
+
+// TestCRDIsUpToDate fails when the types changed without generating the CustomResourceDefinition again
+func TestCRDIsUpToDate(t *testing.T) {
+	data, err := Marshal(generateDeployDaemon(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join("..", "..", "artifacts", "deploydaemon-crd.yaml")
+	current, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, current) {
+		t.Errorf("%s is out of date, run go run hack/crd-gen/main.go from the root of the repository", file)
+	}
+}
+
+func TestGenerateVersions(t *testing.T) {
+	crd := generateDeployDaemon(t)
+
+	var versions []string
+	for _, version := range crd.Spec.Versions {
+		versions = append(versions, fmt.Sprintf("%s served=%t storage=%t", version.Name, version.Served, version.Storage))
+		if version.Schema == nil || len(version.AdditionalPrinterColumns) == 0 {
+			t.Errorf("expected %s to have its own schema and printer columns", version.Name)
+		}
+	}
+	expected := []string{"v1beta1 served=true storage=false", "v1alpha1 served=true storage=true"}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected versions %v, got %v", expected, versions)
+	}
+	if crd.Spec.Validation != nil || crd.Spec.AdditionalPrinterColumns != nil {
+		t.Error("expected the different schemas and printer columns to be left to the versions")
+	}
+	// The versions scale different fields of their spec
+	if crd.Spec.Subresources != nil {
+		t.Errorf("expected the different subresources to be left to the versions, got %+v", crd.Spec.Subresources)
+	}
+	for i, path := range []string{".spec.replicas", ".spec.instance"} {
+		subresources := crd.Spec.Versions[i].Subresources
+		if subresources == nil || subresources.Status == nil || subresources.Scale == nil || subresources.Scale.SpecReplicasPath != path {
+			t.Errorf("expected %s to have the status subresource and to scale %s, got %+v", crd.Spec.Versions[i].Name, path, subresources)
+		}
+	}
+
+	if _, err := Generate(".",
+		Version{GroupVersion: v1beta1.SchemeGroupVersion, Object: &Widget{}},
+		Version{GroupVersion: v1alpha1.SchemeGroupVersion, Object: &Widget{}},
+	); err == nil {
+		t.Error("expected an error without a storage version")
+	}
+}
+
+func TestCRDSchemaIsStructural(t *testing.T) {
+	crd := generateDeployDaemon(t)
+	var check func(path string, schema JSONSchemaProps)
+	check = func(path string, schema JSONSchemaProps) {
+		if schema.Type == "" && !schema.IntOrString {
+			t.Errorf("%s has no type", path)
+		}
+		for name, property := range schema.Properties {
+			check(path+"."+name, property)
+		}
+		if schema.Items != nil {
+			check(path+"[]", *schema.Items)
+		}
+		if schema.AdditionalProperties != nil {
+			check(path+"{}", *schema.AdditionalProperties)
+		}
+	}
+	for _, version := range crd.Spec.Versions {
+		check(version.Name, *version.Schema.OpenAPIV3Schema)
+
+		// The printer columns and the scale subresource select fields of the schema, metadata aside
+		data, _ := json.Marshal(version.Schema.OpenAPIV3Schema)
+		inSchema := func(path string) bool {
+			for _, name := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+				if !bytes.Contains(data, []byte(`"`+name+`":`)) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, column := range version.AdditionalPrinterColumns {
+			if !strings.HasPrefix(column.JSONPath, ".metadata.") && !inSchema(column.JSONPath) {
+				t.Errorf("%s column %s selects %s, not in the schema", version.Name, column.Name, column.JSONPath)
+			}
+		}
+		if scale := version.Subresources.Scale; scale != nil {
+			for _, path := range []string{scale.SpecReplicasPath, scale.StatusReplicasPath, *scale.LabelSelectorPath} {
+				if !inSchema(path) {
+					t.Errorf("%s scale subresource selects %s, not in the schema", version.Name, path)
+				}
+			}
+		}
+	}
+}
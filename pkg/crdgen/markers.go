@@ -0,0 +1,127 @@
+package crdgen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The markers read from the doc comments, a subset of the kubebuilder ones so the types stay compatible with its tools
+const (
+	optionalMarker    = "optional"
+	validationMarker  = "kubebuilder:validation:"
+	resourceMarker    = "kubebuilder:resource:"
+	printColumnMarker = "kubebuilder:printcolumn:"
+	subresourceMarker = "kubebuilder:subresource:"
+	// storageVersionMarker marks the type of the version the API server stores the resources in
+	storageVersionMarker = "kubebuilder:storageversion"
+)
+
+// applyValidationMarkers sets the validations of the kubebuilder:validation markers of c on schema
+func applyValidationMarkers(schema *JSONSchemaProps, c comment) error {
+	for _, marker := range c.markers {
+		if !strings.HasPrefix(marker, validationMarker) {
+			continue
+		}
+		name, value := splitMarker(strings.TrimPrefix(marker, validationMarker))
+		var err error
+		switch name {
+		case "Enum":
+			if schema.Type != "string" {
+				return fmt.Errorf("enum of a %s is not supported", schema.Type)
+			}
+			schema.Enum = strings.Split(unquote(value), ";")
+		case "Pattern":
+			schema.Pattern = unquote(value)
+		case "Minimum":
+			schema.Minimum, err = parseNumber(value)
+		case "Maximum":
+			schema.Maximum, err = parseNumber(value)
+		case "MinItems":
+			var minItems int64
+			minItems, err = strconv.ParseInt(value, 10, 64)
+			schema.MinItems = &minItems
+		default:
+			return fmt.Errorf("unknown marker +%s", marker)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid marker +%s: %s", marker, err.Error())
+		}
+	}
+	return nil
+}
+
+// splitMarker splits name=value
+func splitMarker(marker string) (string, string) {
+	parts := strings.SplitN(marker, "=", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// markerArgs parses the comma separated key=value arguments of a marker, values may be double quoted
+func markerArgs(args string) (map[string]string, error) {
+	values := map[string]string{}
+	for args != "" {
+		parts := strings.SplitN(args, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("argument %q has no value", args)
+		}
+		key, rest := strings.TrimSpace(parts[0]), parts[1]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := closingQuote(rest)
+			if end < 0 {
+				return nil, fmt.Errorf("argument %s: unterminated quoted value", key)
+			}
+			var err error
+			if value, err = strconv.Unquote(rest[:end+1]); err != nil {
+				return nil, fmt.Errorf("argument %s: %s", key, err.Error())
+			}
+			rest = rest[end+1:]
+		} else {
+			end := strings.Index(rest, ",")
+			if end < 0 {
+				end = len(rest)
+			}
+			value, rest = rest[:end], rest[end:]
+		}
+		values[key] = value
+
+		if rest != "" && !strings.HasPrefix(rest, ",") {
+			return nil, fmt.Errorf("argument %s: expected a comma after its value", key)
+		}
+		args = strings.TrimPrefix(rest, ",")
+	}
+	return values, nil
+}
+
+// closingQuote returns the index of the quote closing the one s starts with, -1 when there is none
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func unquote(value string) string {
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		return unquoted
+	}
+	return value
+}
+
+func parseNumber(value string) (*float64, error) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &number, nil
+}
@@ -0,0 +1,215 @@
+package crdgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// JSONSchemaProps is the subset of the OpenAPI v3 schema of a custom resource the generator writes. The schemas are
+// structural: every node has a type and metadata is left to the API server.
+type JSONSchemaProps struct {
+	Description          string                     `json:"description,omitempty"`
+	Type                 string                     `json:"type,omitempty"`
+	Format               string                     `json:"format,omitempty"`
+	Enum                 []string                   `json:"enum,omitempty"`
+	Pattern              string                     `json:"pattern,omitempty"`
+	Minimum              *float64                   `json:"minimum,omitempty"`
+	Maximum              *float64                   `json:"maximum,omitempty"`
+	MinItems             *int64                     `json:"minItems,omitempty"`
+	Nullable             bool                       `json:"nullable,omitempty"`
+	Required             []string                   `json:"required,omitempty"`
+	Properties           map[string]JSONSchemaProps `json:"properties,omitempty"`
+	Items                *JSONSchemaProps           `json:"items,omitempty"`
+	AdditionalProperties *JSONSchemaProps           `json:"additionalProperties,omitempty"`
+	IntOrString          bool                       `json:"x-kubernetes-int-or-string,omitempty"`
+}
+
+var (
+	timeType        = reflect.TypeOf(metav1.Time{})
+	microTimeType   = reflect.TypeOf(metav1.MicroTime{})
+	durationType    = reflect.TypeOf(metav1.Duration{})
+	intOrStringType = reflect.TypeOf(intstr.IntOrString{})
+	objectMetaType  = reflect.TypeOf(metav1.ObjectMeta{})
+	listMetaType    = reflect.TypeOf(metav1.ListMeta{})
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schemaGenerator builds the schema of Go types from their JSON encoding and the doc comments of their source
+type schemaGenerator struct {
+	srcDir   string
+	packages map[string]map[string]*typeComments
+	// visiting are the struct types being generated, a recursive type can not be written as a structural schema
+	visiting map[reflect.Type]bool
+}
+
+func newSchemaGenerator(srcDir string) *schemaGenerator {
+	return &schemaGenerator{
+		srcDir:   srcDir,
+		packages: map[string]map[string]*typeComments{},
+		visiting: map[reflect.Type]bool{},
+	}
+}
+
+// comments returns the doc comments of the named struct type t
+func (g *schemaGenerator) comments(t reflect.Type) (*typeComments, error) {
+	types, ok := g.packages[t.PkgPath()]
+	if !ok {
+		var err error
+		if types, err = packageComments(t.PkgPath(), g.srcDir); err != nil {
+			return nil, fmt.Errorf("read comments of package %s: %s", t.PkgPath(), err.Error())
+		}
+		g.packages[t.PkgPath()] = types
+	}
+	if comments, ok := types[t.Name()]; ok {
+		return comments, nil
+	}
+	return &typeComments{fields: map[string]comment{}}, nil
+}
+
+// schemaFor returns the schema of t, described and validated by the comment c of the field or type
+func (g *schemaGenerator) schemaFor(t reflect.Type, c comment) (JSONSchemaProps, error) {
+	schema, err := g.typeSchema(t)
+	if err != nil {
+		return schema, err
+	}
+	// The API server validates the metadata, a structural schema only declares it is an object
+	if t == objectMetaType || t == listMetaType {
+		return schema, nil
+	}
+	if description := c.description(); description != "" {
+		schema.Description = description
+	}
+	if err := applyValidationMarkers(&schema, c); err != nil {
+		return schema, fmt.Errorf("%s: %s", t, err.Error())
+	}
+	return schema, nil
+}
+
+func (g *schemaGenerator) typeSchema(t reflect.Type) (JSONSchemaProps, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType, microTimeType:
+		return JSONSchemaProps{Type: "string", Format: "date-time"}, nil
+	case durationType:
+		return JSONSchemaProps{Type: "string"}, nil
+	case intOrStringType:
+		return JSONSchemaProps{IntOrString: true}, nil
+	case objectMetaType, listMetaType:
+		return JSONSchemaProps{Type: "object"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return JSONSchemaProps{Type: "string"}, nil
+	case reflect.Bool:
+		return JSONSchemaProps{Type: "boolean"}, nil
+	case reflect.Int32, reflect.Uint32:
+		return JSONSchemaProps{Type: "integer", Format: "int32"}, nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return JSONSchemaProps{Type: "integer", Format: "int64"}, nil
+	case reflect.Int8, reflect.Int16, reflect.Uint8, reflect.Uint16:
+		return JSONSchemaProps{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return JSONSchemaProps{Type: "number"}, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return JSONSchemaProps{Type: "string", Format: "byte"}, nil
+		}
+		items, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return items, err
+		}
+		return JSONSchemaProps{Type: "array", Items: &items}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return JSONSchemaProps{}, fmt.Errorf("%s: only maps with string keys are supported", t)
+		}
+		values, err := g.typeSchema(t.Elem())
+		if err != nil {
+			return values, err
+		}
+		return JSONSchemaProps{Type: "object", AdditionalProperties: &values}, nil
+	case reflect.Struct:
+		if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+			return JSONSchemaProps{}, fmt.Errorf("%s: types with a custom JSON encoding are not supported", t)
+		}
+		if g.visiting[t] {
+			return JSONSchemaProps{}, fmt.Errorf("%s: recursive types are not supported", t)
+		}
+		g.visiting[t] = true
+		defer delete(g.visiting, t)
+
+		schema := JSONSchemaProps{Type: "object", Properties: map[string]JSONSchemaProps{}}
+		if err := g.addFields(&schema, t); err != nil {
+			return schema, err
+		}
+		return schema, nil
+	}
+	return JSONSchemaProps{}, fmt.Errorf("%s: kind %s is not supported", t, t.Kind())
+}
+
+// addFields adds the properties of the fields of the struct t to schema, the ones of the inlined structs included. A
+// field is required unless it is omitted when empty or marked optional.
+func (g *schemaGenerator) addFields(schema *JSONSchemaProps, t reflect.Type) error {
+	comments, err := g.comments(t)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name, omitEmpty := tag[0], false
+		for _, option := range tag[1:] {
+			omitEmpty = omitEmpty || option == "omitempty"
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" && field.Anonymous {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if err := g.addFields(schema, embedded); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		c := comments.fields[field.Name]
+		property, err := g.schemaFor(field.Type, c)
+		if err != nil {
+			return fmt.Errorf("%s.%s: %s", t.Name(), field.Name, err.Error())
+		}
+		property.Nullable = encodesNull(field.Type, omitEmpty)
+		schema.Properties[name] = property
+		if !omitEmpty && !c.hasMarker(optionalMarker) {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return nil
+}
+
+// encodesNull returns true when the JSON encoding of a field of type t may be null
+func encodesNull(t reflect.Type, omitEmpty bool) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return !omitEmpty
+	}
+	// A zero time is encoded as null, omitempty never omits a struct
+	return t == timeType || t == microTimeType
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	listers "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/listers/deploycontrol/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog"
+)
+
+// exposeLabel is the pod label the controller sets to online or offline
+const exposeLabel = "expose"
+
+var (
+	scheduledPendingDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "scheduled_pending"),
+		"Number of deploydaemons waiting for their scheduled deploy.",
+		nil, nil)
+
+	scheduledDueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "scheduled_due_timestamp_seconds"),
+		"Time the pending scheduled deploy of a deploydaemon is due, in seconds since the epoch.",
+		[]string{"namespace", "name"}, nil)
+
+	podsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "pods"),
+		"Number of pods of a version of a component by expose label, online or offline.",
+		[]string{"namespace", "component", "version", "expose"}, nil)
+)
+
+// stateCollector reports the state of the deploydaemons and their pods read from the informer caches at each scrape,
+// so deleted deploydaemons and versions leave no stale series
+type stateCollector struct {
+	deploydaemons listers.DeployDaemonLister
+	pods          corelisters.PodLister
+}
+
+// RegisterStateCollector adds the scheduled deploys and the exposed pods read from the listers to Registry
+func RegisterStateCollector(deploydaemons listers.DeployDaemonLister, pods corelisters.PodLister) {
+	Registry.MustRegister(NewStateCollector(deploydaemons, pods))
+}
+
+// NewStateCollector returns the collector registered by RegisterStateCollector
+func NewStateCollector(deploydaemons listers.DeployDaemonLister, pods corelisters.PodLister) prometheus.Collector {
+	return &stateCollector{deploydaemons: deploydaemons, pods: pods}
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- scheduledPendingDesc
+	ch <- scheduledDueDesc
+	ch <- podsDesc
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	deploydaemons, err := c.deploydaemons.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("list deploydaemons for metrics failed: %s", err.Error())
+		return
+	}
+
+	pending := 0
+	// namespace -> component, each component is counted once whatever the number of its deploydaemons
+	components := map[string]map[string]bool{}
+
+	for _, dd := range deploydaemons {
+		if dd.Status != nil && dd.Status.NextScheduleTime != nil {
+			pending++
+			ch <- prometheus.MustNewConstMetric(scheduledDueDesc, prometheus.GaugeValue,
+				float64(dd.Status.NextScheduleTime.Unix()), dd.Namespace, dd.Name)
+		}
+
+		if components[dd.Namespace] == nil {
+			components[dd.Namespace] = map[string]bool{}
+		}
+		components[dd.Namespace][dd.GetDeploymentName()] = true
+	}
+	ch <- prometheus.MustNewConstMetric(scheduledPendingDesc, prometheus.GaugeValue, float64(pending))
+
+	for ns, names := range components {
+		for component := range names {
+			c.collectPods(ch, ns, component)
+		}
+	}
+}
+
+// collectPods reports the online and offline pods of every version of a component
+func (c *stateCollector) collectPods(ch chan<- prometheus.Metric, ns, component string) {
+	pods, err := c.pods.Pods(ns).List(labels.SelectorFromSet(map[string]string{"app": component}))
+	if err != nil {
+		klog.Errorf("list pods of %s/%s for metrics failed: %s", ns, component, err.Error())
+		return
+	}
+
+	type versionExpose struct{ version, expose string }
+	counts := map[versionExpose]int{}
+	for _, pod := range pods {
+		version := pod.Labels["version"]
+		if version == "" {
+			continue
+		}
+		// Report both values of every version, a version going fully offline reports 0 online pods
+		if _, exist := counts[versionExpose{version, "online"}]; !exist {
+			counts[versionExpose{version, "online"}] = 0
+			counts[versionExpose{version, "offline"}] = 0
+		}
+		if expose := pod.Labels[exposeLabel]; expose == "online" || expose == "offline" {
+			counts[versionExpose{version, expose}]++
+		}
+	}
+
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(podsDesc, prometheus.GaugeValue, float64(count), ns, component, key.version, key.expose)
+	}
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace prefixes the name of every metric of the operator
+const namespace = "deploydaemon"
+
+// Registry holds the metrics served by Handler, the workqueue metrics included
+var Registry = prometheus.NewRegistry()
+
+var (
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_total",
+		Help:      "Number of reconciles of a deploydaemon by result, success or error.",
+	}, []string{"namespace", "name", "result"})
+
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "How long the reconciles of a deploydaemon take.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"namespace", "name"})
+
+	rolloutReadyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rollout_ready_seconds",
+		Help:      "Time from the deploy of a revision of a deploydaemon to its deployment being ready.",
+		Buckets:   prometheus.ExponentialBuckets(5, 2, 10),
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		prometheus.NewGoCollector(),
+		reconcileTotal,
+		reconcileDuration,
+		rolloutReadyDuration,
+	)
+	registerWorkqueueMetrics()
+}
+
+// Handler serves the metrics of Registry in the Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveReconcile records a reconcile of the deploydaemon namespace/name which took duration and ended with err
+func ObserveReconcile(namespace, name string, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	reconcileTotal.WithLabelValues(namespace, name, result).Inc()
+	reconcileDuration.WithLabelValues(namespace, name).Observe(duration.Seconds())
+}
+
+// ObserveRolloutReady records that a revision of the deploydaemon namespace/name got ready duration after its deploy
+func ObserveRolloutReady(namespace, name string, duration time.Duration) {
+	rolloutReadyDuration.WithLabelValues(namespace, name).Observe(duration.Seconds())
+}
+
+// ForgetDeployDaemon drops the series of the deleted deploydaemon namespace/name
+func ForgetDeployDaemon(namespace, name string) {
+	for _, result := range []string{"success", "error"} {
+		reconcileTotal.DeleteLabelValues(namespace, name, result)
+	}
+	reconcileDuration.DeleteLabelValues(namespace, name)
+	rolloutReadyDuration.DeleteLabelValues(namespace, name)
+}
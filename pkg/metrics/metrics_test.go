@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	listers "github.com/kongyi-ibm/k8s-deployment-operator/pkg/client/listers/deploycontrol/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestObserveReconcile(t *testing.T) {
+	ObserveReconcile("default", "ts-app", time.Second, nil)
+	ObserveReconcile("default", "ts-app", time.Second, errors.New("failed"))
+	ObserveReconcile("default", "ts-app", time.Second, errors.New("failed"))
+
+	if count := testutil.ToFloat64(reconcileTotal.WithLabelValues("default", "ts-app", "error")); count != 2 {
+		t.Errorf("expected 2 failed reconciles, got %v", count)
+	}
+
+	ForgetDeployDaemon("default", "ts-app")
+	if count := testutil.ToFloat64(reconcileTotal.WithLabelValues("default", "ts-app", "error")); count != 0 {
+		t.Errorf("expected series of deleted deploydaemon to be dropped, got %v", count)
+	}
+}
+
+func TestWorkqueueMetrics(t *testing.T) {
+	queue := workqueue.NewNamedDelayingQueue("metrics-test")
+	defer queue.ShutDown()
+
+	queue.Add("default/ts-app")
+	queue.AddAfter("default/other", time.Hour)
+
+	if depth := testutil.ToFloat64(workqueueDepth.WithLabelValues("metrics-test")); depth != 1 {
+		t.Errorf("expected depth 1, got %v", depth)
+	}
+	if retries := testutil.ToFloat64(workqueueRetries.WithLabelValues("metrics-test")); retries != 1 {
+		t.Errorf("expected 1 retry, got %v", retries)
+	}
+}
+
+func TestStateCollector(t *testing.T) {
+	ddIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	podIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+
+	due := metav1.NewTime(time.Unix(1546657200, 0))
+	for _, dd := range []*v1alpha1.DeployDaemon{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "ts-app-v1", Namespace: "default"},
+			Spec:       v1alpha1.DeploydaemonSpec{Tenant: "demo", Environment: "qa", EnvType: "auth", Component: "ts-app", Version: "9.0.1.2"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "ts-app-v2", Namespace: "default"},
+			Spec:       v1alpha1.DeploydaemonSpec{Tenant: "demo", Environment: "qa", EnvType: "auth", Component: "ts-app", Version: "9.0.1.3"},
+			Status:     &v1alpha1.DeploydaemonStatus{NextScheduleTime: &due},
+		},
+	} {
+		ddIndexer.Add(dd)
+	}
+
+	for name, labels := range map[string]map[string]string{
+		"pod-0": {"app": "demoqaauth-ts-app", "version": "9.0.1.2", exposeLabel: "online"},
+		"pod-1": {"app": "demoqaauth-ts-app", "version": "9.0.1.2", exposeLabel: "online"},
+		"pod-2": {"app": "demoqaauth-ts-app", "version": "9.0.1.2", exposeLabel: "offline"},
+		"pod-3": {"app": "other-app", "version": "1.0", exposeLabel: "online"},
+	} {
+		podIndexer.Add(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels}})
+	}
+
+	collector := NewStateCollector(listers.NewDeployDaemonLister(ddIndexer), corelisters.NewPodLister(podIndexer))
+	expected := `
+# HELP deploydaemon_pods Number of pods of a version of a component by expose label, online or offline.
+# TYPE deploydaemon_pods gauge
+deploydaemon_pods{component="demoqaauth-ts-app",expose="offline",namespace="default",version="9.0.1.2"} 1
+deploydaemon_pods{component="demoqaauth-ts-app",expose="online",namespace="default",version="9.0.1.2"} 2
+# HELP deploydaemon_scheduled_due_timestamp_seconds Time the pending scheduled deploy of a deploydaemon is due, in seconds since the epoch.
+# TYPE deploydaemon_scheduled_due_timestamp_seconds gauge
+deploydaemon_scheduled_due_timestamp_seconds{name="ts-app-v2",namespace="default"} 1.5466572e+09
+# HELP deploydaemon_scheduled_pending Number of deploydaemons waiting for their scheduled deploy.
+# TYPE deploydaemon_scheduled_pending gauge
+deploydaemon_scheduled_pending 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,170 @@
+// Package migration moves the stored DeployDaemons to the storage version of their CustomResourceDefinition, so the
+// versions they were stored in before can be removed from the definition, and converts the status they were stored
+// with by earlier releases.
+package migration
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog"
+)
+
+// CRDResource is the resource of the CustomResourceDefinitions
+var CRDResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1beta1", Resource: "customresourcedefinitions"}
+
+// CRDName is the name of the CustomResourceDefinition of the deploydaemons
+const CRDName = "deploydaemons." + deploycontrol.GroupName
+
+// listLimit is the number of deploydaemons listed at once
+const listLimit = 500
+
+// MigrateStorage rewrites every deploydaemon so the API server stores it in the storage version of the definition, it
+// then records that version as the only one stored in the status of the definition. It returns the storage version.
+// Running it again is harmless, a deploydaemon already stored in the storage version is left as is.
+func MigrateStorage(client dynamic.Interface) (string, error) {
+	crd, err := client.Resource(CRDResource).Get(CRDName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	version, err := storageVersion(crd)
+	if err != nil {
+		return "", err
+	}
+
+	deploydaemons := client.Resource(schema.GroupVersionResource{Group: deploycontrol.GroupName, Version: version, Resource: "deploydaemons"})
+	options := metav1.ListOptions{Limit: listLimit}
+	migrated := 0
+	for {
+		list, err := deploydaemons.List(options)
+		if err != nil {
+			return version, fmt.Errorf("list deploydaemons failed: %s", err.Error())
+		}
+		for i := range list.Items {
+			if err := rewrite(deploydaemons, &list.Items[i]); err != nil {
+				return version, fmt.Errorf("rewrite deploydaemon %s/%s failed: %s", list.Items[i].GetNamespace(), list.Items[i].GetName(), err.Error())
+			}
+			migrated++
+		}
+		if options.Continue = list.GetContinue(); options.Continue == "" {
+			break
+		}
+	}
+	klog.Infof("Rewrote %d deploydaemons in version %s", migrated, version)
+
+	// The definition is read again, the webhook may have updated it while migrating
+	return version, retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		crd, err := client.Resource(CRDResource).Get(CRDName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		current, err := storageVersion(crd)
+		if err != nil {
+			return err
+		}
+		if current != version {
+			return fmt.Errorf("storage version changed from %s to %s while migrating, run the migration again", version, current)
+		}
+		if err := unstructured.SetNestedStringSlice(crd.Object, []string{version}, "status", "storedVersions"); err != nil {
+			return err
+		}
+		_, err = client.Resource(CRDResource).UpdateStatus(crd, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// rewrite updates deploydaemon unchanged, which stores it in the storage version. The status.conditions object written
+// by the releases before the condition list is converted to the list first, the schema rejects updates of it. A
+// deploydaemon changed since it was listed is read again, one deleted is skipped.
+func rewrite(deploydaemons dynamic.NamespaceableResourceInterface, deploydaemon *unstructured.Unstructured) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		err := update(deploydaemons.Namespace(deploydaemon.GetNamespace()), deploydaemon)
+		if errors.IsConflict(err) {
+			latest, getErr := deploydaemons.Namespace(deploydaemon.GetNamespace()).Get(deploydaemon.GetName(), metav1.GetOptions{})
+			if getErr != nil {
+				err = getErr
+			} else {
+				deploydaemon = latest
+			}
+		}
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// update converts the legacy conditions of deploydaemon then updates it
+func update(client dynamic.ResourceInterface, deploydaemon *unstructured.Unstructured) error {
+	converted, err := convertLegacyConditions(deploydaemon)
+	if err != nil {
+		return err
+	}
+	if converted {
+		if deploydaemon, err = client.UpdateStatus(deploydaemon, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+	_, err = client.Update(deploydaemon, metav1.UpdateOptions{})
+	return err
+}
+
+// convertLegacyConditions replaces the status.conditions object of deploydaemon by the condition list it is read as,
+// it returns whether the status changed. The conditions are the same in every version.
+func convertLegacyConditions(deploydaemon *unstructured.Unstructured) (bool, error) {
+	if _, legacy, _ := unstructured.NestedMap(deploydaemon.Object, "status", "conditions"); !legacy {
+		return false, nil
+	}
+	data, err := json.Marshal(deploydaemon.Object["status"])
+	if err != nil {
+		return false, err
+	}
+	status := v1alpha1.DeploydaemonStatus{}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return false, err
+	}
+	if len(status.Conditions) == 0 {
+		unstructured.RemoveNestedField(deploydaemon.Object, "status", "conditions")
+		return true, nil
+	}
+	data, err = json.Marshal(status.Conditions)
+	if err != nil {
+		return false, err
+	}
+	var conditions []interface{}
+	if err := json.Unmarshal(data, &conditions); err != nil {
+		return false, err
+	}
+	return true, unstructured.SetNestedSlice(deploydaemon.Object, conditions, "status", "conditions")
+}
+
+// storageVersion returns the version of the definition crd the API server stores the resources in
+func storageVersion(crd *unstructured.Unstructured) (string, error) {
+	versions, _, err := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	if err != nil {
+		return "", err
+	}
+	for _, version := range versions {
+		version, ok := version.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if storage, _, _ := unstructured.NestedBool(version, "storage"); storage {
+			name, _, err := unstructured.NestedString(version, "name")
+			return name, err
+		}
+	}
+	// A definition of a single version may only set spec.version
+	if version, _, _ := unstructured.NestedString(crd.Object, "spec", "version"); version != "" && len(versions) == 0 {
+		return version, nil
+	}
+	return "", fmt.Errorf("custom resource definition %s has no storage version", crd.GetName())
+}
@@ -0,0 +1,125 @@
+package migration
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func newCRD(storage string, stored ...string) *unstructured.Unstructured {
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1beta1")
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName(CRDName)
+	var versions []interface{}
+	for _, name := range []string{"v1beta1", "v1alpha1"} {
+		versions = append(versions, map[string]interface{}{"name": name, "served": true, "storage": name == storage})
+	}
+	unstructured.SetNestedSlice(crd.Object, versions, "spec", "versions")
+	unstructured.SetNestedStringSlice(crd.Object, stored, "status", "storedVersions")
+	return crd
+}
+
+func newDeployDaemon(namespace, name string) *unstructured.Unstructured {
+	dd := &unstructured.Unstructured{}
+	dd.SetAPIVersion("deploycontrol.k8s.io/v1beta1")
+	dd.SetKind("DeployDaemon")
+	dd.SetNamespace(namespace)
+	dd.SetName(name)
+	return dd
+}
+
+func TestMigrateStorage(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newCRD("v1beta1", "v1alpha1", "v1beta1"),
+		newDeployDaemon("default", "ts-app"),
+		newDeployDaemon("qa", "ts-web"),
+	)
+
+	version, err := MigrateStorage(client)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if version != "v1beta1" {
+		t.Errorf("expected storage version v1beta1, got %s", version)
+	}
+
+	var updates []string
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			updates = append(updates, action.GetResource().Version+" "+action.GetResource().Resource+" "+action.GetSubresource())
+		}
+	}
+	expected := []string{"v1beta1 deploydaemons ", "v1beta1 deploydaemons ", "v1beta1 customresourcedefinitions status"}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected the deploydaemons then the definition status to be updated, got %v", updates)
+	}
+
+	crd, _ := client.Resource(CRDResource).Get(CRDName, metav1.GetOptions{})
+	if stored, _, _ := unstructured.NestedStringSlice(crd.Object, "status", "storedVersions"); !reflect.DeepEqual(stored, []string{"v1beta1"}) {
+		t.Errorf("expected v1beta1 to be the only stored version, got %v", stored)
+	}
+}
+
+func TestMigrateStorageWithoutStorageVersion(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), newCRD("", "v1alpha1"))
+	if _, err := MigrateStorage(client); err == nil {
+		t.Error("expected an error without a storage version")
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("expected no update, got %v", action)
+		}
+	}
+}
+
+func TestMigrateStorageConvertsLegacyConditions(t *testing.T) {
+	legacy := newDeployDaemon("default", "ts-app")
+	unstructured.SetNestedMap(legacy.Object, map[string]interface{}{
+		"lastupdatetime": "2019-01-05T03:00:00Z",
+		"status":         true,
+		"reason":         "All Status Synced",
+		"message":        "Deployment success!",
+	}, "status", "conditions")
+	empty := newDeployDaemon("qa", "ts-web")
+	unstructured.SetNestedMap(empty.Object, map[string]interface{}{"lastupdatetime": nil}, "status", "conditions")
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), newCRD("v1beta1", "v1alpha1", "v1beta1"), legacy, empty)
+
+	if _, err := MigrateStorage(client); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	var updates []string
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" && action.GetResource().Resource == "deploydaemons" {
+			updates = append(updates, action.GetSubresource())
+		}
+	}
+	if expected := []string{"status", "", "status", ""}; !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected the status then the deploydaemon to be updated, got %v", updates)
+	}
+
+	resource := schema.GroupVersionResource{Group: "deploycontrol.k8s.io", Version: "v1beta1", Resource: "deploydaemons"}
+	dd, _ := client.Resource(resource).Namespace("default").Get("ts-app", metav1.GetOptions{})
+	conditions, _, _ := unstructured.NestedSlice(dd.Object, "status", "conditions")
+	expected := []interface{}{map[string]interface{}{
+		"type":               "Ready",
+		"status":             "True",
+		"lastTransitionTime": "2019-01-05T03:00:00Z",
+		"reason":             "AllStatusSynced",
+		"message":            "Deployment success!",
+	}}
+	if !reflect.DeepEqual(conditions, expected) {
+		t.Errorf("expected the Ready condition %v, got %v", expected, conditions)
+	}
+
+	dd, _ = client.Resource(resource).Namespace("qa").Get("ts-web", metav1.GetOptions{})
+	if _, found, _ := unstructured.NestedFieldNoCopy(dd.Object, "status", "conditions"); found {
+		t.Errorf("expected the empty conditions to be removed, got %v", dd.Object["status"])
+	}
+}
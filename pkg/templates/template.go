@@ -1 +1,178 @@
-package templates
\ No newline at end of file
+package templates
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// TemplateKey is the ConfigMap data key which holds the pod template
+const TemplateKey = "template"
+
+// Provider returns the raw pod template referenced by a DeployDaemon.
+// The ConfigMap provider is the default one, other sources (e.g. a dedicated CRD) only need to implement this interface.
+type Provider interface {
+	Get(namespace, name string) (string, error)
+}
+
+// configMapProvider reads pod templates from the TemplateKey of ConfigMaps in the DeployDaemon namespace
+type configMapProvider struct {
+	lister corev1listers.ConfigMapLister
+}
+
+func NewConfigMapProvider(lister corev1listers.ConfigMapLister) Provider {
+	return &configMapProvider{lister: lister}
+}
+
+func (p *configMapProvider) Get(namespace, name string) (string, error) {
+	cm, err := p.lister.ConfigMaps(namespace).Get(name)
+	if err != nil {
+		return "", err
+	}
+
+	raw, ok := cm.Data[TemplateKey]
+	if !ok {
+		return "", fmt.Errorf("configmap %s/%s has no %s key", namespace, name, TemplateKey)
+	}
+	return raw, nil
+}
+
+// Values are the fields of a DeployDaemon which can be referenced in a template, e.g. {{ .Tenant }}
+type Values struct {
+	Name        string
+	Namespace   string
+	Tenant      string
+	Environment string
+	EnvType     string
+	Component   string
+	Image       string
+	Version     string
+}
+
+func ValuesFor(deploydaemon *v1alpha1.DeployDaemon) Values {
+	return Values{
+		Name:        deploydaemon.Name,
+		Namespace:   deploydaemon.Namespace,
+		Tenant:      deploydaemon.Spec.Tenant,
+		Environment: deploydaemon.Spec.Environment,
+		EnvType:     deploydaemon.Spec.EnvType,
+		Component:   deploydaemon.Spec.Component,
+		Image:       deploydaemon.Spec.Image,
+		Version:     deploydaemon.Spec.Version,
+	}
+}
+
+// Render substitutes values into the raw template and decodes the result as a pod template
+func Render(name, raw string, values Values) (*corev1.PodTemplateSpec, error) {
+	tpl, err := template.New(name).Option("missingkey=error").Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parse pod template %s failed: %s", name, err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, values); err != nil {
+		return nil, fmt.Errorf("render pod template %s failed: %s", name, err.Error())
+	}
+
+	podTemplate := &corev1.PodTemplateSpec{}
+	if err := yaml.Unmarshal(buf.Bytes(), podTemplate); err != nil {
+		return nil, fmt.Errorf("decode pod template %s failed: %s", name, err.Error())
+	}
+	return podTemplate, nil
+}
+
+// Apply merges the pod template into target.
+//
+// Annotations, volumes, init containers and pod level settings are copied over. The template container named
+// as the application container (or left unnamed) supplies probes, resources, ports, volume mounts and extra env
+// of the application container; every other template container is added as a sidecar. Labels which already
+// exist on target, like app / version / expose, are never overridden since the controller selects pods by them.
+func Apply(tpl *corev1.PodTemplateSpec, target *corev1.PodTemplateSpec, appContainer string) {
+	for k, v := range tpl.Annotations {
+		if target.Annotations == nil {
+			target.Annotations = map[string]string{}
+		}
+		target.Annotations[k] = v
+	}
+
+	for k, v := range tpl.Labels {
+		if target.Labels == nil {
+			target.Labels = map[string]string{}
+		}
+		if _, exist := target.Labels[k]; !exist {
+			target.Labels[k] = v
+		}
+	}
+
+	spec := &target.Spec
+	spec.Volumes = append(spec.Volumes, tpl.Spec.Volumes...)
+	spec.InitContainers = append(spec.InitContainers, tpl.Spec.InitContainers...)
+	spec.ImagePullSecrets = append(spec.ImagePullSecrets, tpl.Spec.ImagePullSecrets...)
+	spec.Tolerations = append(spec.Tolerations, tpl.Spec.Tolerations...)
+
+	if tpl.Spec.ServiceAccountName != "" {
+		spec.ServiceAccountName = tpl.Spec.ServiceAccountName
+	}
+	if tpl.Spec.NodeSelector != nil {
+		spec.NodeSelector = tpl.Spec.NodeSelector
+	}
+	if tpl.Spec.Affinity != nil {
+		spec.Affinity = tpl.Spec.Affinity
+	}
+	if tpl.Spec.SecurityContext != nil {
+		spec.SecurityContext = tpl.Spec.SecurityContext
+	}
+	if tpl.Spec.TerminationGracePeriodSeconds != nil {
+		spec.TerminationGracePeriodSeconds = tpl.Spec.TerminationGracePeriodSeconds
+	}
+
+	for _, container := range tpl.Spec.Containers {
+		if container.Name == "" || container.Name == appContainer {
+			for i := range spec.Containers {
+				if spec.Containers[i].Name == appContainer {
+					mergeContainer(&container, &spec.Containers[i])
+				}
+			}
+			continue
+		}
+		spec.Containers = append(spec.Containers, container)
+	}
+}
+
+// mergeContainer copies the pod shape of the template container into the application container.
+// Image, name, envFrom and secret env are owned by the DeployDaemon spec and never taken from the template.
+func mergeContainer(tpl *corev1.Container, target *corev1.Container) {
+	target.Env = append(target.Env, tpl.Env...)
+	target.Ports = append(target.Ports, tpl.Ports...)
+	target.VolumeMounts = append(target.VolumeMounts, tpl.VolumeMounts...)
+
+	if tpl.Command != nil {
+		target.Command = tpl.Command
+	}
+	if tpl.Args != nil {
+		target.Args = tpl.Args
+	}
+	if tpl.Resources.Limits != nil || tpl.Resources.Requests != nil {
+		target.Resources = tpl.Resources
+	}
+	if tpl.LivenessProbe != nil {
+		target.LivenessProbe = tpl.LivenessProbe
+	}
+	if tpl.ReadinessProbe != nil {
+		target.ReadinessProbe = tpl.ReadinessProbe
+	}
+	if tpl.Lifecycle != nil {
+		target.Lifecycle = tpl.Lifecycle
+	}
+	if tpl.SecurityContext != nil {
+		target.SecurityContext = tpl.SecurityContext
+	}
+	if tpl.ImagePullPolicy != "" {
+		target.ImagePullPolicy = tpl.ImagePullPolicy
+	}
+}
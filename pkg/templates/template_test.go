@@ -0,0 +1,125 @@
+package templates
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testTemplate = `
+metadata:
+  annotations:
+    prometheus.io/scrape: "true"
+    tenant: "{{ .Tenant }}-{{ .Environment }}"
+  labels:
+    team: payments
+    version: overridden
+spec:
+  volumes:
+  - name: cache
+    emptyDir: {}
+  containers:
+  - name: ts-app
+    readinessProbe:
+      httpGet:
+        path: /ready
+        port: 8080
+    resources:
+      limits:
+        cpu: 500m
+    volumeMounts:
+    - name: cache
+      mountPath: /cache
+    env:
+    - name: APP_VERSION
+      value: "{{ .Version }}"
+  - name: proxy
+    image: envoyproxy/envoy:v1.9.0
+`
+
+func TestRenderSubstitutesValues(t *testing.T) {
+	tpl, err := Render("test", testTemplate, Values{Tenant: "demo", Environment: "qa", Version: "9.0.1.2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if tpl.Annotations["tenant"] != "demo-qa" {
+		t.Errorf("expected annotation demo-qa, got %s", tpl.Annotations["tenant"])
+	}
+	if len(tpl.Spec.Containers) != 2 {
+		t.Fatalf("expected 2 containers, got %d", len(tpl.Spec.Containers))
+	}
+	if tpl.Spec.Containers[0].Env[0].Value != "9.0.1.2" {
+		t.Errorf("expected version 9.0.1.2, got %s", tpl.Spec.Containers[0].Env[0].Value)
+	}
+}
+
+func TestRenderRejectsUnknownValue(t *testing.T) {
+	if _, err := Render("test", `metadata: {annotations: {a: "{{ .Unknown }}"}}`, Values{}); err == nil {
+		t.Errorf("expected error for unknown value")
+	}
+}
+
+func TestRenderRejectsInvalidPodTemplate(t *testing.T) {
+	if _, err := Render("test", `spec: [not, a, pod]`, Values{}); err == nil {
+		t.Errorf("expected error for invalid pod template")
+	}
+}
+
+func TestApplyMergesTemplate(t *testing.T) {
+	tpl, err := Render("test", testTemplate, Values{Tenant: "demo", Environment: "qa", Version: "9.0.1.2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	target := &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"app": "demoqaauth-ts-app", "version": "9.0.1.2"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "ts-app",
+					Image: "nginx:latest",
+					Env:   []corev1.EnvVar{{Name: "VAULT_TOKEN"}},
+				},
+			},
+		},
+	}
+
+	Apply(tpl, target, "ts-app")
+
+	if target.Labels["version"] != "9.0.1.2" {
+		t.Errorf("expected version label to be kept, got %s", target.Labels["version"])
+	}
+	if target.Labels["team"] != "payments" {
+		t.Errorf("expected team label from template, got %s", target.Labels["team"])
+	}
+	if target.Annotations["prometheus.io/scrape"] != "true" {
+		t.Errorf("expected annotation from template, got %v", target.Annotations)
+	}
+	if len(target.Spec.Volumes) != 1 {
+		t.Errorf("expected 1 volume, got %d", len(target.Spec.Volumes))
+	}
+	if len(target.Spec.Containers) != 2 || target.Spec.Containers[1].Name != "proxy" {
+		t.Fatalf("expected proxy sidecar, got %v", target.Spec.Containers)
+	}
+
+	app := target.Spec.Containers[0]
+	if app.Image != "nginx:latest" {
+		t.Errorf("expected image to be kept, got %s", app.Image)
+	}
+	if app.ReadinessProbe == nil || app.ReadinessProbe.HTTPGet.Path != "/ready" {
+		t.Errorf("expected readiness probe from template, got %v", app.ReadinessProbe)
+	}
+	if app.Resources.Limits.Cpu().String() != "500m" {
+		t.Errorf("expected cpu limit 500m, got %s", app.Resources.Limits.Cpu().String())
+	}
+	if len(app.VolumeMounts) != 1 {
+		t.Errorf("expected 1 volume mount, got %d", len(app.VolumeMounts))
+	}
+	if len(app.Env) != 2 || app.Env[0].Name != "VAULT_TOKEN" {
+		t.Errorf("expected template env appended after spec env, got %v", app.Env)
+	}
+}
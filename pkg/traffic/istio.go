@@ -0,0 +1,176 @@
+package traffic
+
+import (
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog"
+)
+
+var (
+	istioGroupVersion = schema.GroupVersion{Group: "networking.istio.io", Version: "v1alpha3"}
+
+	VirtualServiceResource  = istioGroupVersion.WithResource("virtualservices")
+	DestinationRuleResource = istioGroupVersion.WithResource("destinationrules")
+)
+
+// managedByLabel marks the routing objects created by the operator, others are never modified
+const (
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedBy      = "deploydaemon-controller"
+)
+
+// istioProvider routes traffic with a DestinationRule holding one subset per version and a VirtualService
+// splitting the traffic between the subsets. Istio objects are handled as unstructured through the dynamic
+// client, so the operator does not depend on the Istio types.
+type istioProvider struct {
+	client dynamic.Interface
+}
+
+func NewIstioProvider(client dynamic.Interface) Provider {
+	return &istioProvider{client: client}
+}
+
+func (p *istioProvider) Sync(component *Component) error {
+	routes := NormalizeWeights(component.Routes)
+
+	var subsets []interface{}
+	var destinations []interface{}
+	for _, route := range routes {
+		subsets = append(subsets, map[string]interface{}{
+			"name":   subsetName(route.Version),
+			"labels": map[string]interface{}{"version": route.Version},
+		})
+		destinations = append(destinations, map[string]interface{}{
+			"destination": map[string]interface{}{
+				"host":   component.Name,
+				"subset": subsetName(route.Version),
+			},
+			"weight": int64(route.Weight),
+		})
+	}
+
+	// Without an online version the traffic goes to the Service, which has no online pods, rather than to a subset
+	if !hasWeight(routes) {
+		destinations = []interface{}{
+			map[string]interface{}{
+				"destination": map[string]interface{}{"host": component.Name},
+				"weight":      int64(100),
+			},
+		}
+	}
+
+	destinationRule := map[string]interface{}{
+		"host":    component.Name,
+		"subsets": subsets,
+	}
+	if err := p.apply(DestinationRuleResource, "DestinationRule", component, destinationRule); err != nil {
+		return err
+	}
+
+	virtualService := map[string]interface{}{
+		"hosts": []interface{}{component.Name},
+		"http": []interface{}{
+			map[string]interface{}{"route": destinations},
+		},
+	}
+	return p.apply(VirtualServiceResource, "VirtualService", component, virtualService)
+}
+
+func hasWeight(routes []Route) bool {
+	for _, route := range routes {
+		if route.Weight > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// apply creates the routing object of the component or updates its spec and owners when they drifted
+func (p *istioProvider) apply(resource schema.GroupVersionResource, kind string, component *Component, spec map[string]interface{}) error {
+	client := p.client.Resource(resource).Namespace(component.Namespace)
+
+	existing, err := client.Get(component.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		obj.SetAPIVersion(istioGroupVersion.String())
+		obj.SetKind(kind)
+		obj.SetName(component.Name)
+		obj.SetNamespace(component.Namespace)
+		obj.SetLabels(map[string]string{"app": component.Name, managedByLabel: managedBy})
+		obj.SetOwnerReferences(component.Owners)
+
+		klog.Infof("create %s %s/%s", kind, component.Namespace, component.Name)
+		if _, err := client.Create(obj, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("create %s %s failed: %s", kind, component.Name, err.Error())
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get %s %s failed: %s", kind, component.Name, err.Error())
+	}
+
+	if existing.GetLabels()[managedByLabel] != managedBy {
+		return fmt.Errorf("%s %s already exists and is not managed by deploydaemon", kind, component.Name)
+	}
+
+	// Compare through the JSON representation, ints read back from the API server are int64
+	desired := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	desiredSpec, _, _ := unstructured.NestedFieldCopy(desired.UnstructuredContent(), "spec")
+	currentSpec, _, _ := unstructured.NestedFieldCopy(existing.UnstructuredContent(), "spec")
+	if reflect.DeepEqual(desiredSpec, currentSpec) && reflect.DeepEqual(existing.GetOwnerReferences(), component.Owners) {
+		return nil
+	}
+
+	updated := existing.DeepCopy()
+	if err := unstructured.SetNestedField(updated.Object, desiredSpec, "spec"); err != nil {
+		return err
+	}
+	updated.SetOwnerReferences(component.Owners)
+
+	klog.Infof("update %s %s/%s", kind, component.Namespace, component.Name)
+	if _, err := client.Update(updated, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("update %s %s failed: %s", kind, component.Name, err.Error())
+	}
+	return nil
+}
+
+// Remove deletes the VirtualService and the DestinationRule of a component, those not managed by the operator are kept
+func (p *istioProvider) Remove(name, namespace string) error {
+	for _, resource := range []schema.GroupVersionResource{VirtualServiceResource, DestinationRuleResource} {
+		client := p.client.Resource(resource).Namespace(namespace)
+
+		existing, err := client.Get(name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("get %s %s failed: %s", resource.Resource, name, err.Error())
+		}
+		if existing.GetLabels()[managedByLabel] != managedBy {
+			continue
+		}
+
+		klog.Infof("delete %s %s/%s", resource.Resource, namespace, name)
+		if err := client.Delete(name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("delete %s %s failed: %s", resource.Resource, name, err.Error())
+		}
+	}
+	return nil
+}
+
+// subsetName turns a version into a subset name, which must be a DNS label
+func subsetName(version string) string {
+	name := []byte("v" + version)
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			name[i] = '-'
+		}
+	}
+	return string(name)
+}
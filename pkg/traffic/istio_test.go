@@ -0,0 +1,151 @@
+package traffic
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func newComponent(v1Weight, v2Weight int32) *Component {
+	return &Component{
+		Name:      "demoqaauth-ts-app",
+		Namespace: metav1.NamespaceDefault,
+		Owners:    []metav1.OwnerReference{{APIVersion: "deploycontrol.k8s.io/v1alpha1", Kind: "DeployDaemon", Name: "ts-app", UID: "uid"}},
+		Routes: []Route{
+			{Version: "9.0.1.2", Weight: v1Weight, Online: true},
+			{Version: "9.0.1.3", Weight: v2Weight, Online: true},
+		},
+	}
+}
+
+func getObject(t *testing.T, client *fake.FakeDynamicClient, component *Component, resource string) *unstructured.Unstructured {
+	gvr := VirtualServiceResource
+	if resource == "destinationrules" {
+		gvr = DestinationRuleResource
+	}
+	obj, err := client.Resource(gvr).Namespace(component.Namespace).Get(component.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected %s to exist: %v", resource, err)
+	}
+	return obj
+}
+
+func routeWeights(t *testing.T, vs *unstructured.Unstructured) map[string]int64 {
+	http, _, _ := unstructured.NestedSlice(vs.Object, "spec", "http")
+	if len(http) != 1 {
+		t.Fatalf("expected 1 http route, got %v", http)
+	}
+	routes, _, _ := unstructured.NestedSlice(http[0].(map[string]interface{}), "route")
+	weights := map[string]int64{}
+	for _, route := range routes {
+		subset, _, _ := unstructured.NestedString(route.(map[string]interface{}), "destination", "subset")
+		weight, _, _ := unstructured.NestedInt64(route.(map[string]interface{}), "weight")
+		weights[subset] = weight
+	}
+	return weights
+}
+
+func TestIstioProviderCreatesRouting(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	provider := NewIstioProvider(client)
+	component := newComponent(90, 10)
+
+	if err := provider.Sync(component); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dr := getObject(t, client, component, "destinationrules")
+	subsets, _, _ := unstructured.NestedSlice(dr.Object, "spec", "subsets")
+	if len(subsets) != 2 {
+		t.Fatalf("expected 2 subsets, got %v", subsets)
+	}
+	version, _, _ := unstructured.NestedString(subsets[0].(map[string]interface{}), "labels", "version")
+	if version != "9.0.1.2" {
+		t.Errorf("expected subset selecting version 9.0.1.2, got %s", version)
+	}
+	if len(dr.GetOwnerReferences()) != 1 {
+		t.Errorf("expected destination rule to be owned by the deploydaemon")
+	}
+
+	vs := getObject(t, client, component, "virtualservices")
+	weights := routeWeights(t, vs)
+	if weights["v9-0-1-2"] != 90 || weights["v9-0-1-3"] != 10 {
+		t.Errorf("expected 90/10 split, got %v", weights)
+	}
+}
+
+func TestIstioProviderUpdatesWeights(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	provider := NewIstioProvider(client)
+
+	if err := provider.Sync(newComponent(90, 10)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	component := newComponent(1, 1)
+	if err := provider.Sync(component); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	weights := routeWeights(t, getObject(t, client, component, "virtualservices"))
+	if weights["v9-0-1-2"] != 50 || weights["v9-0-1-3"] != 50 {
+		t.Errorf("expected 50/50 split, got %v", weights)
+	}
+}
+
+func TestIstioProviderWithoutOnlineVersion(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	component := newComponent(0, 0)
+	component.Routes[0].Online, component.Routes[1].Online = false, false
+	if err := NewIstioProvider(client).Sync(component); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The offline versions keep their subsets but get no traffic
+	if weights := routeWeights(t, getObject(t, client, component, "virtualservices")); !reflect.DeepEqual(weights, map[string]int64{"": 100}) {
+		t.Errorf("expected all traffic to the service without subset, got %v", weights)
+	}
+	subsets, _, _ := unstructured.NestedSlice(getObject(t, client, component, "destinationrules").Object, "spec", "subsets")
+	if len(subsets) != 2 {
+		t.Errorf("expected a subset per version, got %v", subsets)
+	}
+}
+
+func TestIstioProviderRefusesUnmanagedObjects(t *testing.T) {
+	existing := &unstructured.Unstructured{}
+	existing.SetAPIVersion("networking.istio.io/v1alpha3")
+	existing.SetKind("DestinationRule")
+	existing.SetName("demoqaauth-ts-app")
+	existing.SetNamespace(metav1.NamespaceDefault)
+
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), existing)
+	if err := NewIstioProvider(client).Sync(newComponent(1, 1)); err == nil {
+		t.Errorf("expected error for destination rule not managed by deploydaemon")
+	}
+}
+
+func TestIstioProviderRemovesRouting(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme())
+	provider := NewIstioProvider(client)
+	component := newComponent(1, 1)
+	if err := provider.Sync(component); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The destination rule is taken over by hand and must be kept
+	dr := getObject(t, client, component, "destinationrules")
+	dr.SetLabels(nil)
+	client.Resource(DestinationRuleResource).Namespace(component.Namespace).Update(dr, metav1.UpdateOptions{})
+
+	if err := provider.Remove(component.Name, component.Namespace); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.Resource(VirtualServiceResource).Namespace(component.Namespace).Get(component.Name, metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected virtual service to be deleted, got %v", err)
+	}
+	getObject(t, client, component, "destinationrules")
+}
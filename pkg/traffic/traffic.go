@@ -0,0 +1,81 @@
+package traffic
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Route is the share of traffic a version of a component receives
+type Route struct {
+	Version string
+	Weight  int32
+	// Online routes share the traffic evenly when none has a weight, the others never get any
+	Online bool
+}
+
+// Component describes how the traffic of a component is split between its versions
+type Component struct {
+	// Name is the host of the component, i.e. the Service shared by its versions, and the name of the routing objects
+	Name      string
+	Namespace string
+
+	// Owners are the deploydaemons of the component, routing objects go away with the last of them
+	Owners []metav1.OwnerReference
+
+	Routes []Route
+}
+
+// Provider routes the traffic of a component between its versions, e.g. through a service mesh
+type Provider interface {
+	Sync(component *Component) error
+	// Remove deletes the routing objects of a component once it has no version left
+	Remove(name, namespace string) error
+}
+
+// NormalizeWeights scales the weights of the routes so that they add up to 100. Remainders of the
+// integer division are handed out in route order to routes with a weight. When no route has a weight
+// the traffic is split evenly between the online routes, when no route is online all weights are 0.
+func NormalizeWeights(routes []Route) []Route {
+	if len(routes) == 0 {
+		return routes
+	}
+
+	normalized := make([]Route, len(routes))
+	copy(normalized, routes)
+
+	var total int32
+	for i := range normalized {
+		if normalized[i].Weight < 0 || !normalized[i].Online {
+			normalized[i].Weight = 0
+		}
+		total += normalized[i].Weight
+	}
+
+	if total == 0 {
+		for i := range normalized {
+			if normalized[i].Online {
+				normalized[i].Weight = 1
+				total++
+			}
+		}
+		if total == 0 {
+			return normalized
+		}
+	}
+
+	weighted := make([]bool, len(normalized))
+	var assigned int32
+	for i := range normalized {
+		weighted[i] = normalized[i].Weight > 0
+		normalized[i].Weight = normalized[i].Weight * 100 / total
+		assigned += normalized[i].Weight
+	}
+
+	for i := 0; assigned < 100; i = (i + 1) % len(normalized) {
+		if weighted[i] {
+			normalized[i].Weight++
+			assigned++
+		}
+	}
+
+	return normalized
+}
@@ -0,0 +1,59 @@
+package traffic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func weights(routes []Route) []int32 {
+	var out []int32
+	for _, route := range routes {
+		out = append(out, route.Weight)
+	}
+	return out
+}
+
+func TestNormalizeWeights(t *testing.T) {
+	cases := []struct {
+		in  []int32
+		out []int32
+	}{
+		{[]int32{90, 10}, []int32{90, 10}},
+		{[]int32{9, 1}, []int32{90, 10}},
+		{[]int32{1, 1, 1}, []int32{34, 33, 33}},
+		{[]int32{0, 0}, []int32{50, 50}},
+		{[]int32{50, 0}, []int32{100, 0}},
+		{[]int32{2, 0, 1}, []int32{67, 0, 33}},
+		{[]int32{-5, 10}, []int32{0, 100}},
+		{[]int32{7}, []int32{100}},
+	}
+
+	for _, tc := range cases {
+		var routes []Route
+		for _, w := range tc.in {
+			routes = append(routes, Route{Version: "v", Weight: w, Online: true})
+		}
+		if got := weights(NormalizeWeights(routes)); !reflect.DeepEqual(got, tc.out) {
+			t.Errorf("%v: expected %v, got %v", tc.in, tc.out, got)
+		}
+	}
+}
+
+func TestNormalizeWeightsOffline(t *testing.T) {
+	cases := []struct {
+		in  []Route
+		out []int32
+	}{
+		// Offline routes never get traffic, not even when no route has a weight
+		{[]Route{{Weight: 0, Online: true}, {Weight: 0}}, []int32{100, 0}},
+		{[]Route{{Weight: 50, Online: true}, {Weight: 50}}, []int32{100, 0}},
+		{[]Route{{Weight: 0, Online: true}, {Weight: 0}, {Weight: 0, Online: true}}, []int32{50, 0, 50}},
+		{[]Route{{Weight: 0}, {Weight: 0}}, []int32{0, 0}},
+	}
+
+	for _, tc := range cases {
+		if got := weights(NormalizeWeights(tc.in)); !reflect.DeepEqual(got, tc.out) {
+			t.Errorf("%+v: expected %v, got %v", tc.in, tc.out, got)
+		}
+	}
+}
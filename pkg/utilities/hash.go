@@ -0,0 +1,21 @@
+package utilities
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+)
+
+// ComputeHash returns a short stable hash of the JSON representation of obj.
+// It is used to detect drift between a DeployDaemon spec and the objects rendered from it.
+func ComputeHash(obj interface{}) (string, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := fnv.New32a()
+	hasher.Write(data)
+
+	return fmt.Sprintf("%x", hasher.Sum32()), nil
+}
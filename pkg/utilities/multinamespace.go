@@ -0,0 +1,288 @@
+package utilities
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+// multiNamespaceInformer merges the informers of the same resource in several namespaces. Event handlers are added to
+// every informer and the indexer reads each object from the informer of its namespace, so listers built on it work
+// as if a single informer watched all of those namespaces. The informers are run by their factories.
+type multiNamespaceInformer struct {
+	namespaces []string
+	informers  map[string]cache.SharedIndexInformer
+	indexer    *multiNamespaceIndexer
+}
+
+// NewMultiNamespaceInformer merges informers, keyed by the namespace they watch
+func NewMultiNamespaceInformer(informers map[string]cache.SharedIndexInformer) cache.SharedIndexInformer {
+	namespaces := make([]string, 0, len(informers))
+	indexers := make(map[string]cache.Indexer, len(informers))
+	for ns, informer := range informers {
+		namespaces = append(namespaces, ns)
+		indexers[ns] = informer.GetIndexer()
+	}
+	sort.Strings(namespaces)
+
+	return &multiNamespaceInformer{
+		namespaces: namespaces,
+		informers:  informers,
+		indexer:    &multiNamespaceIndexer{namespaces: namespaces, indexers: indexers},
+	}
+}
+
+func (i *multiNamespaceInformer) AddEventHandler(handler cache.ResourceEventHandler) {
+	for _, ns := range i.namespaces {
+		i.informers[ns].AddEventHandler(handler)
+	}
+}
+
+func (i *multiNamespaceInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, resyncPeriod time.Duration) {
+	for _, ns := range i.namespaces {
+		i.informers[ns].AddEventHandlerWithResyncPeriod(handler, resyncPeriod)
+	}
+}
+
+func (i *multiNamespaceInformer) GetStore() cache.Store {
+	return i.indexer
+}
+
+func (i *multiNamespaceInformer) GetIndexer() cache.Indexer {
+	return i.indexer
+}
+
+// GetController returns the merged informer, it runs and syncs like the controllers of the informers together
+func (i *multiNamespaceInformer) GetController() cache.Controller {
+	return i
+}
+
+func (i *multiNamespaceInformer) Run(stopCh <-chan struct{}) {
+	for _, ns := range i.namespaces {
+		go i.informers[ns].Run(stopCh)
+	}
+	<-stopCh
+}
+
+func (i *multiNamespaceInformer) HasSynced() bool {
+	for _, ns := range i.namespaces {
+		if !i.informers[ns].HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// LastSyncResourceVersion is empty, resource versions of different watches are not comparable
+func (i *multiNamespaceInformer) LastSyncResourceVersion() string {
+	return ""
+}
+
+func (i *multiNamespaceInformer) AddIndexers(indexers cache.Indexers) error {
+	for _, ns := range i.namespaces {
+		if err := i.informers[ns].AddIndexers(indexers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// multiNamespaceIndexer reads from the indexer of the namespace of an object, lists merge all of them
+type multiNamespaceIndexer struct {
+	namespaces []string
+	indexers   map[string]cache.Indexer
+}
+
+// indexerOf returns the indexer of the namespace of obj, nil when the namespace is not watched
+func (i *multiNamespaceIndexer) indexerOf(obj interface{}) (cache.Indexer, error) {
+	if key, ok := obj.(cache.ExplicitKey); ok {
+		return i.indexerOfKey(string(key))
+	}
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return i.indexerOfKey(tombstone.Key)
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	return i.indexers[accessor.GetNamespace()], nil
+}
+
+func (i *multiNamespaceIndexer) indexerOfKey(key string) (cache.Indexer, error) {
+	ns, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return i.indexers[ns], nil
+}
+
+func (i *multiNamespaceIndexer) Add(obj interface{}) error {
+	indexer, err := i.indexerOf(obj)
+	if err != nil {
+		return err
+	}
+	if indexer == nil {
+		return fmt.Errorf("namespace of %v is not watched", obj)
+	}
+	return indexer.Add(obj)
+}
+
+func (i *multiNamespaceIndexer) Update(obj interface{}) error {
+	indexer, err := i.indexerOf(obj)
+	if err != nil {
+		return err
+	}
+	if indexer == nil {
+		return fmt.Errorf("namespace of %v is not watched", obj)
+	}
+	return indexer.Update(obj)
+}
+
+func (i *multiNamespaceIndexer) Delete(obj interface{}) error {
+	indexer, err := i.indexerOf(obj)
+	if err != nil || indexer == nil {
+		return err
+	}
+	return indexer.Delete(obj)
+}
+
+func (i *multiNamespaceIndexer) List() []interface{} {
+	var items []interface{}
+	for _, ns := range i.namespaces {
+		items = append(items, i.indexers[ns].List()...)
+	}
+	return items
+}
+
+func (i *multiNamespaceIndexer) ListKeys() []string {
+	var keys []string
+	for _, ns := range i.namespaces {
+		keys = append(keys, i.indexers[ns].ListKeys()...)
+	}
+	return keys
+}
+
+func (i *multiNamespaceIndexer) Get(obj interface{}) (interface{}, bool, error) {
+	indexer, err := i.indexerOf(obj)
+	if err != nil || indexer == nil {
+		return nil, false, err
+	}
+	return indexer.Get(obj)
+}
+
+func (i *multiNamespaceIndexer) GetByKey(key string) (interface{}, bool, error) {
+	indexer, err := i.indexerOfKey(key)
+	if err != nil || indexer == nil {
+		return nil, false, err
+	}
+	return indexer.GetByKey(key)
+}
+
+// Replace is not supported, each informer replaces the content of its own indexer
+func (i *multiNamespaceIndexer) Replace(items []interface{}, resourceVersion string) error {
+	return fmt.Errorf("replace is not supported by the indexer of several namespaces")
+}
+
+func (i *multiNamespaceIndexer) Resync() error {
+	for _, ns := range i.namespaces {
+		if err := i.indexers[ns].Resync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Index reads the namespace index from the indexer of that namespace only, other indexes merge all indexers
+func (i *multiNamespaceIndexer) Index(indexName string, obj interface{}) ([]interface{}, error) {
+	if indexName == cache.NamespaceIndex {
+		indexer, err := i.indexerOf(obj)
+		if err != nil || indexer == nil {
+			return nil, err
+		}
+		return indexer.Index(indexName, obj)
+	}
+
+	var items []interface{}
+	for _, ns := range i.namespaces {
+		nsItems, err := i.indexers[ns].Index(indexName, obj)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, nsItems...)
+	}
+	return items, nil
+}
+
+func (i *multiNamespaceIndexer) IndexKeys(indexName, indexKey string) ([]string, error) {
+	if indexName == cache.NamespaceIndex {
+		indexer := i.indexers[indexKey]
+		if indexer == nil {
+			return nil, nil
+		}
+		return indexer.IndexKeys(indexName, indexKey)
+	}
+
+	var keys []string
+	for _, ns := range i.namespaces {
+		nsKeys, err := i.indexers[ns].IndexKeys(indexName, indexKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, nsKeys...)
+	}
+	return keys, nil
+}
+
+func (i *multiNamespaceIndexer) ListIndexFuncValues(indexName string) []string {
+	seen := map[string]bool{}
+	var values []string
+	for _, ns := range i.namespaces {
+		for _, value := range i.indexers[ns].ListIndexFuncValues(indexName) {
+			if !seen[value] {
+				seen[value] = true
+				values = append(values, value)
+			}
+		}
+	}
+	return values
+}
+
+func (i *multiNamespaceIndexer) ByIndex(indexName, indexKey string) ([]interface{}, error) {
+	if indexName == cache.NamespaceIndex {
+		indexer := i.indexers[indexKey]
+		if indexer == nil {
+			return nil, nil
+		}
+		return indexer.ByIndex(indexName, indexKey)
+	}
+
+	var items []interface{}
+	for _, ns := range i.namespaces {
+		nsItems, err := i.indexers[ns].ByIndex(indexName, indexKey)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, nsItems...)
+	}
+	return items, nil
+}
+
+// GetIndexers returns the indexers shared by the informers, they are all created by the same factory function
+func (i *multiNamespaceIndexer) GetIndexers() cache.Indexers {
+	for _, ns := range i.namespaces {
+		return i.indexers[ns].GetIndexers()
+	}
+	return cache.Indexers{}
+}
+
+func (i *multiNamespaceIndexer) AddIndexers(newIndexers cache.Indexers) error {
+	for _, ns := range i.namespaces {
+		if err := i.indexers[ns].AddIndexers(newIndexers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package utilities
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newPod(namespace, name, app string) *corev1.Pod {
+	return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: map[string]string{"app": app}}}
+}
+
+func TestMultiNamespaceInformerLister(t *testing.T) {
+	informers := map[string]cache.SharedIndexInformer{}
+	for _, ns := range []string{"team-a", "team-b"} {
+		factory := kubeinformers.NewSharedInformerFactoryWithOptions(k8sfake.NewSimpleClientset(), 0, kubeinformers.WithNamespace(ns))
+		informers[ns] = factory.Core().V1().Pods().Informer()
+	}
+	informers["team-a"].GetIndexer().Add(newPod("team-a", "web-0", "web"))
+	informers["team-a"].GetIndexer().Add(newPod("team-a", "db-0", "db"))
+	informers["team-b"].GetIndexer().Add(newPod("team-b", "web-0", "web"))
+
+	merged := NewMultiNamespaceInformer(informers)
+	lister := corelisters.NewPodLister(merged.GetIndexer())
+
+	if pod, err := lister.Pods("team-b").Get("web-0"); err != nil || pod.Namespace != "team-b" {
+		t.Errorf("expected pod team-b/web-0, got %v, %v", pod, err)
+	}
+	if _, err := lister.Pods("team-c").Get("web-0"); !errors.IsNotFound(err) {
+		t.Errorf("expected pods of unwatched namespaces not to be found, got %v", err)
+	}
+
+	if pods, _ := lister.Pods("team-a").List(labels.Everything()); len(pods) != 2 {
+		t.Errorf("expected 2 pods in team-a, got %d", len(pods))
+	}
+	if pods, _ := lister.List(labels.SelectorFromSet(labels.Set{"app": "web"})); len(pods) != 2 {
+		t.Errorf("expected 2 web pods in all watched namespaces, got %d", len(pods))
+	}
+
+	if err := merged.GetIndexer().Add(newPod("team-c", "web-0", "web")); err == nil {
+		t.Error("expected adding a pod of an unwatched namespace to fail")
+	}
+	if merged.HasSynced() {
+		t.Error("expected the merged informer not to be synced before its informers")
+	}
+}
@@ -0,0 +1,210 @@
+package utilities
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule describes when a DeployDaemon is due to be deployed
+type Schedule interface {
+	// Next returns the first activation time after from, zero time if the schedule never activates again
+	Next(from time.Time) time.Time
+}
+
+// ParseSchedule parses the scheduler of a DeployDaemon. Supported formats are
+//  - an absolute RFC3339 timestamp, e.g. "2019-01-02T03:00:00Z"
+//  - a standard 5 fields cron expression or descriptor, evaluated in UTC, e.g. "30 2 * * 6" or "@daily"
+//  - a duration relative to the time the spec is observed, e.g. "1m"
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if spec == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+
+	if t, err := time.Parse(time.RFC3339, spec); err == nil {
+		return onceSchedule(t), nil
+	}
+
+	if d, err := time.ParseDuration(spec); err == nil {
+		if d < 0 {
+			return nil, fmt.Errorf("negative schedule duration %s", spec)
+		}
+		return delaySchedule(d), nil
+	}
+
+	if descriptor, ok := cronDescriptors[spec]; ok {
+		spec = descriptor
+	}
+
+	return parseCron(spec)
+}
+
+// onceSchedule activates at a fixed time. A time in the past is still returned so that it is never skipped.
+type onceSchedule time.Time
+
+func (s onceSchedule) Next(from time.Time) time.Time {
+	return time.Time(s)
+}
+
+// delaySchedule activates a fixed duration after from
+type delaySchedule time.Duration
+
+func (s delaySchedule) Next(from time.Time) time.Time {
+	return from.Add(time.Duration(s))
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronSchedule holds a bit set of the allowed values of each cron field
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar record an unrestricted field, cron matches either day field when both are restricted
+	domStar, dowStar bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func parseCron(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid schedule %q: expected RFC3339 time, duration or %d cron fields", spec, len(cronFields))
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, field := range fields {
+		b, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %s", spec, err.Error())
+		}
+		bits[i] = b
+	}
+
+	// Both 0 and 7 are sunday
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &cronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*" || fields[2] == "?",
+		dowStar: fields[4] == "*" || fields[4] == "?",
+	}, nil
+}
+
+// parseCronField parses comma separated values, ranges and steps like "1,5-10,*/15"
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s", part, f.name)
+			}
+			rng, step = part[:i], s
+		}
+
+		low, high := f.min, f.max
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid range %q in %s", part, f.name)
+			}
+			if high, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid range %q in %s", part, f.name)
+			}
+		default:
+			v, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q in %s", part, f.name)
+			}
+			low = v
+			if step == 1 {
+				high = v
+			}
+		}
+
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf("value %q out of range %d-%d in %s", part, f.min, f.max, f.name)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func (s *cronSchedule) Next(from time.Time) time.Time {
+	// Cron has a minute resolution, start from the next whole minute. Expressions are evaluated in UTC, whatever the
+	// time zone of the controller
+	t := from.UTC().Truncate(time.Minute).Add(time.Minute)
+
+	// Give up when nothing matches within 5 years, e.g. 30th of February
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,77 @@
+package utilities
+
+import (
+	"testing"
+	"time"
+)
+
+func mustTime(t *testing.T, value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("invalid time %s: %v", value, err)
+	}
+	return parsed
+}
+
+func TestParseScheduleNext(t *testing.T) {
+	from := "2019-01-02T10:17:30Z" // Wednesday
+
+	cases := []struct {
+		spec string
+		next string
+	}{
+		{"2019-01-05T03:00:00Z", "2019-01-05T03:00:00Z"},
+		{"2018-12-31T00:00:00Z", "2018-12-31T00:00:00Z"},
+		{"90s", "2019-01-02T10:19:00Z"},
+		{"*/15 * * * *", "2019-01-02T10:30:00Z"},
+		{"0 2 * * *", "2019-01-03T02:00:00Z"},
+		{"30 2 * * 6", "2019-01-05T02:30:00Z"},
+		{"0 0 * * 7", "2019-01-06T00:00:00Z"},
+		{"0 22-23 * * 1-5", "2019-01-02T22:00:00Z"},
+		{"0 0 1,15 * *", "2019-01-15T00:00:00Z"},
+		{"0 0 1 * 1", "2019-01-07T00:00:00Z"},
+		{"@monthly", "2019-02-01T00:00:00Z"},
+		{"@hourly", "2019-01-02T11:00:00Z"},
+	}
+
+	for _, tc := range cases {
+		schedule, err := ParseSchedule(tc.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.spec, err)
+			continue
+		}
+		if next := schedule.Next(mustTime(t, from)); !next.Equal(mustTime(t, tc.next)) {
+			t.Errorf("%s: expected next %s, got %s", tc.spec, tc.next, next.Format(time.RFC3339))
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{"", "tomorrow", "-1m", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestCronScheduleNeverActivates(t *testing.T) {
+	schedule, err := ParseSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next := schedule.Next(mustTime(t, "2019-01-02T10:17:30Z")); !next.IsZero() {
+		t.Errorf("expected no activation, got %s", next)
+	}
+}
+
+func TestCronScheduleIsUTC(t *testing.T) {
+	schedule, err := ParseSchedule("30 2 * * 6")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The controller runs in another time zone, Wednesday 18:17 UTC is already Thursday there
+	from := mustTime(t, "2019-01-02T18:17:30Z").In(time.FixedZone("UTC+8", 8*60*60))
+	if next := schedule.Next(from); !next.Equal(mustTime(t, "2019-01-05T02:30:00Z")) {
+		t.Errorf("expected next 2019-01-05T02:30:00Z, got %s", next.UTC().Format(time.RFC3339))
+	}
+}
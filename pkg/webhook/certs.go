@@ -0,0 +1,248 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	caCertKey = "ca.crt"
+	caKeyKey  = "ca.key"
+
+	caValidity   = 10 * 365 * 24 * time.Hour
+	certValidity = 365 * 24 * time.Hour
+	// renewBefore is how long before they expire the certificates are renewed
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// certificates are the PEM encoded self-signed CA, which the API server trusts through the webhook configuration,
+// and the serving certificate it signs
+type certificates struct {
+	caCert []byte
+	caKey  []byte
+	cert   []byte
+	key    []byte
+}
+
+func certificatesFromSecret(secret *corev1.Secret) *certificates {
+	return &certificates{
+		caCert: secret.Data[caCertKey],
+		caKey:  secret.Data[caKeyKey],
+		cert:   secret.Data[corev1.TLSCertKey],
+		key:    secret.Data[corev1.TLSPrivateKeyKey],
+	}
+}
+
+func (c *certificates) secretData() map[string][]byte {
+	return map[string][]byte{
+		caCertKey:               c.caCert,
+		caKeyKey:                c.caKey,
+		corev1.TLSCertKey:       c.cert,
+		corev1.TLSPrivateKeyKey: c.key,
+	}
+}
+
+func (c *certificates) equal(other *certificates) bool {
+	return bytes.Equal(c.caCert, other.caCert) && bytes.Equal(c.caKey, other.caKey) &&
+		bytes.Equal(c.cert, other.cert) && bytes.Equal(c.key, other.key)
+}
+
+// checkCA returns an error when the CA or its key is missing or the CA expires within renewBefore
+func (c *certificates) checkCA(now time.Time) error {
+	ca, err := parseCertificate(c.caCert)
+	if err != nil {
+		return err
+	}
+	if _, err := parseKey(c.caKey); err != nil {
+		return err
+	}
+	if now.Add(renewBefore).After(ca.NotAfter) {
+		return fmt.Errorf("CA expires at %s", ca.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// checkServing returns an error when the serving certificate is missing, is not signed by the CA, does not cover
+// every name of dnsNames or expires within renewBefore
+func (c *certificates) checkServing(dnsNames []string, now time.Time) error {
+	cert, err := parseCertificate(c.cert)
+	if err != nil {
+		return err
+	}
+	if _, err := parseKey(c.key); err != nil {
+		return err
+	}
+	if now.Add(renewBefore).After(cert.NotAfter) {
+		return fmt.Errorf("certificate expires at %s", cert.NotAfter.Format(time.RFC3339))
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(c.caCert)
+	for _, name := range dnsNames {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots, CurrentTime: now}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renew returns the certificates with a new CA and a new serving certificate where they are not valid anymore
+func (c *certificates) renew(dnsNames []string, now time.Time) (*certificates, error) {
+	renewed := *c
+	if err := c.checkCA(now); err != nil {
+		klog.Infof("Generating webhook CA: %s", err.Error())
+		if renewed.caCert, renewed.caKey, err = generateCA(now); err != nil {
+			return nil, err
+		}
+	}
+	if err := renewed.checkServing(dnsNames, now); err != nil {
+		klog.Infof("Generating webhook serving certificate: %s", err.Error())
+		if renewed.cert, renewed.key, err = generateServing(renewed.caCert, renewed.caKey, dnsNames, now); err != nil {
+			return nil, err
+		}
+	}
+	return &renewed, nil
+}
+
+// ensureCertificates returns the certificates of the Secret, creating the Secret or renewing its certificates when
+// needed. When replicas race to write the Secret, all of them keep the certificates of the first one.
+func ensureCertificates(client kubernetes.Interface, namespace, name string, dnsNames []string, now time.Time) (*certificates, error) {
+	secrets := client.CoreV1().Secrets(namespace)
+	for attempt := 0; ; attempt++ {
+		secret, err := secrets.Get(name, metav1.GetOptions{})
+		exists := err == nil
+		if errors.IsNotFound(err) {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Type:       corev1.SecretTypeTLS,
+			}
+		} else if err != nil {
+			return nil, err
+		}
+
+		current := certificatesFromSecret(secret)
+		renewed, err := current.renew(dnsNames, now)
+		if err != nil {
+			return nil, err
+		}
+		if renewed.equal(current) {
+			return current, nil
+		}
+
+		secret.Data = renewed.secretData()
+		if exists {
+			_, err = secrets.Update(secret)
+		} else {
+			_, err = secrets.Create(secret)
+		}
+		if err == nil {
+			klog.Infof("Stored webhook certificates in secret %s/%s", namespace, name)
+			return renewed, nil
+		}
+		// Another replica wrote the Secret first, use its certificates
+		if attempt == 0 && (errors.IsAlreadyExists(err) || errors.IsConflict(err)) {
+			continue
+		}
+		return nil, err
+	}
+}
+
+// serviceDNSNames are the names the API server may use to reach the webhook Service
+func serviceDNSNames(service, namespace string) []string {
+	return []string{
+		service,
+		service + "." + namespace,
+		service + "." + namespace + ".svc",
+		service + "." + namespace + ".svc.cluster.local",
+	}
+}
+
+func generateCA(now time.Time) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "deploydaemon-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	return createCertificate(template, template, key, key)
+}
+
+func generateServing(caCertPEM, caKeyPEM []byte, dnsNames []string, now time.Time) ([]byte, []byte, error) {
+	ca, err := parseCertificate(caCertPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	caKey, err := parseKey(caKeyPEM)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: dnsNames[len(dnsNames)-1]},
+		DNSNames:    dnsNames,
+		NotBefore:   now.Add(-time.Hour),
+		NotAfter:    now.Add(certValidity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	return createCertificate(template, ca, key, caKey)
+}
+
+// createCertificate signs template with the key of parent and returns it with key, PEM encoded
+func createCertificate(template, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) ([]byte, []byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	template.SerialNumber = serial
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM encoded certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func parseKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("no PEM encoded EC private key")
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1beta1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/config"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog"
+)
+
+// crdResource is the resource of the CustomResourceDefinitions, the conversion webhook is registered in the one of
+// the deploydaemons
+var crdResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1beta1", Resource: "customresourcedefinitions"}
+
+// crdName is the name of the CustomResourceDefinition of the deploydaemons
+var crdName = "deploydaemons." + v1alpha1.SchemeGroupVersion.Group
+
+// conversionReview is the apiextensions.k8s.io/v1beta1 ConversionReview the API server sends to convert custom
+// resources between their versions. The vendored API does not have it.
+type conversionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *conversionRequest  `json:"request,omitempty"`
+	Response        *conversionResponse `json:"response,omitempty"`
+}
+
+type conversionRequest struct {
+	UID types.UID `json:"uid"`
+	// DesiredAPIVersion is the group/version the objects are converted to
+	DesiredAPIVersion string                 `json:"desiredAPIVersion"`
+	Objects           []runtime.RawExtension `json:"objects"`
+}
+
+type conversionResponse struct {
+	UID types.UID `json:"uid"`
+	// ConvertedObjects are in the order of the objects of the request
+	ConvertedObjects []runtime.RawExtension `json:"convertedObjects"`
+	Result           metav1.Status          `json:"result"`
+}
+
+// conversionHandler decodes the ConversionReview sent by the API server and writes it back with the converted objects
+func conversionHandler(w http.ResponseWriter, r *http.Request) {
+	body, ok := readReview(w, r)
+	if !ok {
+		return
+	}
+	var review conversionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "request is not a ConversionReview", http.StatusBadRequest)
+		return
+	}
+
+	request := review.Request
+	response := convert(request)
+	response.UID = request.UID
+	klog.V(4).Infof("conversion of %d deploydaemons to %s: %s", len(request.Objects), request.DesiredAPIVersion, response.Result.Status)
+
+	review.Request = nil
+	review.Response = response
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(&review); err != nil {
+		klog.Errorf("write conversion review failed: %s", err.Error())
+	}
+}
+
+// convert converts the deploydaemons of request to its desired version, the whole request fails with one object
+func convert(request *conversionRequest) *conversionResponse {
+	response := &conversionResponse{ConvertedObjects: make([]runtime.RawExtension, len(request.Objects))}
+	for i, object := range request.Objects {
+		converted, err := convertDeployDaemon(object.Raw, request.DesiredAPIVersion)
+		if err != nil {
+			klog.Errorf("conversion of a deploydaemon to %s failed: %s", request.DesiredAPIVersion, err.Error())
+			response.ConvertedObjects = nil
+			response.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+			return response
+		}
+		response.ConvertedObjects[i] = runtime.RawExtension{Raw: converted}
+	}
+	response.Result = metav1.Status{Status: metav1.StatusSuccess}
+	return response
+}
+
+// convertDeployDaemon returns the JSON of the deploydaemon raw in the version desiredAPIVersion
+func convertDeployDaemon(raw []byte, desiredAPIVersion string) ([]byte, error) {
+	var typeMeta metav1.TypeMeta
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return nil, err
+	}
+	if typeMeta.Kind != "DeployDaemon" {
+		return nil, fmt.Errorf("unexpected kind %q", typeMeta.Kind)
+	}
+	if typeMeta.APIVersion == desiredAPIVersion {
+		return raw, nil
+	}
+
+	alpha, beta := v1alpha1.SchemeGroupVersion.String(), v1beta1.SchemeGroupVersion.String()
+	switch {
+	case typeMeta.APIVersion == alpha && desiredAPIVersion == beta:
+		deploydaemon := &v1alpha1.DeployDaemon{}
+		if err := json.Unmarshal(raw, deploydaemon); err != nil {
+			return nil, err
+		}
+		return json.Marshal(v1beta1.ConvertFromV1alpha1(deploydaemon))
+	case typeMeta.APIVersion == beta && desiredAPIVersion == alpha:
+		deploydaemon := &v1beta1.DeployDaemon{}
+		if err := json.Unmarshal(raw, deploydaemon); err != nil {
+			return nil, err
+		}
+		return json.Marshal(v1beta1.ConvertToV1alpha1(deploydaemon))
+	}
+	return nil, fmt.Errorf("unsupported conversion from %s to %s", typeMeta.APIVersion, desiredAPIVersion)
+}
+
+// registerConversion points the conversion of the CustomResourceDefinition of the deploydaemons to the webhook,
+// trusting caBundle. The definition is only updated when its conversion changes.
+func registerConversion(client dynamic.Interface, webhook config.Webhook, caBundle []byte) error {
+	conversion := crdConversion(webhook, caBundle)
+
+	crds := client.Resource(crdResource)
+	crd, err := crds.Get(crdName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	existing, _, err := unstructured.NestedMap(crd.Object, "spec", "conversion")
+	if err != nil {
+		return err
+	}
+	// The API server defaults the fields left empty
+	if equality.Semantic.DeepDerivative(conversion, existing) {
+		return nil
+	}
+	klog.Infof("Updating the conversion of custom resource definition %s", crdName)
+	if err := unstructured.SetNestedMap(crd.Object, conversion, "spec", "conversion"); err != nil {
+		return err
+	}
+	_, err = crds.Update(crd, metav1.UpdateOptions{})
+	return err
+}
+
+// crdConversion returns the webhook conversion of the CustomResourceDefinition, as unstructured JSON
+func crdConversion(webhook config.Webhook, caBundle []byte) map[string]interface{} {
+	clientConfig := clientConfig(webhook, ConvertPath, caBundle)
+	data, _ := json.Marshal(map[string]interface{}{
+		"strategy":                 "Webhook",
+		"webhookClientConfig":      clientConfig,
+		"conversionReviewVersions": []string{"v1beta1"},
+	})
+	conversion := map[string]interface{}{}
+	json.Unmarshal(data, &conversion)
+	return conversion
+}
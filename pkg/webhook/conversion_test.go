@@ -0,0 +1,208 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1beta1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/config"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func conversion(t *testing.T, desiredAPIVersion string, objects ...interface{}) *conversionResponse {
+	request := &conversionRequest{UID: types.UID("conversion-1"), DesiredAPIVersion: desiredAPIVersion}
+	for _, object := range objects {
+		raw, _ := json.Marshal(object)
+		request.Objects = append(request.Objects, runtime.RawExtension{Raw: raw})
+	}
+	body, _ := json.Marshal(&conversionReview{Request: request})
+
+	r := httptest.NewRequest(http.MethodPost, ConvertPath, bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	NewHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result conversionReview
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("invalid conversion review: %s", err.Error())
+	}
+	if result.Response == nil || result.Response.UID != request.UID {
+		t.Fatalf("expected a response to conversion-1, got %+v", result.Response)
+	}
+	return result.Response
+}
+
+func newV1alpha1DeployDaemon() *v1alpha1.DeployDaemon {
+	dd := newDeployDaemon()
+	dd.APIVersion, dd.Kind = v1alpha1.SchemeGroupVersion.String(), "DeployDaemon"
+	dd.Spec.Scheduler = "10m"
+	return dd
+}
+
+func TestConvertHandler(t *testing.T) {
+	alpha := newV1alpha1DeployDaemon()
+	response := conversion(t, v1beta1.SchemeGroupVersion.String(), alpha)
+	if response.Result.Status != metav1.StatusSuccess || len(response.ConvertedObjects) != 1 {
+		t.Fatalf("expected one converted object, got %+v", response)
+	}
+	beta := &v1beta1.DeployDaemon{}
+	if err := json.Unmarshal(response.ConvertedObjects[0].Raw, beta); err != nil {
+		t.Fatal(err)
+	}
+	if beta.APIVersion != v1beta1.SchemeGroupVersion.String() || beta.Spec.Schedule == nil || beta.Spec.Schedule.Delay.Duration != 10*time.Minute {
+		t.Errorf("expected a v1beta1 deploydaemon with a delay of 10m, got %s", response.ConvertedObjects[0].Raw)
+	}
+
+	// Both versions may be sent, the objects of the desired version are left unchanged
+	response = conversion(t, v1alpha1.SchemeGroupVersion.String(), beta, alpha)
+	if response.Result.Status != metav1.StatusSuccess || len(response.ConvertedObjects) != 2 {
+		t.Fatalf("expected two converted objects, got %+v", response)
+	}
+	for i, object := range response.ConvertedObjects {
+		converted := &v1alpha1.DeployDaemon{}
+		if err := json.Unmarshal(object.Raw, converted); err != nil {
+			t.Fatal(err)
+		}
+		if !equality.Semantic.DeepEqual(converted, alpha) {
+			t.Errorf("object %d: expected %+v, got %s", i, alpha, object.Raw)
+		}
+	}
+
+	if response := conversion(t, "deploycontrol.k8s.io/v2", alpha); response.Result.Status != metav1.StatusFailure || response.ConvertedObjects != nil {
+		t.Errorf("expected the conversion to an unknown version to fail, got %+v", response)
+	}
+}
+
+func TestValidateHandlerV1beta1(t *testing.T) {
+	validate := func(beta *v1beta1.DeployDaemon) *admissionv1beta1.AdmissionResponse {
+		request := &admissionv1beta1.AdmissionRequest{
+			UID:       types.UID("review-1"),
+			Kind:      metav1.GroupVersionKind{Group: v1beta1.SchemeGroupVersion.Group, Version: v1beta1.SchemeGroupVersion.Version, Kind: "DeployDaemon"},
+			Operation: admissionv1beta1.Create,
+			Name:      beta.Name,
+			Namespace: beta.Namespace,
+		}
+		request.Object.Raw, _ = json.Marshal(beta)
+		return sendReview(t, ValidatePath, request)
+	}
+
+	if response := validate(v1beta1.ConvertFromV1alpha1(newV1alpha1DeployDaemon())); !response.Allowed {
+		t.Errorf("expected a valid deploydaemon to be allowed, got %+v", response.Result)
+	}
+
+	invalid := v1beta1.ConvertFromV1alpha1(newV1alpha1DeployDaemon())
+	invalid.Spec.Replicas = nil
+	invalid.Spec.SecretRefs[0].EnvName = ""
+	invalid.Spec.Schedule.Cron = "@daily"
+	response := validate(invalid)
+	if response.Allowed || response.Result == nil || response.Result.Details == nil {
+		t.Fatalf("expected an invalid deploydaemon to be rejected, got %+v", response)
+	}
+	var fields []string
+	for _, cause := range response.Result.Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	expected := []string{"spec.replicas", "spec.secretRefs[0].envName", "spec.schedule"}
+	if !equality.Semantic.DeepEqual(fields, expected) {
+		t.Errorf("expected causes %v, got %v", expected, fields)
+	}
+	if response.Result.Details.Group != v1beta1.SchemeGroupVersion.Group {
+		t.Errorf("expected group %s, got %s", v1beta1.SchemeGroupVersion.Group, response.Result.Details.Group)
+	}
+}
+
+func TestMutateHandlerV1beta1(t *testing.T) {
+	beta := v1beta1.ConvertFromV1alpha1(newV1alpha1DeployDaemon())
+	beta.Spec.Tenant = "Demo"
+	beta.Spec.Replicas = nil
+
+	request := &admissionv1beta1.AdmissionRequest{
+		UID:       types.UID("review-1"),
+		Kind:      metav1.GroupVersionKind{Group: v1beta1.SchemeGroupVersion.Group, Version: v1beta1.SchemeGroupVersion.Version, Kind: "DeployDaemon"},
+		Operation: admissionv1beta1.Create,
+	}
+	request.Object.Raw, _ = json.Marshal(beta)
+	response := sendReview(t, MutatePath, request)
+	if !response.Allowed || response.Patch == nil {
+		t.Fatalf("expected an allowed response with a patch, got %+v", response)
+	}
+	patch, err := jsonpatch.DecodePatch(response.Patch)
+	if err != nil {
+		t.Fatalf("invalid patch %s: %s", response.Patch, err.Error())
+	}
+	patched, err := patch.Apply(request.Object.Raw)
+	if err != nil {
+		t.Fatalf("apply patch %s failed: %s", response.Patch, err.Error())
+	}
+
+	mutated := &v1beta1.DeployDaemon{}
+	if err := json.Unmarshal(patched, mutated); err != nil {
+		t.Fatal(err)
+	}
+	if mutated.Spec.Tenant != "demo" || mutated.Spec.Replicas == nil || *mutated.Spec.Replicas != v1alpha1.DefaultInstance {
+		t.Errorf("expected the v1beta1 fields to be defaulted, got %s", patched)
+	}
+	if mutated.Labels[v1alpha1.TenantLabel] != "demo" {
+		t.Errorf("expected the labels to be set, got %v", mutated.Labels)
+	}
+}
+
+func newCRD() *unstructured.Unstructured {
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1beta1")
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName(crdName)
+	unstructured.SetNestedField(crd.Object, "deploycontrol.k8s.io", "spec", "group")
+	return crd
+}
+
+func TestRegisterConversion(t *testing.T) {
+	client := fake.NewSimpleDynamicClient(runtime.NewScheme(), newCRD())
+	webhook := config.Webhook{Addr: ":9443", ServiceName: "deploydaemon-operator", ServiceNamespace: "operators"}
+
+	for _, ca := range []string{"ca-1", "ca-1", "ca-2"} {
+		if err := registerConversion(client, webhook, []byte(ca)); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	updates := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" {
+			updates++
+		}
+	}
+	if updates != 2 {
+		t.Errorf("expected updates for the new CA only, got %d", updates)
+	}
+
+	crd, _ := client.Resource(crdResource).Get(crdName, metav1.GetOptions{})
+	if strategy, _, _ := unstructured.NestedString(crd.Object, "spec", "conversion", "strategy"); strategy != "Webhook" {
+		t.Errorf("expected the Webhook strategy, got %q", strategy)
+	}
+	if path, _, _ := unstructured.NestedString(crd.Object, "spec", "conversion", "webhookClientConfig", "service", "path"); path != ConvertPath {
+		t.Errorf("expected the webhook path %s, got %q", ConvertPath, path)
+	}
+	// The CA bundle is base64 encoded like the other bytes
+	if caBundle, _, _ := unstructured.NestedString(crd.Object, "spec", "conversion", "webhookClientConfig", "caBundle"); caBundle != "Y2EtMg==" {
+		t.Errorf("expected the second CA, got %q", caBundle)
+	}
+	if group, _, _ := unstructured.NestedString(crd.Object, "spec", "group"); group != "deploycontrol.k8s.io" {
+		t.Errorf("expected the rest of the definition to be kept, got %v", crd.Object["spec"])
+	}
+}
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// patchOperation is an operation of a JSON patch, RFC 6902. Value is always encoded since an added value may be
+// empty, a remove ignores it.
+type patchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// createPatch returns the JSON patch turning the JSON encoding of original into the one of modified. A changed
+// member is added, which replaces it when it exists, and arrays are replaced as a whole.
+func createPatch(original, modified interface{}) ([]patchOperation, error) {
+	var from, to interface{}
+	if err := roundTrip(original, &from); err != nil {
+		return nil, err
+	}
+	if err := roundTrip(modified, &to); err != nil {
+		return nil, err
+	}
+	patch := []patchOperation{}
+	diffJSON("", from, to, &patch)
+	return patch, nil
+}
+
+func roundTrip(object interface{}, into *interface{}) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+func diffJSON(path string, from, to interface{}, patch *[]patchOperation) {
+	fromObject, fromIsObject := from.(map[string]interface{})
+	toObject, toIsObject := to.(map[string]interface{})
+	if !fromIsObject || !toIsObject {
+		if !reflect.DeepEqual(from, to) {
+			*patch = append(*patch, patchOperation{Op: "add", Path: path, Value: to})
+		}
+		return
+	}
+
+	// Sorted keys keep the patch stable
+	keys := make([]string, 0, len(fromObject)+len(toObject))
+	for key := range fromObject {
+		keys = append(keys, key)
+	}
+	for key := range toObject {
+		if _, ok := fromObject[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		memberPath := path + "/" + escapePointer(key)
+		fromValue, inFrom := fromObject[key]
+		toValue, inTo := toObject[key]
+		switch {
+		case !inTo:
+			*patch = append(*patch, patchOperation{Op: "remove", Path: memberPath})
+		case !inFrom:
+			*patch = append(*patch, patchOperation{Op: "add", Path: memberPath, Value: toValue})
+		default:
+			diffJSON(memberPath, fromValue, toValue, patch)
+		}
+	}
+}
+
+// escapePointer escapes a member name for a JSON pointer, RFC 6901
+func escapePointer(name string) string {
+	return strings.Replace(strings.Replace(name, "~", "~0", -1), "/", "~1", -1)
+}
@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1beta1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/config"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// The names of the webhooks in the configurations, they must be fully qualified
+const (
+	validatingWebhookName = "validate.deploycontrol.k8s.io"
+	mutatingWebhookName   = "default.deploycontrol.k8s.io"
+)
+
+// deploydaemonRules select the creates and updates of deploydaemons of every served version, status updates excluded
+func deploydaemonRules() []admissionregistrationv1beta1.RuleWithOperations {
+	return []admissionregistrationv1beta1.RuleWithOperations{{
+		Operations: []admissionregistrationv1beta1.OperationType{
+			admissionregistrationv1beta1.Create,
+			admissionregistrationv1beta1.Update,
+		},
+		Rule: admissionregistrationv1beta1.Rule{
+			APIGroups:   []string{v1alpha1.SchemeGroupVersion.Group},
+			APIVersions: []string{v1alpha1.SchemeGroupVersion.Version, v1beta1.SchemeGroupVersion.Version},
+			Resources:   []string{"deploydaemons"},
+		},
+	}}
+}
+
+// clientConfig points the API server to path on the webhook Service, trusting caBundle
+func clientConfig(webhook config.Webhook, path string, caBundle []byte) admissionregistrationv1beta1.WebhookClientConfig {
+	return admissionregistrationv1beta1.WebhookClientConfig{
+		Service: &admissionregistrationv1beta1.ServiceReference{
+			Namespace: webhook.ServiceNamespace,
+			Name:      webhook.ServiceName,
+			Path:      &path,
+		},
+		CABundle: caBundle,
+	}
+}
+
+// webhookFor returns the webhook named name calling path, failing the admission when it can not be reached
+func webhookFor(name string, webhook config.Webhook, path string, caBundle []byte) admissionregistrationv1beta1.Webhook {
+	failurePolicy := admissionregistrationv1beta1.Fail
+	sideEffects := admissionregistrationv1beta1.SideEffectClassNone
+	return admissionregistrationv1beta1.Webhook{
+		Name:          name,
+		ClientConfig:  clientConfig(webhook, path, caBundle),
+		Rules:         deploydaemonRules(),
+		FailurePolicy: &failurePolicy,
+		SideEffects:   &sideEffects,
+	}
+}
+
+// registerWebhooks creates or updates the validating and mutating webhook configurations named after the Service, so
+// every operator instance registers its own
+func registerWebhooks(client kubernetes.Interface, webhook config.Webhook, caBundle []byte) error {
+	if err := registerValidatingWebhook(client, webhook, caBundle); err != nil {
+		return err
+	}
+	return registerMutatingWebhook(client, webhook, caBundle)
+}
+
+func registerValidatingWebhook(client kubernetes.Interface, webhook config.Webhook, caBundle []byte) error {
+	webhooks := []admissionregistrationv1beta1.Webhook{webhookFor(validatingWebhookName, webhook, ValidatePath, caBundle)}
+
+	configurations := client.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations()
+	existing, err := configurations.Get(webhook.ServiceName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		klog.Infof("Creating validating webhook configuration %s", webhook.ServiceName)
+		_, err = configurations.Create(&admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: webhook.ServiceName},
+			Webhooks:   webhooks,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	// The API server defaults the fields left empty
+	if equality.Semantic.DeepDerivative(webhooks, existing.Webhooks) {
+		return nil
+	}
+	klog.Infof("Updating validating webhook configuration %s", webhook.ServiceName)
+	existing.Webhooks = webhooks
+	_, err = configurations.Update(existing)
+	return err
+}
+
+func registerMutatingWebhook(client kubernetes.Interface, webhook config.Webhook, caBundle []byte) error {
+	webhooks := []admissionregistrationv1beta1.Webhook{webhookFor(mutatingWebhookName, webhook, MutatePath, caBundle)}
+
+	configurations := client.AdmissionregistrationV1beta1().MutatingWebhookConfigurations()
+	existing, err := configurations.Get(webhook.ServiceName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		klog.Infof("Creating mutating webhook configuration %s", webhook.ServiceName)
+		_, err = configurations.Create(&admissionregistrationv1beta1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: webhook.ServiceName},
+			Webhooks:   webhooks,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if equality.Semantic.DeepDerivative(webhooks, existing.Webhooks) {
+		return nil
+	}
+	klog.Infof("Updating mutating webhook configuration %s", webhook.ServiceName)
+	existing.Webhooks = webhooks
+	_, err = configurations.Update(existing)
+	return err
+}
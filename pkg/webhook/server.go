@@ -0,0 +1,277 @@
+package webhook
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1beta1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/config"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+const (
+	// ValidatePath is the path the validating webhook is served on
+	ValidatePath = "/validate-deploydaemon"
+	// MutatePath is the path the defaulting webhook is served on
+	MutatePath = "/mutate-deploydaemon"
+	// ConvertPath is the path the conversion webhook between the versions of the deploydaemons is served on
+	ConvertPath = "/convert"
+
+	// certificateCheckPeriod is how often the certificates of the Secret are checked, renewed and reloaded
+	certificateCheckPeriod = time.Hour
+	// maxReviewBytes limits the size of an admission review
+	maxReviewBytes = 3 * 1024 * 1024
+)
+
+// reviewFunc answers the admission request of a deploydaemon
+type reviewFunc func(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse
+
+// NewHandler returns the handler of the admission and conversion reviews sent by the API server
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, admissionHandler(validate))
+	mux.Handle(MutatePath, admissionHandler(mutate))
+	mux.HandleFunc(ConvertPath, conversionHandler)
+	return mux
+}
+
+// Run serves the webhook over HTTPS with the certificates of the Secret and registers it to the API server, it
+// returns once stopCh is closed. The certificates are renewed and reloaded while the webhook runs.
+func Run(webhook config.Webhook, client kubernetes.Interface, dynamicClient dynamic.Interface, stopCh <-chan struct{}) error {
+	dnsNames := serviceDNSNames(webhook.ServiceName, webhook.ServiceNamespace)
+	served := &servedCertificate{}
+	if err := served.sync(webhook, client, dynamicClient, dnsNames); err != nil {
+		return err
+	}
+	go wait.Until(func() {
+		if err := served.sync(webhook, client, dynamicClient, dnsNames); err != nil {
+			klog.Errorf("sync webhook certificates failed: %s", err.Error())
+		}
+	}, certificateCheckPeriod, stopCh)
+
+	server := &http.Server{
+		Addr:      webhook.Addr,
+		Handler:   NewHandler(),
+		TLSConfig: &tls.Config{GetCertificate: served.get},
+	}
+	go func() {
+		<-stopCh
+		server.Close()
+	}()
+
+	klog.Infof("Serving admission webhook on %s", webhook.Addr)
+	if err := server.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// servedCertificate is the serving certificate, swapped when the certificates of the Secret change
+type servedCertificate struct {
+	lock        sync.RWMutex
+	certs       *certificates
+	certificate *tls.Certificate
+}
+
+func (s *servedCertificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.certificate, nil
+}
+
+// sync loads the certificates of the Secret, renewing them when needed, and registers the webhook with their CA
+func (s *servedCertificate) sync(webhook config.Webhook, client kubernetes.Interface, dynamicClient dynamic.Interface, dnsNames []string) error {
+	certs, err := ensureCertificates(client, webhook.ServiceNamespace, webhook.SecretName, dnsNames, time.Now())
+	if err != nil {
+		return fmt.Errorf("ensure certificates in secret %s/%s failed: %s", webhook.ServiceNamespace, webhook.SecretName, err.Error())
+	}
+	if err := registerWebhooks(client, webhook, certs.caCert); err != nil {
+		return fmt.Errorf("register webhook configuration %s failed: %s", webhook.ServiceName, err.Error())
+	}
+	if err := registerConversion(dynamicClient, webhook, certs.caCert); err != nil {
+		return fmt.Errorf("register conversion webhook in custom resource definition %s failed: %s", crdName, err.Error())
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.certs != nil && s.certs.equal(certs) {
+		return nil
+	}
+	certificate, err := tls.X509KeyPair(certs.cert, certs.key)
+	if err != nil {
+		return err
+	}
+	s.certs, s.certificate = certs, &certificate
+	return nil
+}
+
+// admissionHandler decodes the AdmissionReview sent by the API server and writes it back with the response of review
+func admissionHandler(review reviewFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readReview(w, r)
+		if !ok {
+			return
+		}
+		var admissionReview admissionv1beta1.AdmissionReview
+		if err := json.Unmarshal(body, &admissionReview); err != nil || admissionReview.Request == nil {
+			http.Error(w, "request is not an AdmissionReview", http.StatusBadRequest)
+			return
+		}
+
+		request := admissionReview.Request
+		response := review(request)
+		response.UID = request.UID
+		klog.V(4).Infof("%s of deploydaemon %s/%s allowed: %t", request.Operation, request.Namespace, request.Name, response.Allowed)
+
+		admissionReview.Request = nil
+		admissionReview.Response = response
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(&admissionReview); err != nil {
+			klog.Errorf("write admission review failed: %s", err.Error())
+		}
+	}
+}
+
+// readReview reads the body of a review sent by the API server, it writes the error and returns false when the request
+// is not one
+func readReview(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+		http.Error(w, fmt.Sprintf("unsupported content type %q, only application/json is supported", contentType), http.StatusUnsupportedMediaType)
+		return nil, false
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxReviewBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// isV1beta1 returns true when the object of request is a v1beta1 deploydaemon, the other requests are v1alpha1
+func isV1beta1(request *admissionv1beta1.AdmissionRequest) bool {
+	return request.Kind.Version == v1beta1.SchemeGroupVersion.Version
+}
+
+// decodeDeployDaemon decodes raw, a deploydaemon of the version of request, as v1alpha1, the version the validation
+// and the defaults are written for
+func decodeDeployDaemon(request *admissionv1beta1.AdmissionRequest, raw []byte) (*v1alpha1.DeployDaemon, error) {
+	if !isV1beta1(request) {
+		deploydaemon := &v1alpha1.DeployDaemon{}
+		if err := json.Unmarshal(raw, deploydaemon); err != nil {
+			return nil, err
+		}
+		return deploydaemon, nil
+	}
+	deploydaemon := &v1beta1.DeployDaemon{}
+	if err := json.Unmarshal(raw, deploydaemon); err != nil {
+		return nil, err
+	}
+	return v1beta1.ConvertToV1alpha1(deploydaemon), nil
+}
+
+// validate allows the deploydaemons without validation errors
+func validate(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	deploydaemon, err := decodeDeployDaemon(request, request.Object.Raw)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err)
+	}
+
+	var errs field.ErrorList
+	if request.Operation == admissionv1beta1.Update {
+		old, err := decodeDeployDaemon(request, request.OldObject.Raw)
+		if err != nil {
+			return errorResponse(http.StatusBadRequest, err)
+		}
+		errs = ValidateDeployDaemonUpdate(deploydaemon, old)
+	} else {
+		errs = ValidateDeployDaemon(deploydaemon)
+	}
+	gvk := v1alpha1.SchemeGroupVersion.WithKind("DeployDaemon")
+	if isV1beta1(request) {
+		errs = validateV1beta1(request.Object.Raw, errs)
+		gvk = v1beta1.SchemeGroupVersion.WithKind("DeployDaemon")
+	}
+
+	if len(errs) > 0 {
+		name := deploydaemon.Name
+		if name == "" {
+			name = request.Name
+		}
+		klog.Infof("rejected %s of deploydaemon %s/%s: %s", request.Operation, request.Namespace, name, errs.ToAggregate().Error())
+		status := apierrors.NewInvalid(gvk.GroupKind(), name, errs).ErrStatus
+		return &admissionv1beta1.AdmissionResponse{Allowed: false, Result: &status}
+	}
+	return &admissionv1beta1.AdmissionResponse{Allowed: true}
+}
+
+// mutate allows the deploydaemons with the patch applying their defaults, the same the controller applies
+func mutate(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	deploydaemon, err := decodeDeployDaemon(request, request.Object.Raw)
+	if err != nil {
+		return errorResponse(http.StatusBadRequest, err)
+	}
+	// A deleted deploydaemon only loses its finalizer, there is nothing to default
+	if deploydaemon.DeletionTimestamp != nil {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+
+	var old *v1alpha1.DeployDaemon
+	if request.Operation == admissionv1beta1.Update {
+		if old, err = decodeDeployDaemon(request, request.OldObject.Raw); err != nil {
+			return errorResponse(http.StatusBadRequest, err)
+		}
+	}
+
+	defaulted := deploydaemon.DeepCopy()
+	v1alpha1.SetDeployDaemonDefaults(defaulted, old)
+	// The patch of a v1beta1 deploydaemon is computed on its v1beta1 versions, so it only holds the defaults
+	var original, modified interface{} = deploydaemon, defaulted
+	if isV1beta1(request) {
+		original, modified = v1beta1.ConvertFromV1alpha1(deploydaemon), v1beta1.ConvertFromV1alpha1(defaulted)
+	}
+	patch, err := createPatch(original, modified)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err)
+	}
+	if len(patch) == 0 {
+		return &admissionv1beta1.AdmissionResponse{Allowed: true}
+	}
+
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, err)
+	}
+	klog.V(4).Infof("defaulting %s of deploydaemon %s/%s: %s", request.Operation, request.Namespace, request.Name, data)
+	patchType := admissionv1beta1.PatchTypeJSONPatch
+	return &admissionv1beta1.AdmissionResponse{Allowed: true, Patch: data, PatchType: &patchType}
+}
+
+func errorResponse(code int32, err error) *admissionv1beta1.AdmissionResponse {
+	return &admissionv1beta1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Code:    code,
+			Message: err.Error(),
+		},
+	}
+}
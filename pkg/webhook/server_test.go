@@ -0,0 +1,244 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/config"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func review(t *testing.T, path string, operation admissionv1beta1.Operation, dd, old *v1alpha1.DeployDaemon) *admissionv1beta1.AdmissionResponse {
+	request := &admissionv1beta1.AdmissionRequest{
+		UID:       types.UID("review-1"),
+		Operation: operation,
+		Name:      dd.Name,
+		Namespace: dd.Namespace,
+	}
+	request.Object.Raw, _ = json.Marshal(dd)
+	if old != nil {
+		request.OldObject.Raw, _ = json.Marshal(old)
+	}
+	return sendReview(t, path, request)
+}
+
+// sendReview sends the admission review of request to the handler on path and returns its response
+func sendReview(t *testing.T, path string, request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	body, _ := json.Marshal(&admissionv1beta1.AdmissionReview{Request: request})
+
+	r := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	NewHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result admissionv1beta1.AdmissionReview
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("invalid admission review: %s", err.Error())
+	}
+	if result.Response == nil || result.Response.UID != request.UID {
+		t.Fatalf("expected a response to %s, got %+v", request.UID, result.Response)
+	}
+	return result.Response
+}
+
+func TestValidateHandler(t *testing.T) {
+	if response := review(t, ValidatePath, admissionv1beta1.Create, newDeployDaemon(), nil); !response.Allowed {
+		t.Errorf("expected a valid deploydaemon to be allowed, got %+v", response.Result)
+	}
+
+	invalid := newDeployDaemon()
+	invalid.Spec.Replica = nil
+	response := review(t, ValidatePath, admissionv1beta1.Create, invalid, nil)
+	if response.Allowed || response.Result == nil || response.Result.Reason != metav1.StatusReasonInvalid {
+		t.Fatalf("expected an invalid deploydaemon to be rejected, got %+v", response)
+	}
+	if details := response.Result.Details; details == nil || len(details.Causes) != 1 || details.Causes[0].Field != "spec.instance" {
+		t.Errorf("expected the cause to be spec.instance, got %+v", details)
+	}
+
+	renamed := newDeployDaemon()
+	renamed.Spec.Component = "ts-web"
+	if response := review(t, ValidatePath, admissionv1beta1.Update, renamed, newDeployDaemon()); response.Allowed {
+		t.Error("expected a change of component to be rejected")
+	}
+}
+
+func TestAdmissionHandlerRejectsBadRequests(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"get", http.MethodGet, "application/json", "", http.StatusMethodNotAllowed},
+		{"yaml", http.MethodPost, "application/yaml", "request: {}", http.StatusUnsupportedMediaType},
+		{"no request", http.MethodPost, "application/json", "{}", http.StatusBadRequest},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(test.method, ValidatePath, bytes.NewReader([]byte(test.body)))
+			r.Header.Set("Content-Type", test.contentType)
+			w := httptest.NewRecorder()
+			NewHandler().ServeHTTP(w, r)
+			if w.Code != test.code {
+				t.Errorf("expected status %d, got %d", test.code, w.Code)
+			}
+		})
+	}
+}
+
+func TestEnsureCertificates(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	dnsNames := serviceDNSNames("deploydaemon-operator", "operators")
+	now := time.Date(2019, 1, 5, 3, 0, 0, 0, time.UTC)
+
+	certs, err := ensureCertificates(client, "operators", "webhook-cert", dnsNames, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := certs.checkServing(dnsNames, now); err != nil {
+		t.Fatalf("expected a valid serving certificate, got %s", err.Error())
+	}
+
+	// Another replica, or a restart, reuses the certificates of the Secret
+	reused, err := ensureCertificates(client, "operators", "webhook-cert", dnsNames, now.Add(time.Hour))
+	if err != nil || !reused.equal(certs) {
+		t.Fatalf("expected the stored certificates to be reused, got %v", err)
+	}
+
+	// Close to its expiry the serving certificate is renewed, signed by the same CA
+	later := now.Add(certValidity - renewBefore/2)
+	renewed, err := ensureCertificates(client, "operators", "webhook-cert", dnsNames, later)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if bytes.Equal(renewed.cert, certs.cert) || !bytes.Equal(renewed.caCert, certs.caCert) {
+		t.Error("expected a new serving certificate signed by the same CA")
+	}
+	if err := renewed.checkServing(dnsNames, later); err != nil {
+		t.Errorf("expected a valid renewed certificate, got %s", err.Error())
+	}
+
+	secret, _ := client.CoreV1().Secrets("operators").Get("webhook-cert", metav1.GetOptions{})
+	if !certificatesFromSecret(secret).equal(renewed) {
+		t.Error("expected the renewed certificates to be stored in the secret")
+	}
+}
+
+func TestRegisterWebhooks(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	webhook := config.Webhook{Addr: ":9443", ServiceName: "deploydaemon-operator", ServiceNamespace: "operators"}
+
+	if err := registerWebhooks(client, webhook, []byte("ca-1")); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := registerWebhooks(client, webhook, []byte("ca-1")); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := registerWebhooks(client, webhook, []byte("ca-2")); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	var writes []string
+	for _, action := range client.Actions() {
+		if action.GetVerb() != "get" {
+			writes = append(writes, action.GetVerb()+" "+action.GetResource().Resource)
+		}
+	}
+	expected := []string{
+		"create validatingwebhookconfigurations", "create mutatingwebhookconfigurations",
+		"update validatingwebhookconfigurations", "update mutatingwebhookconfigurations",
+	}
+	if !reflect.DeepEqual(writes, expected) {
+		t.Errorf("expected creates and updates for the new CA only, got %v", writes)
+	}
+
+	validating, _ := client.AdmissionregistrationV1beta1().ValidatingWebhookConfigurations().Get("deploydaemon-operator", metav1.GetOptions{})
+	clientConfig := validating.Webhooks[0].ClientConfig
+	if string(clientConfig.CABundle) != "ca-2" || clientConfig.Service.Namespace != "operators" || *clientConfig.Service.Path != ValidatePath {
+		t.Errorf("unexpected validating client config %+v", clientConfig)
+	}
+	mutating, _ := client.AdmissionregistrationV1beta1().MutatingWebhookConfigurations().Get("deploydaemon-operator", metav1.GetOptions{})
+	clientConfig = mutating.Webhooks[0].ClientConfig
+	if string(clientConfig.CABundle) != "ca-2" || *clientConfig.Service.Path != MutatePath {
+		t.Errorf("unexpected mutating client config %+v", clientConfig)
+	}
+}
+
+func TestMutateHandler(t *testing.T) {
+	dd := newDeployDaemon()
+	dd.Spec.Tenant = "Demo"
+	dd.Spec.Replica = nil
+	dd.Spec.Expose = ""
+	dd.Labels = map[string]string{"team": "payments"}
+
+	response := review(t, MutatePath, admissionv1beta1.Create, dd, nil)
+	if !response.Allowed || response.PatchType == nil || *response.PatchType != admissionv1beta1.PatchTypeJSONPatch {
+		t.Fatalf("expected an allowed response with a JSON patch, got %+v", response)
+	}
+	patch, err := jsonpatch.DecodePatch(response.Patch)
+	if err != nil {
+		t.Fatalf("invalid patch %s: %s", response.Patch, err.Error())
+	}
+	raw, _ := json.Marshal(dd)
+	patched, err := patch.Apply(raw)
+	if err != nil {
+		t.Fatalf("apply patch %s failed: %s", response.Patch, err.Error())
+	}
+
+	mutated := &v1alpha1.DeployDaemon{}
+	if err := json.Unmarshal(patched, mutated); err != nil {
+		t.Fatal(err)
+	}
+	expected := dd.DeepCopy()
+	v1alpha1.SetDeployDaemonDefaults(expected, nil)
+	if !equality.Semantic.DeepEqual(mutated, expected) {
+		t.Errorf("expected the patch to apply the defaults, got %s", patched)
+	}
+	if errs := ValidateDeployDaemon(mutated); len(errs) > 0 {
+		t.Errorf("expected the defaulted deploydaemon to be valid, got %v", errs)
+	}
+
+	// A defaulted deploydaemon is not patched again
+	if response := review(t, MutatePath, admissionv1beta1.Update, mutated, mutated); !response.Allowed || response.Patch != nil {
+		t.Errorf("expected no patch, got %s", response.Patch)
+	}
+}
+
+func TestCreatePatch(t *testing.T) {
+	original := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "ts-app", "labels": map[string]interface{}{}},
+		"spec":     map[string]interface{}{"expose": "", "ports": []interface{}{80}, "old": true},
+	}
+	modified := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "ts-app", "labels": map[string]interface{}{"app/name": "ts-app"}},
+		"spec":     map[string]interface{}{"expose": "offline", "ports": []interface{}{80, 443}, "instance": 0},
+	}
+	patch, err := createPatch(original, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(patch)
+	expected := `[{"op":"add","path":"/metadata/labels/app~1name","value":"ts-app"},` +
+		`{"op":"add","path":"/spec/expose","value":"offline"},` +
+		`{"op":"add","path":"/spec/instance","value":0},` +
+		`{"op":"remove","path":"/spec/old","value":null},` +
+		`{"op":"add","path":"/spec/ports","value":[80,443]}]`
+	if string(data) != expected {
+		t.Errorf("expected patch %s, got %s", expected, data)
+	}
+}
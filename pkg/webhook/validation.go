@@ -0,0 +1,235 @@
+package webhook
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1beta1"
+	utils "github.com/kongyi-ibm/k8s-deployment-operator/pkg/utilities"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// exposeValues are the values of spec.expose, they label the pods
+var exposeValues = []string{"online", "offline"}
+
+// ValidateDeployDaemon returns the errors of a deploydaemon being created
+func ValidateDeployDaemon(deploydaemon *v1alpha1.DeployDaemon) field.ErrorList {
+	return validateSpec(deploydaemon, field.NewPath("spec"))
+}
+
+// ValidateDeployDaemonUpdate returns the errors of an update of old to deploydaemon. The fields naming the deployments
+// and the Service of the component are immutable. The rest of the spec is only validated when it changes, so an object
+// created before the webhook can still be updated by the controller, e.g. to remove its finalizer.
+func ValidateDeployDaemonUpdate(deploydaemon, old *v1alpha1.DeployDaemon) field.ErrorList {
+	specPath := field.NewPath("spec")
+
+	var errs field.ErrorList
+	for _, immutable := range []struct{ name, value, old string }{
+		{"tenant", deploydaemon.Spec.Tenant, old.Spec.Tenant},
+		{"environment", deploydaemon.Spec.Environment, old.Spec.Environment},
+		{"envtype", deploydaemon.Spec.EnvType, old.Spec.EnvType},
+		{"component", deploydaemon.Spec.Component, old.Spec.Component},
+	} {
+		if immutable.value != immutable.old {
+			errs = append(errs, field.Invalid(specPath.Child(immutable.name), immutable.value,
+				"field is immutable, it names the deployments and the service of the component"))
+		}
+	}
+
+	if deploydaemon.DeletionTimestamp != nil || equality.Semantic.DeepEqual(deploydaemon.Spec, old.Spec) {
+		return errs
+	}
+	return append(errs, validateSpec(deploydaemon, specPath)...)
+}
+
+func validateSpec(deploydaemon *v1alpha1.DeployDaemon, path *field.Path) field.ErrorList {
+	spec := &deploydaemon.Spec
+
+	var errs field.ErrorList
+	for _, required := range []struct{ name, value string }{
+		{"tenant", spec.Tenant},
+		{"environment", spec.Environment},
+		{"envtype", spec.EnvType},
+		{"component", spec.Component},
+		{"version", spec.Version},
+		{"image", spec.Image},
+	} {
+		if required.value == "" {
+			errs = append(errs, field.Required(path.Child(required.name), ""))
+		}
+	}
+	errs = append(errs, validateNames(deploydaemon, path)...)
+
+	if spec.Replica == nil {
+		errs = append(errs, field.Required(path.Child("instance"), ""))
+	} else if *spec.Replica < 0 {
+		errs = append(errs, field.Invalid(path.Child("instance"), *spec.Replica, "must not be negative"))
+	}
+
+	switch spec.Expose {
+	case "":
+		errs = append(errs, field.Required(path.Child("expose"), ""))
+	case exposeValues[0], exposeValues[1]:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("expose"), spec.Expose, exposeValues))
+	}
+
+	if spec.Scheduler != "" {
+		if _, err := utils.ParseSchedule(spec.Scheduler); err != nil {
+			errs = append(errs, field.Invalid(path.Child("scheduler"), spec.Scheduler, err.Error()))
+		}
+	}
+
+	errs = append(errs, validateObjectName(path.Child("configRef"), spec.Config)...)
+	errs = append(errs, validateObjectName(path.Child("templateRef"), spec.TemplateRef)...)
+	for i, secret := range spec.Secrets {
+		secretPath := path.Child("secretRefs").Index(i)
+		if secret.Name == "" {
+			errs = append(errs, field.Required(secretPath.Child("paramName"), ""))
+		} else {
+			for _, msg := range validation.IsEnvVarName(secret.Name) {
+				errs = append(errs, field.Invalid(secretPath.Child("paramName"), secret.Name, msg))
+			}
+		}
+		if secret.Secret == "" {
+			errs = append(errs, field.Required(secretPath.Child("secretName"), ""))
+		}
+		errs = append(errs, validateObjectName(secretPath.Child("secretName"), secret.Secret)...)
+	}
+
+	errs = append(errs, validatePercent(path.Child("exposePercent"), spec.ExposePercent)...)
+	if spec.Weight != nil && *spec.Weight < 0 {
+		errs = append(errs, field.Invalid(path.Child("weight"), *spec.Weight, "must not be negative"))
+	}
+	for i, port := range spec.Ports {
+		for _, msg := range validation.IsValidPortNum(int(port.Port)) {
+			errs = append(errs, field.Invalid(path.Child("ports").Index(i).Child("port"), port.Port, msg))
+		}
+	}
+	if spec.RevisionHistoryLimit != nil && *spec.RevisionHistoryLimit < 0 {
+		errs = append(errs, field.Invalid(path.Child("revisionHistoryLimit"), *spec.RevisionHistoryLimit, "must not be negative"))
+	}
+	if spec.RollbackTo != nil && spec.RollbackTo.Revision < 0 {
+		errs = append(errs, field.Invalid(path.Child("rollbackTo", "revision"), spec.RollbackTo.Revision, "must not be negative"))
+	}
+	if spec.DrainPeriod != nil && spec.DrainPeriod.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("drainPeriod"), spec.DrainPeriod.Duration.String(), "must not be negative"))
+	}
+	return append(errs, validateStrategy(path.Child("strategy"), spec.Strategy)...)
+}
+
+// validateNames checks the names built from the spec: GetDeploymentName() names the Service and labels the pods,
+// the deployment of a version adds the version to it
+func validateNames(deploydaemon *v1alpha1.DeployDaemon, path *field.Path) field.ErrorList {
+	spec := &deploydaemon.Spec
+
+	var errs field.ErrorList
+	if spec.Tenant != "" && spec.Environment != "" && spec.EnvType != "" && spec.Component != "" {
+		name := deploydaemon.GetDeploymentName()
+		msgs := validation.IsDNS1035Label(name)
+		for _, msg := range msgs {
+			errs = append(errs, field.Invalid(path.Child("component"), name,
+				"tenant, environment, envtype and component must combine into a valid Service name: "+msg))
+		}
+
+		// The deployment name is only checked on a valid Service name, it would fail for the same reason
+		if spec.Version != "" && len(msgs) == 0 {
+			deployment := name + "-" + spec.Version
+			for _, msg := range validation.IsDNS1123Subdomain(deployment) {
+				errs = append(errs, field.Invalid(path.Child("version"), deployment,
+					"version must combine with the component into a valid Deployment name: "+msg))
+			}
+		}
+	}
+
+	for _, msg := range validation.IsValidLabelValue(spec.Version) {
+		errs = append(errs, field.Invalid(path.Child("version"), spec.Version, "version labels the pods: "+msg))
+	}
+	return errs
+}
+
+// validateObjectName checks the name of a ConfigMap or a Secret referred to by the spec, when it is set
+func validateObjectName(path *field.Path, name string) field.ErrorList {
+	var errs field.ErrorList
+	if name == "" {
+		return errs
+	}
+	for _, msg := range validation.IsDNS1123Subdomain(name) {
+		errs = append(errs, field.Invalid(path, name, msg))
+	}
+	return errs
+}
+
+func validatePercent(path *field.Path, percent *int32) field.ErrorList {
+	var errs field.ErrorList
+	if percent != nil && (*percent < 0 || *percent > 100) {
+		errs = append(errs, field.Invalid(path, *percent, validation.InclusiveRangeError(0, 100)))
+	}
+	return errs
+}
+
+func validateStrategy(path *field.Path, strategy *v1alpha1.DeployStrategy) field.ErrorList {
+	var errs field.ErrorList
+	if strategy == nil {
+		return errs
+	}
+
+	if canary := strategy.Canary; canary != nil {
+		if len(canary.Steps) == 0 {
+			errs = append(errs, field.Required(path.Child("canary", "steps"), "a canary needs at least one step"))
+		}
+		for i, step := range canary.Steps {
+			stepPath := path.Child("canary", "steps").Index(i)
+			errs = append(errs, validatePercent(stepPath.Child("setWeight"), step.SetWeight)...)
+			if step.Pause != nil && step.Pause.Duration < 0 {
+				errs = append(errs, field.Invalid(stepPath.Child("pause"), step.Pause.Duration.String(), "must not be negative"))
+			}
+		}
+	}
+
+	if blueGreen := strategy.BlueGreen; blueGreen != nil {
+		if blueGreen.AutoPromoteAfter != nil && blueGreen.AutoPromoteAfter.Duration < 0 {
+			errs = append(errs, field.Invalid(path.Child("blueGreen", "autoPromoteAfter"), blueGreen.AutoPromoteAfter.Duration.String(), "must not be negative"))
+		}
+		if blueGreen.ScaleDownDelay != nil && blueGreen.ScaleDownDelay.Duration < 0 {
+			errs = append(errs, field.Invalid(path.Child("blueGreen", "scaleDownDelay"), blueGreen.ScaleDownDelay.Duration.String(), "must not be negative"))
+		}
+	}
+	return errs
+}
+
+// v1beta1Fields renames the v1alpha1 fields of the validation errors of a v1beta1 deploydaemon
+var v1beta1Fields = strings.NewReplacer(
+	"spec.envtype", "spec.envType",
+	"spec.instance", "spec.replicas",
+	"spec.scheduler", "spec.schedule",
+	".paramName", ".envName",
+)
+
+// validateV1beta1 returns errs, the errors of the v1alpha1 version of the v1beta1 deploydaemon raw, with the v1beta1
+// field names and the errors of the fields v1alpha1 does not have
+func validateV1beta1(raw []byte, errs field.ErrorList) field.ErrorList {
+	for _, err := range errs {
+		err.Field = v1beta1Fields.Replace(err.Field)
+	}
+
+	deploydaemon := &v1beta1.DeployDaemon{}
+	if err := json.Unmarshal(raw, deploydaemon); err != nil {
+		return append(errs, field.Invalid(field.NewPath("spec"), "", err.Error()))
+	}
+	if schedule := deploydaemon.Spec.Schedule; schedule != nil {
+		set := 0
+		for _, isSet := range []bool{schedule.At != nil, schedule.Delay != nil, schedule.Cron != ""} {
+			if isSet {
+				set++
+			}
+		}
+		if set != 1 {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "schedule"), schedule, "exactly one of at, delay or cron must be set"))
+		}
+	}
+	return errs
+}
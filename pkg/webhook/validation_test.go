@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func newDeployDaemon() *v1alpha1.DeployDaemon {
+	return &v1alpha1.DeployDaemon{
+		ObjectMeta: metav1.ObjectMeta{Name: "ts-app", Namespace: metav1.NamespaceDefault},
+		Spec: v1alpha1.DeploydaemonSpec{
+			Tenant:      "demo",
+			Environment: "qa",
+			EnvType:     "auth",
+			Component:   "ts-app",
+			Image:       "nginx:latest",
+			Version:     "9.0.1.2",
+			Replica:     int32Ptr(1),
+			Expose:      "online",
+			Config:      "demoqaauth",
+			Secrets:     []v1alpha1.SecretsRef{{Name: "VAULT_TOKEN", Secret: "demoqaauth-vaulttoken"}},
+		},
+	}
+}
+
+func TestValidateDeployDaemon(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		modify func(dd *v1alpha1.DeployDaemon)
+		// errs are the fields expected in the errors, none when empty
+		errs []string
+	}{
+		{"valid", func(dd *v1alpha1.DeployDaemon) {}, nil},
+		{"missing instance", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Replica = nil }, []string{"spec.instance"}},
+		{"negative instance", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Replica = int32Ptr(-1) }, []string{"spec.instance"}},
+		{"missing names", func(dd *v1alpha1.DeployDaemon) {
+			dd.Spec.Tenant = ""
+			dd.Spec.Version = ""
+		}, []string{"spec.tenant", "spec.version"}},
+		{"upper case tenant", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Tenant = "Demo" }, []string{"spec.component"}},
+		{"component with dots", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Component = "ts.app" }, []string{"spec.component"}},
+		{"service name too long", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Component = strings.Repeat("a", 60) }, []string{"spec.component"}},
+		{"tenant starting with a digit", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Tenant = "1demo" }, []string{"spec.component"}},
+		{"version with underscore", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Version = "9.0_1" }, []string{"spec.version"}},
+		{"version not a label value", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Version = "9.0.1-" }, []string{"spec.version", "spec.version"}},
+		{"unknown expose", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Expose = "public" }, []string{"spec.expose"}},
+		{"missing expose", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Expose = "" }, []string{"spec.expose"}},
+		{"delay schedule", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Scheduler = "1m" }, nil},
+		{"cron schedule", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Scheduler = "30 2 * * 6" }, nil},
+		{"bad schedule", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Scheduler = "every monday" }, []string{"spec.scheduler"}},
+		{"secret name with underscore", func(dd *v1alpha1.DeployDaemon) {
+			dd.Spec.Secrets[0].Secret = "demoqaauth_vaulttoken"
+		}, []string{"spec.secretRefs[0].secretName"}},
+		{"invalid env var", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Secrets[0].Name = "1TOKEN" }, []string{"spec.secretRefs[0].paramName"}},
+		{"invalid configRef", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Config = "Demo_QA" }, []string{"spec.configRef"}},
+		{"exposePercent out of range", func(dd *v1alpha1.DeployDaemon) { dd.Spec.ExposePercent = int32Ptr(120) }, []string{"spec.exposePercent"}},
+		{"negative weight", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Weight = int32Ptr(-1) }, []string{"spec.weight"}},
+		{"invalid port", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Ports = []corev1.ServicePort{{Port: 0}} }, []string{"spec.ports[0].port"}},
+		{"negative drain period", func(dd *v1alpha1.DeployDaemon) {
+			dd.Spec.DrainPeriod = &metav1.Duration{Duration: -time.Second}
+		}, []string{"spec.drainPeriod"}},
+		{"canary without steps", func(dd *v1alpha1.DeployDaemon) {
+			dd.Spec.Strategy = &v1alpha1.DeployStrategy{Canary: &v1alpha1.CanaryStrategy{}}
+		}, []string{"spec.strategy.canary.steps"}},
+		{"canary weight out of range", func(dd *v1alpha1.DeployDaemon) {
+			dd.Spec.Strategy = &v1alpha1.DeployStrategy{Canary: &v1alpha1.CanaryStrategy{
+				Steps: []v1alpha1.CanaryStep{{SetWeight: int32Ptr(20)}, {SetWeight: int32Ptr(200)}},
+			}}
+		}, []string{"spec.strategy.canary.steps[1].setWeight"}},
+		{"negative blue/green delay", func(dd *v1alpha1.DeployDaemon) {
+			dd.Spec.Strategy = &v1alpha1.DeployStrategy{BlueGreen: &v1alpha1.BlueGreenStrategy{
+				ScaleDownDelay: &metav1.Duration{Duration: -time.Minute},
+			}}
+		}, []string{"spec.strategy.blueGreen.scaleDownDelay"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dd := newDeployDaemon()
+			test.modify(dd)
+			assertFieldErrors(t, ValidateDeployDaemon(dd), test.errs)
+		})
+	}
+}
+
+func TestValidateDeployDaemonUpdate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		old    func(dd *v1alpha1.DeployDaemon)
+		modify func(dd *v1alpha1.DeployDaemon)
+		errs   []string
+	}{
+		{"new version", func(dd *v1alpha1.DeployDaemon) {}, func(dd *v1alpha1.DeployDaemon) { dd.Spec.Version = "9.0.1.3" }, nil},
+		{"changed component", func(dd *v1alpha1.DeployDaemon) {}, func(dd *v1alpha1.DeployDaemon) { dd.Spec.Component = "ts-web" }, []string{"spec.component"}},
+		{"changed tenant and environment", func(dd *v1alpha1.DeployDaemon) {}, func(dd *v1alpha1.DeployDaemon) {
+			dd.Spec.Tenant = "prod"
+			dd.Spec.Environment = "eu"
+		}, []string{"spec.tenant", "spec.environment"}},
+		{"invalid change", func(dd *v1alpha1.DeployDaemon) {}, func(dd *v1alpha1.DeployDaemon) { dd.Spec.Expose = "public" }, []string{"spec.expose"}},
+		{"finalizer of an invalid object", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Replica = nil }, func(dd *v1alpha1.DeployDaemon) {
+			dd.Finalizers = []string{"deploycontrol.k8s.io/drain"}
+		}, nil},
+		{"deleted invalid object", func(dd *v1alpha1.DeployDaemon) { dd.Spec.Replica = nil }, func(dd *v1alpha1.DeployDaemon) {
+			now := metav1.Now()
+			dd.DeletionTimestamp = &now
+			dd.Spec.Version = "9.0.1.3"
+		}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			old := newDeployDaemon()
+			test.old(old)
+			dd := old.DeepCopy()
+			test.modify(dd)
+			assertFieldErrors(t, ValidateDeployDaemonUpdate(dd, old), test.errs)
+		})
+	}
+}
+
+// assertFieldErrors checks errs are about the fields expected, in order
+func assertFieldErrors(t *testing.T, errs field.ErrorList, expected []string) {
+	var fields []string
+	for _, err := range errs {
+		fields = append(fields, err.Field)
+	}
+	if strings.Join(fields, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected errors on %v, got %v", expected, errs)
+	}
+}
+
+func TestExamplesAreValid(t *testing.T) {
+	for _, file := range []string{"deploydaemon-example.yaml", "deploydaemon-example-1.yaml"} {
+		data, err := ioutil.ReadFile(filepath.Join("..", "..", "artifacts", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dd := &v1alpha1.DeployDaemon{}
+		if err := yaml.UnmarshalStrict(data, dd); err != nil {
+			t.Fatalf("parse %s failed: %s", file, err.Error())
+		}
+		if errs := ValidateDeployDaemon(dd); len(errs) > 0 {
+			t.Errorf("expected %s to be valid, got %v", file, errs)
+		}
+	}
+}
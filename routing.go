@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/traffic"
+)
+
+// syncTraffic routes the traffic of the component of deploydaemon between the versions of all its deploydaemons.
+// Online versions get the weight of their spec, 100 when it has none, offline versions get none.
+func (c *Controller) syncTraffic(deploydaemon *v1alpha1.DeployDaemon) error {
+	if c.traffic == nil {
+		return nil
+	}
+
+	siblings, err := c.componentDeployDaemons(deploydaemon)
+	if err != nil {
+		return err
+	}
+
+	return c.traffic.Sync(&traffic.Component{
+		Name:      deploydaemon.GetDeploymentName(),
+		Namespace: deploydaemon.Namespace,
+		Owners:    componentOwners(siblings),
+		Routes:    trafficRoutes(siblings),
+	})
+}
+
+// trafficRoutes returns one route per version of the component. During a rollout the weight of the deploydaemon is
+// split between the new and the previous version: by the canary weight for a canary, all to the previous version
+// until the preview is promoted for a blue/green. The versions of offline deploydaemons, a blue/green preview and the
+// version it replaced once promoted are not online, they get no traffic even when no version has a weight.
+func trafficRoutes(deploydaemons []*v1alpha1.DeployDaemon) []traffic.Route {
+	var routes []traffic.Route
+	seen := map[string]int{}
+
+	addRoute := func(version string, weight int32, online bool) {
+		// Two deploydaemons of the same version share its subset
+		if i, exist := seen[version]; exist {
+			routes[i].Weight += weight
+			routes[i].Online = routes[i].Online || online
+			return
+		}
+		seen[version] = len(routes)
+		routes = append(routes, traffic.Route{Version: version, Weight: weight, Online: online})
+	}
+
+	for _, dd := range deploydaemons {
+		online := dd.Spec.Expose == exposeOnline
+		var weight int32
+		if online {
+			weight = 100
+			if dd.Spec.Weight != nil {
+				weight = *dd.Spec.Weight
+			}
+		}
+
+		if canary := rolloutCanary(dd); canary != nil {
+			addRoute(canary.StableVersion, weight*(100-canary.Weight)/100, online)
+			addRoute(dd.Spec.Version, weight*canary.Weight/100, online)
+			continue
+		}
+
+		if bg := rolloutBlueGreen(dd); bg != nil {
+			if bg.Phase == blueGreenPreview {
+				addRoute(bg.ActiveVersion, weight, online)
+				addRoute(dd.Spec.Version, 0, false)
+			} else {
+				addRoute(dd.Spec.Version, weight, online)
+				addRoute(bg.ActiveVersion, 0, false)
+			}
+			continue
+		}
+
+		addRoute(dd.Spec.Version, weight, online)
+	}
+
+	return routes
+}
+
+// releaseTraffic takes the version of deploydaemon out of the routing of its component, the routing objects are
+// removed with the last deploydaemon of the component
+func (c *Controller) releaseTraffic(deploydaemon *v1alpha1.DeployDaemon) error {
+	if c.traffic == nil {
+		return nil
+	}
+
+	others, err := c.componentPeers(deploydaemon)
+	if err != nil {
+		return err
+	}
+
+	if len(others) == 0 {
+		return c.traffic.Remove(deploydaemon.GetDeploymentName(), deploydaemon.Namespace)
+	}
+	return c.traffic.Sync(&traffic.Component{
+		Name:      deploydaemon.GetDeploymentName(),
+		Namespace: deploydaemon.Namespace,
+		Owners:    componentOwners(others),
+		Routes:    trafficRoutes(others),
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/traffic"
+)
+
+type fakeTrafficProvider struct {
+	synced  []*traffic.Component
+	removed []string
+}
+
+func (p *fakeTrafficProvider) Sync(component *traffic.Component) error {
+	p.synced = append(p.synced, component)
+	return nil
+}
+
+func (p *fakeTrafficProvider) Remove(name, namespace string) error {
+	p.removed = append(p.removed, namespace+"/"+name)
+	return nil
+}
+
+func TestSyncTrafficRoutesEveryVersion(t *testing.T) {
+	f := newFixture(t)
+	v1 := newVersionedDeployDaemon("ts-app-v1", "9.0.1.2")
+	v2 := newVersionedDeployDaemon("ts-app-v2", "9.0.1.3")
+	v3 := newVersionedDeployDaemon("ts-app-v3", "9.0.1.4")
+	w1, w2, w3 := int32(80), int32(20), int32(50)
+	v1.Spec.Weight, v2.Spec.Weight, v3.Spec.Weight = &w1, &w2, &w3
+	v3.Spec.Expose = exposeOffline
+	for _, dd := range []*v1alpha1.DeployDaemon{v1, v2, v3} {
+		f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	}
+
+	c := f.newController()
+	provider := &fakeTrafficProvider{}
+	c.traffic = provider
+
+	if err := c.syncTraffic(v1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(provider.synced) != 1 {
+		t.Fatalf("expected traffic to be synced once, got %d", len(provider.synced))
+	}
+
+	component := provider.synced[0]
+	if component.Name != v1.GetDeploymentName() || len(component.Owners) != 3 {
+		t.Errorf("unexpected component %+v", *component)
+	}
+	expected := map[string]int32{"9.0.1.2": 80, "9.0.1.3": 20, "9.0.1.4": 0}
+	for _, route := range component.Routes {
+		if expected[route.Version] != route.Weight {
+			t.Errorf("expected version %s weight %d, got %d", route.Version, expected[route.Version], route.Weight)
+		}
+	}
+}
+
+func TestTrafficRoutesWithoutWeight(t *testing.T) {
+	v1 := newVersionedDeployDaemon("ts-app-v1", "9.0.1.2")
+	v2 := newVersionedDeployDaemon("ts-app-v2", "9.0.1.3")
+	v3 := newVersionedDeployDaemon("ts-app-v3", "9.0.1.4")
+	w2 := int32(100)
+	v2.Spec.Weight = &w2
+	v3.Spec.Expose = exposeOffline
+
+	// An online version without weight gets a full share next to a weighted one, an offline version none
+	routes := traffic.NormalizeWeights(trafficRoutes([]*v1alpha1.DeployDaemon{v1, v2, v3}))
+	expected := []traffic.Route{
+		{Version: "9.0.1.2", Weight: 50, Online: true},
+		{Version: "9.0.1.3", Weight: 50, Online: true},
+		{Version: "9.0.1.4", Weight: 0},
+	}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("expected routes %+v, got %+v", expected, routes)
+	}
+}
+
+func TestTrafficRoutesOnlineAndOffline(t *testing.T) {
+	online := newVersionedDeployDaemon("ts-app-v1", "9.0.1.2")
+	offline := newVersionedDeployDaemon("ts-app-v2", "9.0.1.3")
+	zero := int32(0)
+	online.Spec.Weight = &zero
+	offline.Spec.Expose = exposeOffline
+
+	// Even when no version has a weight the offline version gets no traffic
+	routes := traffic.NormalizeWeights(trafficRoutes([]*v1alpha1.DeployDaemon{online, offline}))
+	expected := []traffic.Route{
+		{Version: "9.0.1.2", Weight: 100, Online: true},
+		{Version: "9.0.1.3", Weight: 0},
+	}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("expected routes %+v, got %+v", expected, routes)
+	}
+}
+
+func TestSyncTrafficDisabled(t *testing.T) {
+	c := newFixture(t).newController()
+	if err := c.syncTraffic(newVersionedDeployDaemon("ts-app", "9.0.1.2")); err != nil {
+		t.Errorf("expected no error without traffic provider, got %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	utils "github.com/kongyi-ibm/k8s-deployment-operator/pkg/utilities"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// syncSchedule decides if the spec of deploydaemon is due to be deployed according to its scheduler.
+//
+// The schedule of a spec is kept in status together with the hash of that spec: NextScheduleTime is computed
+// once when a new spec is observed, and LastScheduleTime is recorded when it is deployed. This way informer
+// resync and controller restart neither re-trigger nor skip a schedule, only a spec change schedules again.
+// Only the fields deploying a new version are scheduled, see scheduleHash, the others such as the replica count,
+// exposure, weight and rollbackTo neither wait for nor move the schedule: reconcile syncs them on the deployed
+// revision while the new version waits.
+//
+// It returns how long to wait before the spec is due, zero when it can be deployed now, and whether status changed.
+func (c *Controller) syncSchedule(deploydaemon *v1alpha1.DeployDaemon, now time.Time) (time.Duration, bool, error) {
+
+	schedule, err := utils.ParseSchedule(deploydaemon.Spec.Scheduler)
+	if err != nil {
+		return 0, false, err
+	}
+
+	hash, err := scheduleHash(deploydaemon.Spec)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if deploydaemon.Status == nil {
+		deploydaemon.Status = &v1alpha1.DeploydaemonStatus{}
+	}
+	status := deploydaemon.Status
+
+	// This spec was already deployed by the scheduler
+	if status.ScheduledSpecHash == hash && status.NextScheduleTime == nil {
+		return 0, false, nil
+	}
+
+	changed := false
+
+	if status.ScheduledSpecHash != hash || status.NextScheduleTime == nil {
+		next := schedule.Next(now)
+		if next.IsZero() {
+			return 0, false, fmt.Errorf("scheduler %s never activates after %s", deploydaemon.Spec.Scheduler, now.Format(time.RFC3339))
+		}
+		nextTime := metav1.NewTime(next.Truncate(time.Second))
+		status.NextScheduleTime = &nextTime
+		status.ScheduledSpecHash = hash
+		changed = true
+		klog.Infof("schedule deploydaemon %s at %s", deploydaemon.Name, nextTime.Format(time.RFC3339))
+	}
+
+	if wait := status.NextScheduleTime.Sub(now); wait > 0 {
+		return wait, changed, nil
+	}
+
+	lastTime := metav1.NewTime(now)
+	status.LastScheduleTime = &lastTime
+	status.NextScheduleTime = nil
+	klog.Infof("scheduled deploydaemon %s is due, deploy it", deploydaemon.Name)
+
+	return 0, true, nil
+}
+
+// scheduleHash hashes the fields of the spec that deploy a new version: the image, the version, the pod template,
+// the config and the secrets.
+func scheduleHash(spec v1alpha1.DeploydaemonSpec) (string, error) {
+	return utils.ComputeHash(struct {
+		Image       string
+		Version     string
+		TemplateRef string
+		Config      string
+		Secrets     []v1alpha1.SecretsRef
+	}{
+		Image:       spec.Image,
+		Version:     spec.Version,
+		TemplateRef: spec.TemplateRef,
+		Config:      spec.Config,
+		Secrets:     spec.Secrets,
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSyncScheduleWaitsUntilDue(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.Scheduler = "0 2 * * *"
+	now := time.Date(2019, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	wait, changed, err := c.syncSchedule(dd, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wait != 16*time.Hour || !changed {
+		t.Fatalf("expected to wait 16h with status changed, got %s %v", wait, changed)
+	}
+	if !dd.Status.NextScheduleTime.Time.Equal(time.Date(2019, 1, 3, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected next schedule 2019-01-03T02:00:00Z, got %s", dd.Status.NextScheduleTime)
+	}
+
+	// A resync or a restart one hour later keeps the persisted schedule
+	wait, changed, err = c.syncSchedule(dd, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wait != 15*time.Hour || changed {
+		t.Errorf("expected to keep waiting 15h without status change, got %s %v", wait, changed)
+	}
+}
+
+func TestSyncScheduleRunsOncePerSpec(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.Scheduler = "1m"
+	now := time.Date(2019, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	if wait, _, _ := c.syncSchedule(dd, now); wait != time.Minute {
+		t.Fatalf("expected to wait 1m, got %s", wait)
+	}
+
+	wait, changed, err := c.syncSchedule(dd, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wait != 0 || !changed {
+		t.Fatalf("expected schedule to be due, got %s %v", wait, changed)
+	}
+	if dd.Status.NextScheduleTime != nil || dd.Status.LastScheduleTime == nil {
+		t.Fatalf("expected last schedule to be recorded, got next %v last %v", dd.Status.NextScheduleTime, dd.Status.LastScheduleTime)
+	}
+
+	// Resync after the deploy does not delay the spec again
+	if wait, changed, _ := c.syncSchedule(dd, now.Add(time.Hour)); wait != 0 || changed {
+		t.Errorf("expected deployed spec not to be re-scheduled, got %s %v", wait, changed)
+	}
+
+	// A spec change is scheduled again
+	dd.Spec.Image = "registry.example.com/ts-app:9.0.1.3"
+	if wait, changed, _ := c.syncSchedule(dd, now.Add(time.Hour)); wait != time.Minute || !changed {
+		t.Errorf("expected changed spec to be scheduled again, got %s %v", wait, changed)
+	}
+}
+
+func TestSyncScheduleIgnoresOperationalChanges(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.Scheduler = "0 2 * * *"
+	now := time.Date(2019, 1, 3, 2, 0, 0, 0, time.UTC)
+
+	c.syncSchedule(dd, now.Add(-time.Hour))
+	if wait, _, _ := c.syncSchedule(dd, now); wait != 0 {
+		t.Fatalf("expected schedule to be due, got %s", wait)
+	}
+
+	// Scaling, exposure and weight do not deploy a new version, they are synced right away
+	replicas, percent, weight := int32(5), int32(50), int32(20)
+	dd.Spec.Replica, dd.Spec.ExposePercent, dd.Spec.Weight = &replicas, &percent, &weight
+	dd.Spec.Expose, dd.Spec.OfflinePods = exposeOffline, []string{"ts-app-0"}
+	if wait, changed, _ := c.syncSchedule(dd, now.Add(time.Hour)); wait != 0 || changed {
+		t.Errorf("expected operational changes not to be scheduled, got %s %v", wait, changed)
+	}
+
+	// A new config deploys a new version
+	dd.Spec.Config = "demoqaauth-v2"
+	if wait, _, _ := c.syncSchedule(dd, now.Add(time.Hour)); wait == 0 {
+		t.Errorf("expected a new config to be scheduled")
+	}
+}
+
+func TestSyncSchedulePastTimestampIsNotSkipped(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.Scheduler = "2019-01-01T00:00:00Z"
+
+	wait, changed, err := c.syncSchedule(dd, time.Date(2019, 1, 2, 10, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if wait != 0 || !changed || dd.Status.LastScheduleTime == nil {
+		t.Errorf("expected past schedule to be deployed now, got %s %v", wait, changed)
+	}
+}
+
+func TestSyncScheduleInvalid(t *testing.T) {
+	c := newFixture(t).newController()
+	dd := newDeployDaemon("test", 1)
+	dd.Spec.Scheduler = "every day"
+
+	if _, _, err := c.syncSchedule(dd, time.Now()); err == nil {
+		t.Errorf("expected error for invalid scheduler")
+	}
+}
+
+func TestReconcileSyncsDeployedVersionWhileScheduled(t *testing.T) {
+	f := newFixture(t)
+	dd := newDeployDaemon("test", 1)
+	f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Create(dd)
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	c := f.newController()
+	key := dd.Namespace + "/" + dd.Name
+
+	// 9.0.1.2 is deployed, then a new version is scheduled and the deploydaemon is scaled at once
+	c.reconcile(key)
+	deployed, _ := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	dp, _ := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(deployed.Status.Cluster.DeploymentName, metav1.GetOptions{})
+	f.kubeInformers.Apps().V1().Deployments().Informer().GetIndexer().Add(dp)
+	replicas := int32(3)
+	deployed.Spec.Version = "9.0.1.3"
+	deployed.Spec.Image = "registry.example.com/ts-app:9.0.1.3"
+	deployed.Spec.Scheduler = "1h"
+	deployed.Spec.Replica = &replicas
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Update(deployed)
+
+	c.reconcile(key)
+
+	updated, _ := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	if updated.Status.NextScheduleTime == nil {
+		t.Errorf("expected the new version to wait for its schedule")
+	}
+	if _, err := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(deploymentNameFor(deployed), metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected no deployment of the scheduled version, got %v", err)
+	}
+	dp, _ = f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(dp.Name, metav1.GetOptions{})
+	if *dp.Spec.Replicas != 3 {
+		t.Errorf("expected the deployed version to be scaled to 3 replicas, got %d", *dp.Spec.Replicas)
+	}
+	if image := dp.Spec.Template.Spec.Containers[0].Image; image != "registry.example.com/ts-app:9.0.1.2" {
+		t.Errorf("expected the deployed version to keep its image, got %s", image)
+	}
+}
+
+func TestReconcileScalesWhileScheduled(t *testing.T) {
+	f := newFixture(t)
+	dd := newDeployDaemon("test", 2)
+	f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Create(dd)
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(dd)
+	c := f.newController()
+	key := dd.Namespace + "/" + dd.Name
+	c.reconcile(key)
+	scheduled, _ := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	dp, _ := f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(scheduled.Status.Cluster.DeploymentName, metav1.GetOptions{})
+	f.kubeInformers.Apps().V1().Deployments().Informer().GetIndexer().Add(dp)
+
+	// A new version waits for the next night
+	scheduled.Spec.Version = "9.0.1.3"
+	scheduled.Spec.Image = "registry.example.com/ts-app:9.0.1.3"
+	scheduled.Spec.Scheduler = "0 2 * * *"
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Update(scheduled)
+	c.reconcile(key)
+	scheduled, _ = f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	next := scheduled.Status.NextScheduleTime
+	if next == nil {
+		t.Fatalf("expected the new version to wait for its schedule")
+	}
+
+	// kubectl scale or a HorizontalPodAutoscaler writes the replica count through the scale subresource meanwhile
+	replicas := int32(4)
+	scheduled.Spec.Replica = &replicas
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Update(scheduled)
+	c.reconcile(key)
+
+	dp, _ = f.kubeclient.AppsV1().Deployments(dd.Namespace).Get(dp.Name, metav1.GetOptions{})
+	if *dp.Spec.Replicas != 4 {
+		t.Fatalf("expected the deployed version to be scaled to 4 replicas, got %d", *dp.Spec.Replicas)
+	}
+	dp.Status.Replicas = 4
+	f.kubeInformers.Apps().V1().Deployments().Informer().GetIndexer().Update(dp)
+	scaled, _ := f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Update(scaled)
+	c.reconcile(key)
+
+	scaled, _ = f.extclient.Deploycontrol().DeployDaemons(dd.Namespace).Get(dd.Name, metav1.GetOptions{})
+	if scaled.Status.Replicas != 4 || scaled.Status.Selector != "app="+dd.GetDeploymentName()+",version=9.0.1.2" {
+		t.Errorf("expected the scale subresource to read the 4 replicas of 9.0.1.2, got %d %s", scaled.Status.Replicas, scaled.Status.Selector)
+	}
+	if scaled.Status.NextScheduleTime == nil || !scaled.Status.NextScheduleTime.Equal(next) {
+		t.Errorf("expected the scale not to move the schedule %s, got %v", next, scaled.Status.NextScheduleTime)
+	}
+}
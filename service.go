@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog"
+)
+
+// defaultServicePort is used when none of the deploydaemons of a component declares ports
+var defaultServicePort = corev1.ServicePort{
+	Name:       "http",
+	Protocol:   corev1.ProtocolTCP,
+	Port:       80,
+	TargetPort: intstr.FromInt(80),
+}
+
+// syncService makes sure the Service shared by every version of the component of deploydaemon exists.
+//
+// The Service is named after GetDeploymentName() and selects the online pods of all versions, so several
+// deploydaemons with different versions are online behind one stable endpoint. Each deploydaemon of the
+// component is an owner of the Service, the garbage collector removes it when the last one goes away.
+func (c *Controller) syncService(deploydaemon *v1alpha1.DeployDaemon) error {
+	name := deploydaemon.GetDeploymentName()
+
+	siblings, err := c.componentDeployDaemons(deploydaemon)
+	if err != nil {
+		return err
+	}
+
+	desired := makeService(name, deploydaemon.Namespace, siblings)
+	deploydaemon.Status.Cluster.ServiceName = name
+
+	service, err := c.serviceLister.Services(deploydaemon.Namespace).Get(name)
+	if errors.IsNotFound(err) {
+		klog.Infof("create service %s for deploydaemon %s", name, deploydaemon.Name)
+		_, err = c.kubeclientset.CoreV1().Services(deploydaemon.Namespace).Create(desired)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("create service %s failed: %s", name, err.Error())
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !isManagedService(service) {
+		return fmt.Errorf("service %s already exists and is not managed by deploydaemon", name)
+	}
+
+	if reflect.DeepEqual(service.Spec.Selector, desired.Spec.Selector) &&
+		reflect.DeepEqual(servicePortsWithoutNodePort(service.Spec.Ports), desired.Spec.Ports) &&
+		reflect.DeepEqual(service.OwnerReferences, desired.OwnerReferences) {
+		return nil
+	}
+
+	klog.Infof("update service %s for deploydaemon %s", name, deploydaemon.Name)
+	service = service.DeepCopy()
+	service.Spec.Selector = desired.Spec.Selector
+	service.Spec.Ports = desired.Spec.Ports
+	service.OwnerReferences = desired.OwnerReferences
+	if service.Labels == nil {
+		service.Labels = map[string]string{}
+	}
+	service.Labels[managedByLabel] = controllerAgentName
+
+	if _, err := c.kubeclientset.CoreV1().Services(deploydaemon.Namespace).Update(service); err != nil {
+		return fmt.Errorf("update service %s failed: %s", name, err.Error())
+	}
+	return nil
+}
+
+// componentDeployDaemons lists the deploydaemons sharing the deployment name of deploydaemon, whatever their version,
+// as they are deployed
+func (c *Controller) componentDeployDaemons(deploydaemon *v1alpha1.DeployDaemon) ([]*v1alpha1.DeployDaemon, error) {
+	all, err := c.deploydaemonLister.DeployDaemons(deploydaemon.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	siblings := []*v1alpha1.DeployDaemon{deploydaemon}
+	for _, dd := range all {
+		if dd.Name != deploydaemon.Name && dd.DeletionTimestamp == nil && dd.GetDeploymentName() == deploydaemon.GetDeploymentName() {
+			siblings = append(siblings, asDeployed(dd))
+		}
+	}
+
+	sort.Slice(siblings, func(i, j int) bool { return siblings[i].Name < siblings[j].Name })
+	return siblings, nil
+}
+
+// componentPeers lists the other deploydaemons of the component of deploydaemon, the ones left once it is deleted
+func (c *Controller) componentPeers(deploydaemon *v1alpha1.DeployDaemon) ([]*v1alpha1.DeployDaemon, error) {
+	siblings, err := c.componentDeployDaemons(deploydaemon)
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []*v1alpha1.DeployDaemon
+	for _, dd := range siblings {
+		if dd.Name != deploydaemon.Name {
+			peers = append(peers, dd)
+		}
+	}
+	return peers, nil
+}
+
+// releaseService takes deploydaemon out of the owners and ports of the Service of its component, the Service is
+// deleted with the last deploydaemon of the component
+func (c *Controller) releaseService(deploydaemon *v1alpha1.DeployDaemon) error {
+	name := deploydaemon.GetDeploymentName()
+
+	service, err := c.serviceLister.Services(deploydaemon.Namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !isManagedService(service) {
+		return nil
+	}
+
+	peers, err := c.componentPeers(deploydaemon)
+	if err != nil {
+		return err
+	}
+
+	if len(peers) == 0 {
+		klog.Infof("delete service %s of deploydaemon %s", name, deploydaemon.Name)
+		if err := c.kubeclientset.CoreV1().Services(deploydaemon.Namespace).Delete(name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("delete service %s failed: %s", name, err.Error())
+		}
+		return nil
+	}
+
+	desired := makeService(name, deploydaemon.Namespace, peers)
+	service = service.DeepCopy()
+	service.Spec.Ports = desired.Spec.Ports
+	service.OwnerReferences = desired.OwnerReferences
+
+	klog.Infof("release service %s from deploydaemon %s", name, deploydaemon.Name)
+	if _, err := c.kubeclientset.CoreV1().Services(deploydaemon.Namespace).Update(service); err != nil {
+		return fmt.Errorf("update service %s failed: %s", name, err.Error())
+	}
+	return nil
+}
+
+// componentOwners returns the owner references of objects shared by the deploydaemons of a component.
+// Several deploydaemons own such objects, so none of them can be their controller.
+func componentOwners(deploydaemons []*v1alpha1.DeployDaemon) []metav1.OwnerReference {
+	var owners []metav1.OwnerReference
+	for _, dd := range deploydaemons {
+		owner := *metav1.NewControllerRef(dd, v1alpha1.SchemeGroupVersion.WithKind("DeployDaemon"))
+		owner.Controller = nil
+		owners = append(owners, owner)
+	}
+	return owners
+}
+
+// makeService renders the Service of a component from all its deploydaemons
+func makeService(name, namespace string, deploydaemons []*v1alpha1.DeployDaemon) *corev1.Service {
+	ports := map[int32]corev1.ServicePort{}
+
+	for _, dd := range deploydaemons {
+		for _, port := range dd.Spec.Ports {
+			if _, exist := ports[port.Port]; !exist {
+				ports[port.Port] = normalizeServicePort(port)
+			}
+		}
+	}
+
+	servicePorts := make([]corev1.ServicePort, 0, len(ports))
+	for _, port := range ports {
+		servicePorts = append(servicePorts, port)
+	}
+	sort.Slice(servicePorts, func(i, j int) bool { return servicePorts[i].Port < servicePorts[j].Port })
+	if len(servicePorts) == 0 {
+		servicePorts = []corev1.ServicePort{defaultServicePort}
+	}
+
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			OwnerReferences: componentOwners(deploydaemons),
+			Labels: map[string]string{
+				"app":          name,
+				managedByLabel: controllerAgentName,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Selector: map[string]string{
+				"app":       name,
+				exposeLabel: exposeOnline,
+			},
+			Ports: servicePorts,
+		},
+	}
+}
+
+// normalizeServicePort fills in the defaults of the API server so that they do not show up as drift
+func normalizeServicePort(port corev1.ServicePort) corev1.ServicePort {
+	if port.Protocol == "" {
+		port.Protocol = corev1.ProtocolTCP
+	}
+	if port.TargetPort.Type == intstr.Int && port.TargetPort.IntVal == 0 {
+		port.TargetPort = intstr.FromInt(int(port.Port))
+	}
+	port.NodePort = 0
+	return port
+}
+
+func isManagedService(service *corev1.Service) bool {
+	return service.Labels[managedByLabel] == controllerAgentName
+}
+
+// servicePortsWithoutNodePort drops the node ports allocated by the API server so they do not show up as drift
+func servicePortsWithoutNodePort(ports []corev1.ServicePort) []corev1.ServicePort {
+	out := make([]corev1.ServicePort, len(ports))
+	for i, port := range ports {
+		port.NodePort = 0
+		out[i] = port
+	}
+	return out
+}
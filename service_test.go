@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/kongyi-ibm/k8s-deployment-operator/pkg/apis/deploycontrol/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newVersionedDeployDaemon(name, version string) *v1alpha1.DeployDaemon {
+	dd := newDeployDaemon(name, 1)
+	dd.UID = types.UID(name)
+	dd.Spec.Version = version
+	dd.Status = &v1alpha1.DeploydaemonStatus{Cluster: &v1alpha1.ClusterSpec{DeploymentName: deploymentNameFor(dd)}}
+	return dd
+}
+
+func TestSyncServiceCreatesSharedService(t *testing.T) {
+	f := newFixture(t)
+	v1 := newVersionedDeployDaemon("ts-app-v1", "9.0.1.2")
+	v2 := newVersionedDeployDaemon("ts-app-v2", "9.0.1.3")
+	v2.Spec.Ports = []corev1.ServicePort{{Name: "https", Port: 443}}
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(v1)
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(v2)
+	c := f.newController()
+
+	if err := c.syncService(v1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service, err := f.kubeclient.CoreV1().Services(v1.Namespace).Get(v1.GetDeploymentName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected service to be created: %v", err)
+	}
+	if service.Spec.Selector["app"] != v1.GetDeploymentName() || service.Spec.Selector[exposeLabel] != exposeOnline {
+		t.Errorf("expected service to select online pods of every version, got %v", service.Spec.Selector)
+	}
+	if _, versioned := service.Spec.Selector["version"]; versioned {
+		t.Errorf("expected service not to select on version")
+	}
+	if len(service.OwnerReferences) != 2 {
+		t.Fatalf("expected both deploydaemons to own the service, got %v", service.OwnerReferences)
+	}
+	for _, owner := range service.OwnerReferences {
+		if owner.Controller != nil && *owner.Controller {
+			t.Errorf("expected no controller owner on shared service")
+		}
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Port != 443 || service.Spec.Ports[0].TargetPort.IntVal != 443 {
+		t.Errorf("expected declared port 443, got %v", service.Spec.Ports)
+	}
+	if v1.Status.Cluster.ServiceName != service.Name {
+		t.Errorf("expected service name in status, got %s", v1.Status.Cluster.ServiceName)
+	}
+}
+
+func TestSyncServiceDefaultPort(t *testing.T) {
+	f := newFixture(t)
+	c := f.newController()
+	dd := newVersionedDeployDaemon("ts-app", "9.0.1.2")
+
+	if err := c.syncService(dd); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service, err := f.kubeclient.CoreV1().Services(dd.Namespace).Get(dd.GetDeploymentName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Port != 80 {
+		t.Errorf("expected default port 80, got %v", service.Spec.Ports)
+	}
+}
+
+func TestSyncServiceAddsOwner(t *testing.T) {
+	f := newFixture(t)
+	v1 := newVersionedDeployDaemon("ts-app-v1", "9.0.1.2")
+	v2 := newVersionedDeployDaemon("ts-app-v2", "9.0.1.3")
+
+	existing := makeService(v1.GetDeploymentName(), v1.Namespace, []*v1alpha1.DeployDaemon{v1})
+	f.kubeclient.CoreV1().Services(v1.Namespace).Create(existing)
+	f.kubeInformers.Core().V1().Services().Informer().GetIndexer().Add(existing)
+	f.extInformers.Deploycontrol().V1alpha1().DeployDaemons().Informer().GetIndexer().Add(v1)
+	c := f.newController()
+
+	if err := c.syncService(v2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service, err := f.kubeclient.CoreV1().Services(v1.Namespace).Get(v1.GetDeploymentName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(service.OwnerReferences) != 2 {
+		t.Errorf("expected second version to be added as owner, got %v", service.OwnerReferences)
+	}
+}
+
+func TestSyncServiceRefusesUnmanagedService(t *testing.T) {
+	f := newFixture(t)
+	dd := newVersionedDeployDaemon("ts-app", "9.0.1.2")
+
+	existing := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: dd.GetDeploymentName(), Namespace: dd.Namespace}}
+	f.kubeInformers.Core().V1().Services().Informer().GetIndexer().Add(existing)
+	c := f.newController()
+
+	if err := c.syncService(dd); err == nil {
+		t.Errorf("expected error for service not managed by deploydaemon")
+	}
+}